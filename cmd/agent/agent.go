@@ -0,0 +1,158 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/agent"
+	"github.com/mbeniwal-imwe/ark/internal/core/config"
+	"github.com/spf13/cobra"
+)
+
+var idleTimeout int
+
+// AgentCmd manages the background key agent
+var AgentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Hold the unlocked master key in a background agent",
+	Long: `The agent keeps the unlocked master key in locked memory and hands it to
+other ark commands over an owner-only Unix socket (~/.ark/data/agent.sock),
+so the key never has to be cached on disk.
+
+The agent locks itself after security.password_cache_timeout_seconds of
+inactivity; the next command prompts for the master password again.`,
+}
+
+var startCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start the agent in the background",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfgDir, _ := cmd.Root().PersistentFlags().GetString("config-dir")
+		cfg, err := config.Load(cfgDir)
+		if err != nil {
+			return err
+		}
+		if agent.IsRunning(cfgDir) {
+			return fmt.Errorf("agent already running")
+		}
+
+		// Re-exec self with the internal command to run the server
+		self, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		child := exec.Command(self, "--config-dir", cfgDir, "agent", "_run",
+			"--timeout", strconv.Itoa(cfg.Security.PasswordCacheTimeout))
+		// Detach from the terminal so closing it does not take the agent along
+		detach(child)
+		devNull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+		if err != nil {
+			return err
+		}
+		defer devNull.Close()
+		child.Stdin, child.Stdout, child.Stderr = devNull, devNull, devNull
+		if err := child.Start(); err != nil {
+			return err
+		}
+		// Let the child outlive this process without becoming a zombie
+		go child.Wait()
+
+		// Wait for the socket to come up
+		for i := 0; i < 20; i++ {
+			if agent.IsRunning(cfgDir) {
+				fmt.Printf("✅ Agent started (pid %d)\n", child.Process.Pid)
+				return nil
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		return fmt.Errorf("agent did not start")
+	},
+}
+
+var stopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the agent and wipe the key",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfgDir, _ := cmd.Root().PersistentFlags().GetString("config-dir")
+		if err := agent.Shutdown(cfgDir); err != nil {
+			return err
+		}
+		fmt.Println("🛑 Agent stopped")
+		return nil
+	},
+}
+
+var lockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Wipe the key from the agent without stopping it",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfgDir, _ := cmd.Root().PersistentFlags().GetString("config-dir")
+		if err := agent.Lock(cfgDir); err != nil {
+			return err
+		}
+		fmt.Println("🔒 Agent locked")
+		return nil
+	},
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show agent status",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfgDir, _ := cmd.Root().PersistentFlags().GetString("config-dir")
+		s, err := agent.Status(cfgDir)
+		if err != nil {
+			fmt.Println("stopped")
+			return nil
+		}
+		if s.Unlocked {
+			if s.ExpiresIn > 0 {
+				fmt.Printf("running (pid %d), unlocked, locks after %ds idle\n", s.PID, s.ExpiresIn)
+			} else {
+				fmt.Printf("running (pid %d), unlocked\n", s.PID)
+			}
+		} else {
+			fmt.Printf("running (pid %d), locked\n", s.PID)
+		}
+		return nil
+	},
+}
+
+// runCmd is the internal entry point used by start
+var runCmd = &cobra.Command{
+	Use:    "_run",
+	Hidden: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfgDir, _ := cmd.Root().PersistentFlags().GetString("config-dir")
+		server := &agent.Server{
+			SocketPath:  agent.SocketPath(cfgDir),
+			IdleTimeout: time.Duration(idleTimeout) * time.Second,
+		}
+
+		// The agent has no terminal to lose, so a hangup must not stop it
+		signal.Ignore(syscall.SIGHUP)
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sigs
+			server.Close()
+		}()
+
+		return server.ListenAndServe()
+	},
+}
+
+func init() {
+	AgentCmd.AddCommand(startCmd)
+	AgentCmd.AddCommand(stopCmd)
+	AgentCmd.AddCommand(lockCmd)
+	AgentCmd.AddCommand(statusCmd)
+	AgentCmd.AddCommand(runCmd)
+
+	runCmd.Flags().IntVar(&idleTimeout, "timeout", 300, "Idle timeout in seconds (0 disables)")
+}
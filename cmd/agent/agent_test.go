@@ -0,0 +1,119 @@
+package agent
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/agent"
+	"github.com/mbeniwal-imwe/ark/internal/core/config"
+)
+
+// setupTestAgent starts an agent serving a temporary config directory
+func setupTestAgent(t *testing.T, idle time.Duration) (string, func()) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "ark-agent-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	server := &agent.Server{SocketPath: agent.SocketPath(dir), IdleTimeout: idle}
+	go server.ListenAndServe()
+
+	for i := 0; i < 50 && !agent.IsRunning(dir); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !agent.IsRunning(dir) {
+		t.Fatal("Agent did not start")
+	}
+
+	cleanup := func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+	return dir, cleanup
+}
+
+func TestAgentPutGetLock(t *testing.T) {
+	dir, cleanup := setupTestAgent(t, 0)
+	defer cleanup()
+
+	if _, err := agent.GetKey(dir); err == nil {
+		t.Error("Expected error from a locked agent, but got none")
+	}
+
+	key := bytes.Repeat([]byte{0x42}, 32)
+	if err := agent.PutKey(dir, key); err != nil {
+		t.Fatalf("PutKey failed: %v", err)
+	}
+
+	got, err := agent.GetKey(dir)
+	if err != nil {
+		t.Fatalf("GetKey failed: %v", err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Errorf("Expected key %x, got %x", key, got)
+	}
+
+	if err := agent.Lock(dir); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if _, err := agent.GetKey(dir); err == nil {
+		t.Error("Expected error after lock, but got none")
+	}
+}
+
+func TestAgentIdleTimeout(t *testing.T) {
+	dir, cleanup := setupTestAgent(t, time.Second)
+	defer cleanup()
+
+	if err := agent.PutKey(dir, bytes.Repeat([]byte{0x01}, 32)); err != nil {
+		t.Fatalf("PutKey failed: %v", err)
+	}
+	status, err := agent.Status(dir)
+	if err != nil || !status.Unlocked {
+		t.Fatalf("Expected unlocked agent, got %+v (%v)", status, err)
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := agent.GetKey(dir); err == nil {
+		t.Error("Expected key to expire after the idle timeout")
+	}
+}
+
+func TestAgentShutdown(t *testing.T) {
+	dir, cleanup := setupTestAgent(t, 0)
+	defer cleanup()
+
+	if err := agent.Shutdown(dir); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if agent.IsRunning(dir) {
+		t.Error("Expected agent to be stopped")
+	}
+	if _, err := os.Stat(agent.SocketPath(dir)); !os.IsNotExist(err) {
+		t.Error("Expected socket to be removed on shutdown")
+	}
+}
+
+func TestConfigUsesAgentKey(t *testing.T) {
+	dir, cleanup := setupTestAgent(t, 0)
+	defer cleanup()
+
+	key := bytes.Repeat([]byte{0x7f}, 32)
+	if err := agent.PutKey(dir, key); err != nil {
+		t.Fatalf("PutKey failed: %v", err)
+	}
+
+	// GetMasterKey must not prompt when the agent holds the key
+	cfg := config.DefaultConfig(dir)
+	got, err := cfg.GetMasterKey()
+	if err != nil {
+		t.Fatalf("GetMasterKey failed: %v", err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Errorf("Expected agent key %x, got %x", key, got)
+	}
+}
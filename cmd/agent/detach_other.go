@@ -0,0 +1,8 @@
+//go:build !unix
+
+package agent
+
+import "os/exec"
+
+// detach is a no-op where processes have no sessions
+func detach(child *exec.Cmd) {}
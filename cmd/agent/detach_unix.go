@@ -0,0 +1,14 @@
+//go:build unix
+
+package agent
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach starts the child in a session of its own, so it has no controlling
+// terminal and outlives the terminal that started it
+func detach(child *exec.Cmd) {
+	child.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
@@ -2,13 +2,20 @@ package aws
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os/user"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/mbeniwal-imwe/ark/internal/core/config"
 	awsfeat "github.com/mbeniwal-imwe/ark/internal/features/aws"
-	"github.com/mbeniwal-imwe/ark/internal/storage"
 	"github.com/spf13/cobra"
 )
 
@@ -30,14 +37,17 @@ var importCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		db, err := storage.NewDatabase(cfg.DatabasePath, masterKey)
+		db, err := cfg.OpenDatabase(masterKey)
 		if err != nil {
 			return err
 		}
 		defer db.Close()
 		svc := awsfeat.Service{DB: db}
-		u, _ := user.Current()
-		n, err := svc.ImportFromAWSDir(u.HomeDir)
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		n, err := svc.ImportFromAWSDir(home)
 		if err != nil {
 			return err
 		}
@@ -59,7 +69,7 @@ var profilesCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		db, err := storage.NewDatabase(cfg.DatabasePath, masterKey)
+		db, err := cfg.OpenDatabaseReadOnly(masterKey)
 		if err != nil {
 			return err
 		}
@@ -99,7 +109,7 @@ var selectCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		db, err := storage.NewDatabase(cfg.DatabasePath, masterKey)
+		db, err := cfg.OpenDatabase(masterKey)
 		if err != nil {
 			return err
 		}
@@ -132,7 +142,7 @@ var testCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		db, err := storage.NewDatabase(cfg.DatabasePath, masterKey)
+		db, err := cfg.OpenDatabase(masterKey)
 		if err != nil {
 			return err
 		}
@@ -168,12 +178,273 @@ var prereqCmd = &cobra.Command{
 	},
 }
 
+var credentialProcessCmd = &cobra.Command{
+	Use:   "credential-process <profile>",
+	Short: "Print stored credentials in the AWS credential_process format",
+	Long: `Print the credentials of a stored profile as the JSON document expected
+from an AWS credential_process command, so the AWS CLI, SDKs and Terraform
+can use profiles kept in Ark without plaintext keys in ~/.aws/credentials.
+
+Run 'ark aws wire' to configure ~/.aws/config to call this command.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfgDir := cmd.Root().PersistentFlags().Lookup("config-dir").Value.String()
+		cfg, err := config.Load(cfgDir)
+		if err != nil {
+			return err
+		}
+		masterKey, err := cfg.GetMasterKey()
+		if err != nil {
+			return err
+		}
+		db, err := cfg.OpenDatabaseReadOnly(masterKey)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		svc := awsfeat.Service{DB: db}
+		out, err := svc.CredentialProcess(args[0])
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(cmd.OutOrStdout()).Encode(out)
+	},
+}
+
+var removePlaintext bool
+
+var wireCmd = &cobra.Command{
+	Use:   "wire [profile...]",
+	Short: "Point ~/.aws/config profiles at ark credential-process",
+	Long: `Write credential_process stanzas into ~/.aws/config for stored profiles
+(all of them when none are given). Static keys in ~/.aws/credentials take
+precedence over credential_process, so pass --remove-plaintext to strip them
+(a copy is kept in ~/.aws/credentials.ark-backup).`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfgDir := cmd.Root().PersistentFlags().Lookup("config-dir").Value.String()
+		cfg, err := config.Load(cfgDir)
+		if err != nil {
+			return err
+		}
+		masterKey, err := cfg.GetMasterKey()
+		if err != nil {
+			return err
+		}
+		db, err := cfg.OpenDatabase(masterKey)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		svc := awsfeat.Service{DB: db}
+
+		names := args
+		if len(names) == 0 {
+			list, err := svc.ListProfiles()
+			if err != nil {
+				return err
+			}
+			for _, p := range list {
+				names = append(names, p.Name)
+			}
+		} else {
+			for _, name := range names {
+				if _, err := svc.GetProfile(name); err != nil {
+					return err
+				}
+			}
+		}
+		if len(names) == 0 {
+			fmt.Println("No profiles found. Use 'ark aws import'.")
+			return nil
+		}
+
+		command, err := arkInvocation(cmd)
+		if err != nil {
+			return err
+		}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		n, err := awsfeat.WireCredentialProcess(home, names, awsfeat.WireOptions{
+			Command:         command,
+			RemovePlaintext: removePlaintext,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✅ Wired %d profile(s) to ark credential-process in ~/.aws/config\n", n)
+		if !removePlaintext {
+			fmt.Println("Static keys in ~/.aws/credentials still take precedence; rerun with --remove-plaintext to drop them.")
+		}
+		return nil
+	},
+}
+
+var (
+	serveProfile   string
+	serveAddr      string
+	serveSession   bool
+	serveDuration  time.Duration
+	serveAuthToken string
+)
+
+var serveCredentialsCmd = &cobra.Command{
+	Use:   "serve-credentials",
+	Short: "Serve a stored profile over local metadata credential endpoints",
+	Long: `Run a local HTTP server emulating the EC2 instance metadata service (IMDSv2)
+and the ECS container credential endpoint, serving the credentials of a
+stored profile. With --session, short-lived credentials are obtained from STS
+GetSessionToken and renewed before they expire.
+
+Point the default SDK credential chain at it with either:
+  AWS_EC2_METADATA_SERVICE_ENDPOINT=http://<addr>
+or:
+  AWS_CONTAINER_CREDENTIALS_FULL_URI=http://<addr>/creds
+  AWS_CONTAINER_AUTHORIZATION_TOKEN=<token>
+
+The container endpoint only works on loopback: the SDKs refuse a plain http
+AWS_CONTAINER_CREDENTIALS_FULL_URI on any other host. To use it from a
+container, run the container with host networking (docker run --network host)
+so that 127.0.0.1 reaches the server.
+
+The EC2 metadata endpoint works on any address, but it has no authentication:
+with a non-loopback --addr, anything that can reach the port can read the
+credentials. Only listen on an address limited to machines you trust, such as
+a Docker bridge address, never on 0.0.0.0 of a shared network.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfgDir := cmd.Root().PersistentFlags().Lookup("config-dir").Value.String()
+		cfg, err := config.Load(cfgDir)
+		if err != nil {
+			return err
+		}
+		masterKey, err := cfg.GetMasterKey()
+		if err != nil {
+			return err
+		}
+		db, err := cfg.OpenDatabase(masterKey)
+		if err != nil {
+			return err
+		}
+		svc := awsfeat.Service{DB: db}
+		name := serveProfile
+		if name == "" {
+			name, _ = svc.GetDefaultProfile()
+		}
+		if name == "" {
+			db.Close()
+			return fmt.Errorf("no profile specified or default set")
+		}
+		prof, err := svc.GetProfile(name)
+		if err != nil {
+			db.Close()
+			return err
+		}
+
+		source := awsfeat.ProfileSource(prof)
+		if serveSession {
+			client, err := awsfeat.NewClient(context.Background(), db, name)
+			if err != nil {
+				db.Close()
+				return err
+			}
+			source = awsfeat.SessionSource(client, serveDuration)
+		}
+		// Everything needed is in memory; release the database for other commands
+		db.Close()
+
+		token := serveAuthToken
+		if token == "" {
+			if token, err = awsfeat.NewAuthToken(); err != nil {
+				return err
+			}
+		}
+		server := &awsfeat.CredentialServer{
+			Source:    source,
+			RoleName:  "ark-" + name,
+			Region:    prof.Region,
+			AuthToken: token,
+		}
+
+		listener, err := net.Listen("tcp", serveAddr)
+		if err != nil {
+			return err
+		}
+		addr := listener.Addr().String()
+		host, _, _ := net.SplitHostPort(addr)
+		loopback := net.ParseIP(host).IsLoopback()
+		if !loopback {
+			fmt.Fprintf(os.Stderr, "⚠️  Listening on %s: any host that can reach this port can read the credentials\n", addr)
+		}
+		fmt.Printf("Serving credentials for profile %s on http://%s\n", name, addr)
+		fmt.Printf("  AWS_EC2_METADATA_SERVICE_ENDPOINT=http://%s\n", addr)
+		// The SDKs only accept a plain http container endpoint on loopback
+		if loopback {
+			fmt.Printf("  AWS_CONTAINER_CREDENTIALS_FULL_URI=http://%s/creds\n", addr)
+			fmt.Printf("  AWS_CONTAINER_AUTHORIZATION_TOKEN=%s\n", token)
+		}
+
+		httpServer := &http.Server{Handler: server.Handler(), ReadHeaderTimeout: 10 * time.Second}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			httpServer.Shutdown(shutdownCtx)
+		}()
+
+		if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		fmt.Println("🛑 Credential server stopped")
+		return nil
+	},
+}
+
 func init() {
 	Cmd.AddCommand(importCmd)
 	Cmd.AddCommand(profilesCmd)
 	Cmd.AddCommand(selectCmd)
 	Cmd.AddCommand(testCmd)
 	Cmd.AddCommand(prereqCmd)
+	Cmd.AddCommand(credentialProcessCmd)
+	Cmd.AddCommand(wireCmd)
+	Cmd.AddCommand(serveCredentialsCmd)
+
+	wireCmd.Flags().BoolVar(&removePlaintext, "remove-plaintext", false, "Remove static keys for wired profiles from ~/.aws/credentials")
+
+	serveCredentialsCmd.Flags().StringVarP(&serveProfile, "profile", "p", "", "AWS profile to serve (default profile if omitted)")
+	serveCredentialsCmd.Flags().StringVar(&serveAddr, "addr", "127.0.0.1:9911", "Address to listen on")
+	serveCredentialsCmd.Flags().BoolVar(&serveSession, "session", false, "Serve short-lived STS session credentials instead of the stored keys")
+	serveCredentialsCmd.Flags().DurationVar(&serveDuration, "duration", time.Hour, "Lifetime of STS session credentials")
+	serveCredentialsCmd.Flags().StringVar(&serveAuthToken, "auth-token", "", "Authorization token for the container endpoint (random if omitted)")
+}
+
+// arkInvocation returns the command line that re-invokes this ark binary,
+// carrying over a non-default config directory and keyfile
+func arkInvocation(cmd *cobra.Command) (string, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	invocation := awsfeat.ShellQuote(self)
+	if flag := cmd.Root().PersistentFlags().Lookup("config-dir"); flag != nil && flag.Changed {
+		configDir, err := filepath.Abs(flag.Value.String())
+		if err != nil {
+			return "", err
+		}
+		invocation += " --config-dir " + awsfeat.ShellQuote(configDir)
+	}
+	if flag := cmd.Root().PersistentFlags().Lookup("keyfile"); flag != nil && flag.Changed {
+		keyfile, err := filepath.Abs(flag.Value.String())
+		if err != nil {
+			return "", err
+		}
+		invocation += " --keyfile " + awsfeat.ShellQuote(keyfile)
+	}
+	return invocation, nil
 }
 
 func maskKey(k string) string {
@@ -0,0 +1,278 @@
+package aws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/endpointcreds"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+	awsfeat "github.com/mbeniwal-imwe/ark/internal/features/aws"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+	"github.com/mbeniwal-imwe/ark/internal/storage/models"
+	"github.com/spf13/cobra"
+)
+
+// setupTestAWSService creates an AWS service over a temporary database
+func setupTestAWSService(t *testing.T) (*awsfeat.Service, func()) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "ark-aws-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	salt, _ := crypto.GenerateSalt()
+	masterKey, err := crypto.DeriveKey("TestPassword123!", salt)
+	if err != nil {
+		t.Fatalf("Failed to derive master key: %v", err)
+	}
+
+	db, err := storage.NewDatabase(filepath.Join(dir, "ark.db"), masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	cleanup := func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+	return &awsfeat.Service{DB: db}, cleanup
+}
+
+func TestCredentialProcess(t *testing.T) {
+	svc, cleanup := setupTestAWSService(t)
+	defer cleanup()
+
+	prof := models.NewAWSProfile("dev", "AKIAEXAMPLE", "secret", "eu-west-1")
+	if err := svc.DB.Set("aws_profiles", "dev", prof); err != nil {
+		t.Fatalf("Failed to store profile: %v", err)
+	}
+
+	out, err := svc.CredentialProcess("dev")
+	if err != nil {
+		t.Fatalf("CredentialProcess failed: %v", err)
+	}
+	if out.Version != 1 || out.AccessKeyID != "AKIAEXAMPLE" || out.SecretAccessKey != "secret" {
+		t.Errorf("Unexpected output: %+v", out)
+	}
+	if out.Expiration != "" {
+		t.Errorf("Expected no expiration for long-term keys, got %s", out.Expiration)
+	}
+}
+
+func TestCredentialProcessExpired(t *testing.T) {
+	svc, cleanup := setupTestAWSService(t)
+	defer cleanup()
+
+	prof := models.NewAWSProfile("session", "ASIAEXAMPLE", "secret", "us-east-1")
+	prof.SetSessionToken("token")
+	prof.SetMetadata(awsfeat.MetadataExpiration, time.Now().Add(-time.Hour).Format(time.RFC3339))
+	if err := svc.DB.Set("aws_profiles", "session", prof); err != nil {
+		t.Fatalf("Failed to store profile: %v", err)
+	}
+
+	if _, err := svc.CredentialProcess("session"); err == nil {
+		t.Error("Expected error for expired credentials, but got none")
+	}
+	if _, err := svc.CredentialProcess("missing"); err == nil {
+		t.Error("Expected error for unknown profile, but got none")
+	}
+}
+
+func TestProfileSourceExpired(t *testing.T) {
+	prof := models.NewAWSProfile("session", "ASIAEXAMPLE", "secret", "us-east-1")
+	prof.SetSessionToken("token")
+	prof.SetMetadata(awsfeat.MetadataExpiration, time.Now().Add(-time.Hour).Format(time.RFC3339))
+
+	if _, err := awsfeat.ProfileSource(prof)(context.Background()); err == nil {
+		t.Error("Expected error for expired credentials, but got none")
+	}
+}
+
+func TestWireCredentialProcess(t *testing.T) {
+	home, err := os.MkdirTemp("", "ark-aws-home-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(home)
+
+	awsDir := filepath.Join(home, ".aws")
+	os.MkdirAll(awsDir, 0700)
+	os.WriteFile(filepath.Join(awsDir, "config"), []byte("[default]\nregion = us-east-1\n\n[profile dev]\nregion = eu-west-1\noutput = json\n"), 0600)
+	os.WriteFile(filepath.Join(awsDir, "credentials"), []byte("[default]\naws_access_key_id = AKIA1\naws_secret_access_key = s1\n\n[dev]\naws_access_key_id = AKIA2\naws_secret_access_key = s2\nmfa_serial = arn:aws:iam::1:mfa/dev\n"), 0600)
+
+	n, err := awsfeat.WireCredentialProcess(home, []string{"default", "dev", "ci"}, awsfeat.WireOptions{
+		Command:         "/usr/local/bin/ark",
+		RemovePlaintext: true,
+	})
+	if err != nil {
+		t.Fatalf("WireCredentialProcess failed: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("Expected 3 profiles wired, got %d", n)
+	}
+
+	configData, _ := os.ReadFile(filepath.Join(awsDir, "config"))
+	config := string(configData)
+	for _, want := range []string{
+		"[default]\nregion = us-east-1\ncredential_process = /usr/local/bin/ark aws credential-process default\n",
+		"output = json\ncredential_process = /usr/local/bin/ark aws credential-process dev\n",
+		"[profile ci]\ncredential_process = /usr/local/bin/ark aws credential-process ci\n",
+	} {
+		if !strings.Contains(config, want) {
+			t.Errorf("Expected config to contain %q, got:\n%s", want, config)
+		}
+	}
+
+	// Wiring again replaces rather than duplicates the stanza
+	awsfeat.WireCredentialProcess(home, []string{"dev"}, awsfeat.WireOptions{Command: "ark"})
+	configData, _ = os.ReadFile(filepath.Join(awsDir, "config"))
+	if strings.Count(string(configData), "credential-process dev") != 1 {
+		t.Errorf("Expected a single dev stanza, got:\n%s", configData)
+	}
+
+	credsData, _ := os.ReadFile(filepath.Join(awsDir, "credentials"))
+	creds := string(credsData)
+	if strings.Contains(creds, "aws_access_key_id") || strings.Contains(creds, "[default]") {
+		t.Errorf("Expected static keys to be removed, got:\n%s", creds)
+	}
+	if !strings.Contains(creds, "[dev]\nmfa_serial") {
+		t.Errorf("Expected unrelated settings to be preserved, got:\n%s", creds)
+	}
+	if _, err := os.Stat(filepath.Join(awsDir, "credentials.ark-backup")); err != nil {
+		t.Errorf("Expected credentials backup to exist: %v", err)
+	}
+}
+
+func TestWireCredentialProcessQuotesNames(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("credential_process runs through cmd.exe on Windows")
+	}
+	home := t.TempDir()
+
+	names := []string{"team dev", "x;touch pwned", "it's $(id)"}
+	if _, err := awsfeat.WireCredentialProcess(home, names, awsfeat.WireOptions{Command: "ark"}); err != nil {
+		t.Fatalf("WireCredentialProcess failed: %v", err)
+	}
+	configData, _ := os.ReadFile(filepath.Join(home, ".aws", "config"))
+	if !strings.Contains(string(configData), "credential_process = ark aws credential-process 'team dev'\n") {
+		t.Errorf("Expected profile name to be quoted, got:\n%s", configData)
+	}
+
+	// The shell sees each name as one literal argument
+	for _, name := range names {
+		out, err := exec.Command("sh", "-c", "printf %s "+awsfeat.ShellQuote(name)).Output()
+		if err != nil || string(out) != name {
+			t.Errorf("Expected %q to survive the shell, got %q (%v)", name, out, err)
+		}
+	}
+
+	if _, err := awsfeat.WireCredentialProcess(home, []string{"bad\nname"}, awsfeat.WireOptions{Command: "ark"}); err == nil {
+		t.Error("Expected a profile name with a newline to be rejected")
+	}
+}
+
+func TestArkInvocationResolvesRelativePaths(t *testing.T) {
+	root := &cobra.Command{Use: "ark"}
+	root.PersistentFlags().String("config-dir", "", "")
+	root.PersistentFlags().String("keyfile", "", "")
+	child := &cobra.Command{Use: "wire"}
+	root.AddCommand(child)
+	root.PersistentFlags().Set("config-dir", "./x")
+	root.PersistentFlags().Set("keyfile", "key.bin")
+
+	invocation, err := arkInvocation(child)
+	if err != nil {
+		t.Fatalf("arkInvocation failed: %v", err)
+	}
+	configDir, _ := filepath.Abs("x")
+	keyfile, _ := filepath.Abs("key.bin")
+	if !strings.Contains(invocation, " --config-dir "+awsfeat.ShellQuote(configDir)) {
+		t.Errorf("Expected an absolute config dir, got %s", invocation)
+	}
+	if !strings.Contains(invocation, " --keyfile "+awsfeat.ShellQuote(keyfile)) {
+		t.Errorf("Expected an absolute keyfile, got %s", invocation)
+	}
+}
+
+func TestCredentialServerWithSDK(t *testing.T) {
+	prof := models.NewAWSProfile("dev", "AKIAEXAMPLE", "secret", "eu-west-1")
+	server := &awsfeat.CredentialServer{
+		Source:    awsfeat.ProfileSource(prof),
+		RoleName:  "ark-dev",
+		Region:    prof.Region,
+		AuthToken: "test-token",
+	}
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	ctx := context.Background()
+
+	// ECS container endpoint
+	containerProvider := endpointcreds.New(ts.URL+"/creds", func(o *endpointcreds.Options) {
+		o.AuthorizationToken = "test-token"
+	})
+	creds, err := containerProvider.Retrieve(ctx)
+	if err != nil {
+		t.Fatalf("Container endpoint retrieve failed: %v", err)
+	}
+	if creds.AccessKeyID != "AKIAEXAMPLE" || creds.SecretAccessKey != "secret" || !creds.CanExpire {
+		t.Errorf("Unexpected container credentials: %+v", creds)
+	}
+
+	// The container endpoint rejects a wrong token
+	badProvider := endpointcreds.New(ts.URL+"/creds", func(o *endpointcreds.Options) {
+		o.AuthorizationToken = "wrong"
+	})
+	if _, err := badProvider.Retrieve(ctx); err == nil {
+		t.Error("Expected container endpoint to reject a wrong token")
+	}
+
+	// EC2 instance metadata endpoint (IMDSv2)
+	imdsClient := imds.New(imds.Options{Endpoint: ts.URL})
+	roleProvider := ec2rolecreds.New(func(o *ec2rolecreds.Options) {
+		o.Client = imdsClient
+	})
+	creds, err = roleProvider.Retrieve(ctx)
+	if err != nil {
+		t.Fatalf("IMDS retrieve failed: %v", err)
+	}
+	if creds.AccessKeyID != "AKIAEXAMPLE" || creds.SecretAccessKey != "secret" {
+		t.Errorf("Unexpected IMDS credentials: %+v", creds)
+	}
+
+	region, err := imdsClient.GetRegion(ctx, &imds.GetRegionInput{})
+	if err != nil {
+		t.Fatalf("IMDS region failed: %v", err)
+	}
+	if region.Region != "eu-west-1" {
+		t.Errorf("Expected region 'eu-west-1', got '%s'", region.Region)
+	}
+}
+
+func TestCredentialServerRequiresIMDSToken(t *testing.T) {
+	server := &awsfeat.CredentialServer{
+		Source:   awsfeat.ProfileSource(models.NewAWSProfile("dev", "AKIAEXAMPLE", "secret", "eu-west-1")),
+		RoleName: "ark-dev",
+	}
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/latest/meta-data/iam/security-credentials/ark-dev")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without an IMDSv2 token, got %d", resp.StatusCode)
+	}
+}
@@ -1,16 +1,15 @@
 package backup
 
 import (
+	"bufio"
 	"context"
 	"encoding/hex"
 	"fmt"
-	"os"
-	"path/filepath"
+	"io"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/mbeniwal-imwe/ark/internal/core/config"
 	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
 	awsfeat "github.com/mbeniwal-imwe/ark/internal/features/aws"
@@ -67,26 +66,15 @@ var createCmd = &cobra.Command{
 		if cfg.Backup.S3Bucket == "" {
 			return fmt.Errorf("backup not configured. Run 'ark backup configure <bucket> [prefix]'")
 		}
-		db, err := storage.NewDatabase(cfg.DatabasePath, cfg.MasterKey)
+		masterKey, err := cfg.GetMasterKey()
 		if err != nil {
 			return err
 		}
-		defer db.Close()
-
-		// Create DB backup bytes
-		data, err := db.Backup()
-		if err != nil {
-			return err
-		}
-		// Encrypt client-side using master key
-		enc, err := crypto.NewEncryptor(cfg.MasterKey)
-		if err != nil {
-			return err
-		}
-		blob, err := enc.Encrypt(data)
+		db, err := cfg.OpenDatabaseReadOnly(masterKey)
 		if err != nil {
 			return err
 		}
+		defer db.Close()
 
 		// Build S3 client
 		prof := profileName
@@ -102,16 +90,17 @@ var createCmd = &cobra.Command{
 			return err
 		}
 
-		// Upload with timestamp name
-		key := fmt.Sprintf("%sark-backup-%s.bin", ensureSlash(cfg.Backup.S3Prefix), time.Now().UTC().Format("20060102-150405"))
-		_, err = s3svc.S3.PutObject(context.Background(), &s3.PutObjectInput{
-			Bucket: aws.String(cfg.Backup.S3Bucket),
-			Key:    aws.String(key),
-			Body:   strings.NewReader(hex.EncodeToString(blob)),
-		})
+		// Stream the database through client-side encryption with the backup
+		// key, which outlives master password changes
+		backupKey, err := db.BackupKey()
 		if err != nil {
 			return err
 		}
+		defer crypto.Wipe(backupKey)
+		key := fmt.Sprintf("%sark-backup-%s.bin", ensureSlash(cfg.Backup.S3Prefix), time.Now().UTC().Format("20060102-150405"))
+		if err := s3svc.UploadEncrypted(context.Background(), cfg.Backup.S3Bucket, key, backupKey, db.Cipher(), db.WriteBackup); err != nil {
+			return err
+		}
 		fmt.Printf("✅ Backup uploaded to s3://%s/%s\n", cfg.Backup.S3Bucket, key)
 		return nil
 	},
@@ -130,7 +119,11 @@ var listCmd = &cobra.Command{
 			return fmt.Errorf("backup not configured")
 		}
 		// Build S3 client
-		db, err := storage.NewDatabase(cfg.DatabasePath, cfg.MasterKey)
+		masterKey, err := cfg.GetMasterKey()
+		if err != nil {
+			return err
+		}
+		db, err := cfg.OpenDatabase(masterKey)
 		if err != nil {
 			return err
 		}
@@ -173,7 +166,11 @@ var restoreCmd = &cobra.Command{
 		if cfg.Backup.S3Bucket == "" {
 			return fmt.Errorf("backup not configured")
 		}
-		db, err := storage.NewDatabase(cfg.DatabasePath, cfg.MasterKey)
+		masterKey, err := cfg.GetMasterKey()
+		if err != nil {
+			return err
+		}
+		db, err := cfg.OpenDatabase(masterKey)
 		if err != nil {
 			return err
 		}
@@ -187,29 +184,12 @@ var restoreCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		// Download
-		tmp := filepath.Join(cfg.ConfigDir, "backup", "restore.tmp")
-		if err := s3svc.DownloadFile(context.Background(), cfg.Backup.S3Bucket, key, tmp); err != nil {
-			return err
-		}
-		// Decode hex and decrypt
-		hexData, err := os.ReadFile(tmp)
-		if err != nil {
-			return err
-		}
-		blob, err := hex.DecodeString(string(hexData))
+		body, err := s3svc.OpenObject(context.Background(), cfg.Backup.S3Bucket, key)
 		if err != nil {
 			return err
 		}
-		enc, err := crypto.NewEncryptor(cfg.MasterKey)
-		if err != nil {
-			return err
-		}
-		plain, err := enc.Decrypt(blob)
-		if err != nil {
-			return err
-		}
-		if err := db.Restore(plain); err != nil {
+		defer body.Close()
+		if err := restoreBackup(db, body, masterKey); err != nil {
 			return err
 		}
 		fmt.Println("✅ Restore complete")
@@ -227,6 +207,55 @@ func init() {
 	}
 }
 
+// restoreBackup decrypts a backup and restores the database from it. Backups
+// are encrypted with the database's backup key; older ones with the master
+// key of the time, which is either the current one or one the database has
+// retired since. Backups made before streaming encryption are a hex-encoded
+// AES-GCM blob.
+func restoreBackup(db *storage.Database, r io.Reader, masterKey []byte) error {
+	keys, err := db.BackupKeys()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, key := range keys {
+			crypto.Wipe(key)
+		}
+	}()
+	candidates := append([][]byte{masterKey}, keys...)
+
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(crypto.StreamMagic) + 1)
+	if crypto.IsStream(magic) {
+		sr, err := crypto.NewStreamReaderAnyKey(br, candidates)
+		if err != nil {
+			return err
+		}
+		return db.RestoreFrom(sr, masterKey)
+	}
+
+	hexData, err := io.ReadAll(br)
+	if err != nil {
+		return err
+	}
+	blob, err := hex.DecodeString(strings.TrimSpace(string(hexData)))
+	if err != nil {
+		return fmt.Errorf("unrecognised backup format: %w", err)
+	}
+	for _, key := range candidates {
+		enc, err := crypto.NewEncryptor(key)
+		if err != nil {
+			return err
+		}
+		plain, err := enc.Decrypt(blob)
+		enc.Close()
+		if err == nil {
+			return db.Restore(plain, masterKey)
+		}
+	}
+	return crypto.ErrStreamKey
+}
+
 func ensureSlash(p string) string {
 	if p == "" {
 		return p
@@ -0,0 +1,362 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/config"
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+	"go.etcd.io/bbolt"
+)
+
+// setupTestBackupDatabase creates a database holding one vault entry
+func setupTestBackupDatabase(t *testing.T) (*storage.Database, []byte, func()) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "ark-backup-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	salt, _ := crypto.GenerateSalt()
+	masterKey, err := crypto.DeriveKey("TestPassword123!", salt)
+	if err != nil {
+		t.Fatalf("Failed to derive master key: %v", err)
+	}
+
+	db, err := storage.NewDatabase(filepath.Join(dir, "ark.db"), masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if err := db.Set("vault", "api-key", "original"); err != nil {
+		t.Fatalf("Failed to store record: %v", err)
+	}
+
+	return db, masterKey, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// encryptedBackup returns a streamed, encrypted backup of db
+func encryptedBackup(t *testing.T, db *storage.Database, key []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	sw, err := crypto.NewStreamWriter(&buf, key)
+	if err != nil {
+		t.Fatalf("NewStreamWriter failed: %v", err)
+	}
+	if err := db.WriteBackup(sw); err != nil {
+		t.Fatalf("WriteBackup failed: %v", err)
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// encryptStream encrypts plaintext as a stream
+func encryptStream(t *testing.T, plaintext, key []byte) []byte {
+	t.Helper()
+	return encryptStreamWithCipher(t, plaintext, key, crypto.DefaultCipher)
+}
+
+// encryptStreamWithCipher encrypts plaintext as a stream with the given suite
+func encryptStreamWithCipher(t *testing.T, plaintext, key []byte, suiteID byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	sw, err := crypto.NewStreamWriterWithCipher(&buf, key, suiteID)
+	if err != nil {
+		t.Fatalf("NewStreamWriter failed: %v", err)
+	}
+	sw.Write(plaintext)
+	if err := sw.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// decryptStream decrypts a whole stream
+func decryptStream(stream, key []byte) ([]byte, error) {
+	sr, err := crypto.NewStreamReader(bytes.NewReader(stream), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(sr)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	key, _ := crypto.GenerateSalt()
+	for _, suiteID := range []byte{crypto.CipherAESGCM, crypto.CipherXChaCha20} {
+		for _, size := range []int{0, 1, crypto.DefaultStreamChunkSize, 2*crypto.DefaultStreamChunkSize + 7} {
+			plaintext := bytes.Repeat([]byte{0xa5}, size)
+			stream := encryptStreamWithCipher(t, plaintext, key, suiteID)
+			want, _ := crypto.StreamSize(suiteID, int64(size))
+			if int64(len(stream)) != want {
+				t.Errorf("Cipher %d, size %d: expected stream of %d bytes, got %d", suiteID, size, want, len(stream))
+			}
+			got, err := decryptStream(stream, key)
+			if err != nil || !bytes.Equal(got, plaintext) {
+				t.Errorf("Cipher %d, size %d: round trip failed (%v)", suiteID, size, err)
+			}
+		}
+	}
+}
+
+func TestStreamRejectsTamperingTruncationAndReordering(t *testing.T) {
+	key, _ := crypto.GenerateSalt()
+	plaintext := bytes.Repeat([]byte("0123456789abcdef"), crypto.DefaultStreamChunkSize/16*3)
+	stream := encryptStream(t, plaintext, key)
+
+	chunk := crypto.DefaultStreamChunkSize + 16
+	empty, _ := crypto.StreamSize(crypto.DefaultCipher, 0)
+	header := int(empty) - 16
+
+	// Dropping the last chunk leaves a valid prefix that must not pass as complete
+	if _, err := decryptStream(stream[:header+2*chunk], key); !errors.Is(err, crypto.ErrStreamTruncated) {
+		t.Errorf("Expected ErrStreamTruncated, got %v", err)
+	}
+	if _, err := decryptStream(stream[:header], key); !errors.Is(err, crypto.ErrStreamTruncated) {
+		t.Errorf("Expected ErrStreamTruncated for a bare header, got %v", err)
+	}
+
+	// Swapping two chunks
+	swapped := append([]byte(nil), stream...)
+	copy(swapped[header:], stream[header+chunk:header+2*chunk])
+	copy(swapped[header+chunk:], stream[header:header+chunk])
+	if _, err := decryptStream(swapped, key); err == nil {
+		t.Error("Expected reordered chunks to be rejected")
+	}
+
+	// Flipping a bit in the body
+	flipped := append([]byte(nil), stream...)
+	flipped[header+10] ^= 1
+	if _, err := decryptStream(flipped, key); err == nil {
+		t.Error("Expected modified chunk to be rejected")
+	}
+
+	// Wrong key
+	otherKey, _ := crypto.GenerateSalt()
+	if _, err := decryptStream(stream, otherKey); err == nil {
+		t.Error("Expected wrong key to be rejected")
+	}
+}
+
+func TestRestoreBackup(t *testing.T) {
+	db, masterKey, cleanup := setupTestBackupDatabase(t)
+	defer cleanup()
+
+	backup := encryptedBackup(t, db, masterKey)
+	db.Set("vault", "api-key", "changed")
+	if err := restoreBackup(db, bytes.NewReader(backup), masterKey); err != nil {
+		t.Fatalf("restoreBackup failed: %v", err)
+	}
+
+	var value string
+	if err := db.Get("vault", "api-key", &value); err != nil || value != "original" {
+		t.Errorf("Expected 'original' after restore, got %q (%v)", value, err)
+	}
+}
+
+// legacyDatabaseFile writes a database the way versions before key slots
+// did - records encrypted directly with the master key, no key slots or
+// metadata - and returns the file's contents
+func legacyDatabaseFile(t *testing.T, masterKey []byte, value string) []byte {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	enc, _ := crypto.NewEncryptor(masterKey)
+	raw, _ := json.Marshal(value)
+	ciphertext, _ := enc.Encrypt(raw)
+
+	bdb, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("Failed to create legacy database: %v", err)
+	}
+	bdb.Update(func(tx *bbolt.Tx) error {
+		for _, name := range []string{"vault", "aws_profiles", "ec2_instances", "locked_dirs", "backup_metadata", "config"} {
+			tx.CreateBucketIfNotExists([]byte(name))
+		}
+		return tx.Bucket([]byte("vault")).Put([]byte("api-key"), ciphertext)
+	})
+	bdb.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read legacy database: %v", err)
+	}
+	return data
+}
+
+func TestRestoreLegacyBackup(t *testing.T) {
+	db, masterKey, cleanup := setupTestBackupDatabase(t)
+	defer cleanup()
+
+	// Backups used to be the raw file, AES-GCM encrypted with the master key
+	// and hex encoded
+	enc, _ := crypto.NewEncryptor(masterKey)
+	blob, _ := enc.Encrypt(legacyDatabaseFile(t, masterKey, "legacy"))
+
+	if err := restoreBackup(db, bytes.NewReader([]byte(hex.EncodeToString(blob))), masterKey); err != nil {
+		t.Fatalf("restoreBackup failed: %v", err)
+	}
+
+	var value string
+	if err := db.Get("vault", "api-key", &value); err != nil || value != "legacy" {
+		t.Errorf("Expected 'legacy' after restore, got %q (%v)", value, err)
+	}
+	db.Set("vault", "new", "after restore")
+	db.Close()
+
+	// The restored file was moved to key slots and opens with the master key
+	reopened, err := storage.NewDatabase(db.Path(), masterKey)
+	if err != nil {
+		t.Fatalf("Failed to reopen restored database: %v", err)
+	}
+	defer reopened.Close()
+	if slots, _ := reopened.KeySlots(); len(slots) != 1 {
+		t.Errorf("Expected restored database to have a key slot, got %+v", slots)
+	}
+	if err := reopened.Get("vault", "new", &value); err != nil || value != "after restore" {
+		t.Errorf("Expected 'after restore', got %q (%v)", value, err)
+	}
+}
+
+func TestRestoreRejectsBackupOfAnotherKey(t *testing.T) {
+	db, masterKey, cleanup := setupTestBackupDatabase(t)
+	defer cleanup()
+
+	// A well-formed backup whose database the master key does not unlock
+	otherKey, _ := crypto.GenerateSalt()
+	stream := encryptStream(t, legacyDatabaseFile(t, otherKey, "other"), masterKey)
+
+	if err := restoreBackup(db, bytes.NewReader(stream), masterKey); !errors.Is(err, storage.ErrInvalidKey) {
+		t.Fatalf("Expected ErrInvalidKey, got %v", err)
+	}
+
+	// The database was not replaced and still reads
+	var value string
+	if err := db.Get("vault", "api-key", &value); err != nil || value != "original" {
+		t.Errorf("Expected database to be untouched, got %q (%v)", value, err)
+	}
+}
+
+func TestRestoreRejectsTruncatedBackup(t *testing.T) {
+	db, masterKey, cleanup := setupTestBackupDatabase(t)
+	defer cleanup()
+
+	backup := encryptedBackup(t, db, masterKey)
+	db.Set("vault", "api-key", "changed")
+
+	if err := restoreBackup(db, bytes.NewReader(backup[:len(backup)-1]), masterKey); err == nil {
+		t.Fatal("Expected truncated backup to be rejected")
+	}
+
+	// The database is left as it was
+	var value string
+	if err := db.Get("vault", "api-key", &value); err != nil || value != "changed" {
+		t.Errorf("Expected database to be untouched, got %q (%v)", value, err)
+	}
+}
+
+func TestRestoreAfterKDFUpgrade(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "data"), 0700)
+
+	// An installation from before parameters were recorded, so the first
+	// unlock moves the master key to a new salt and parameters
+	cfg := config.DefaultConfig(dir)
+	cfg.Salt, _ = crypto.GenerateSalt()
+	cfg.Security.KeyCache = config.KeyCacheNone
+	cfg.Save()
+	oldKey, _ := crypto.DeriveKey("TestPassword123!", cfg.Salt)
+	db, err := storage.NewDatabase(cfg.DatabasePath, oldKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Set("vault", "api-key", "original")
+	backupKey, err := db.BackupKey()
+	if err != nil {
+		t.Fatalf("BackupKey failed: %v", err)
+	}
+	backup := encryptedBackup(t, db, backupKey)
+	// Backups used to be encrypted with the master key itself
+	oldBackup := encryptedBackup(t, db, oldKey)
+	db.Close()
+
+	target := crypto.KDFParams{Version: crypto.KDFArgon2id, Time: 1, MemoryKiB: 8 * 1024, Threads: 1}
+	cfg.Security.KDFTarget = &target
+	newKey, err := cfg.Unlock([]byte("TestPassword123!"))
+	if err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	if bytes.Equal(newKey, oldKey) {
+		t.Fatal("Expected the KDF upgrade to change the master key")
+	}
+
+	db, err = cfg.OpenDatabase(newKey)
+	if err != nil {
+		t.Fatalf("Failed to open database with the upgraded key: %v", err)
+	}
+	for name, data := range map[string][]byte{"backup": backup, "pre-upgrade master key backup": oldBackup} {
+		db.Set("vault", "api-key", "changed")
+		if err := restoreBackup(db, bytes.NewReader(data), newKey); err != nil {
+			t.Fatalf("Restoring %s failed: %v", name, err)
+		}
+		var value string
+		if err := db.Get("vault", "api-key", &value); err != nil || value != "original" {
+			t.Errorf("Expected 'original' after restoring %s, got %q (%v)", name, value, err)
+		}
+	}
+	if key, _ := db.BackupKey(); !bytes.Equal(key, backupKey) {
+		t.Error("Expected restore to keep the backup key")
+	}
+	db.Close()
+
+	// The restored key slots were re-wrapped under the upgraded key
+	db, err = cfg.OpenDatabase(newKey)
+	if err != nil {
+		t.Fatalf("Failed to reopen restored database: %v", err)
+	}
+	db.Close()
+}
+
+func TestRestoreAfterRecovery(t *testing.T) {
+	db, masterKey, cleanup := setupTestBackupDatabase(t)
+	defer cleanup()
+
+	backupKey, _ := db.BackupKey()
+	backup := encryptedBackup(t, db, backupKey)
+
+	// A recovery restore puts a new master key in the password slot without
+	// knowing the old one
+	newKey, _ := crypto.GenerateSalt()
+	if err := db.SetPasswordSlot(newKey); err != nil {
+		t.Fatalf("SetPasswordSlot failed: %v", err)
+	}
+	db.Set("vault", "api-key", "changed")
+
+	// The backup's slots open with neither key, but it shares the data key
+	if err := restoreBackup(db, bytes.NewReader(backup), newKey); err != nil {
+		t.Fatalf("restoreBackup failed: %v", err)
+	}
+	var value string
+	if err := db.Get("vault", "api-key", &value); err != nil || value != "original" {
+		t.Errorf("Expected 'original' after restore, got %q (%v)", value, err)
+	}
+	db.Close()
+
+	reopened, err := storage.NewDatabase(db.Path(), newKey)
+	if err != nil {
+		t.Fatalf("Expected the new master key to open the restored database: %v", err)
+	}
+	reopened.Close()
+	if _, err := storage.NewDatabase(db.Path(), masterKey); !errors.Is(err, storage.ErrInvalidKey) {
+		t.Errorf("Expected the replaced master key to be rejected, got %v", err)
+	}
+}
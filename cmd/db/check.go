@@ -0,0 +1,104 @@
+package db
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+	"github.com/mbeniwal-imwe/ark/internal/storage/models"
+	"github.com/spf13/cobra"
+)
+
+var checkRepair bool
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Verify every record in the database",
+	Long: `Run bbolt's consistency check, then decrypt every record and unmarshal it
+into its model. Records that are readable but refer to something that no
+longer exists - locked directories whose path is gone, EC2 registrations for
+deleted profiles - are reported as orphaned.
+
+With --repair, bad and orphaned records are moved into the 'corrupt' bucket,
+still encrypted, instead of being skipped silently by other commands. Damage
+to the file structure cannot be repaired; restore a backup instead.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Only a repair has to keep other processes out
+		db, err := openDatabaseWith(cmd, storage.Options{ReadOnly: !checkRepair})
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return runCheck(db, checkRepair, cmd.OutOrStdout())
+	},
+}
+
+// checkOptions describes the records ark stores and when they are orphaned
+func checkOptions(db *storage.Database) storage.CheckOptions {
+	return storage.CheckOptions{
+		Models: map[string]func() interface{}{
+			"vault":         func() interface{} { return new(models.VaultEntry) },
+			"aws_profiles":  func() interface{} { return new(models.AWSProfile) },
+			"ec2_instances": func() interface{} { return new(models.EC2Instance) },
+			"locked_dirs":   func() interface{} { return new(models.LockedDirectory) },
+		},
+		Orphaned: func(bucket, key string, value interface{}) string {
+			switch rec := value.(type) {
+			case *models.LockedDirectory:
+				path := rec.Path
+				if path == "" {
+					path = key
+				}
+				if _, err := os.Lstat(path); os.IsNotExist(err) {
+					return fmt.Sprintf("directory %s no longer exists", path)
+				}
+			case *models.EC2Instance:
+				if rec.Profile == "" {
+					return ""
+				}
+				if ok, err := db.Exists("aws_profiles", rec.Profile); err == nil && !ok {
+					return fmt.Sprintf("AWS profile %s no longer exists", rec.Profile)
+				}
+			}
+			return ""
+		},
+	}
+}
+
+// runCheck checks the database and, with repair, quarantines what it finds
+func runCheck(db *storage.Database, repair bool, out io.Writer) error {
+	report, err := db.Check(checkOptions(db))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Checked %d records in %d buckets\n", report.Records, report.Buckets)
+	structural := 0
+	for _, p := range report.Problems {
+		if p.Kind == storage.ProblemStructure {
+			structural++
+			fmt.Fprintf(out, "❌ [%s] %s\n", p.Kind, p.Detail)
+			continue
+		}
+		fmt.Fprintf(out, "❌ [%s] %s/%s: %s\n", p.Kind, p.Bucket, p.Key, p.Detail)
+	}
+	if len(report.Problems) == 0 {
+		fmt.Fprintln(out, "✅ No problems found")
+		return nil
+	}
+
+	if !repair {
+		return fmt.Errorf("found %d problem(s) - run 'ark db check --repair' to quarantine bad records", len(report.Problems))
+	}
+
+	moved, err := db.Quarantine(report.Problems)
+	if err != nil {
+		return fmt.Errorf("failed to quarantine records: %w", err)
+	}
+	fmt.Fprintf(out, "✅ Moved %d record(s) to the '%s' bucket\n", moved, storage.QuarantineBucket)
+	if structural > 0 {
+		return fmt.Errorf("the database file is damaged (%d structural problem(s)) - restore it from a backup", structural)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+	"github.com/mbeniwal-imwe/ark/internal/storage/models"
+	"go.etcd.io/bbolt"
+)
+
+func TestCheckCleanDatabase(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestDBEnvironment(t)
+	defer cleanup()
+
+	db, err := storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	db.Set("vault", "github", models.NewVaultEntry("github", "token", "text"))
+	db.Set("locked_dirs", filepath.Dir(dbPath), models.NewLockedDirectory(filepath.Dir(dbPath), true, false))
+
+	var out bytes.Buffer
+	if err := runCheck(db, false, &out); err != nil {
+		t.Fatalf("Check failed: %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "No problems found") {
+		t.Errorf("Check output = %q", out.String())
+	}
+}
+
+func TestCheckRepairQuarantinesBadRecords(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestDBEnvironment(t)
+	defer cleanup()
+
+	db, err := storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Set("vault", "good", models.NewVaultEntry("good", "value", "text"))
+	db.Set("vault", "not-an-entry", "just a string")
+	db.Set("vault", "tampered", models.NewVaultEntry("tampered", "value", "text"))
+	db.Set("locked_dirs", "/nonexistent/ark-check", models.NewLockedDirectory("/nonexistent/ark-check", true, false))
+	instance := models.NewEC2Instance("web", "i-123", "t3.micro")
+	instance.Profile = "deleted-profile"
+	db.Set("ec2_instances", "web", instance)
+	db.Close()
+
+	// Flip a ciphertext byte behind ark's back
+	bdb, err := bbolt.Open(dbPath, 0600, nil)
+	if err != nil {
+		t.Fatalf("Failed to open bbolt: %v", err)
+	}
+	bdb.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("vault"))
+		v := append([]byte(nil), b.Get([]byte("tampered"))...)
+		v[len(v)-1] ^= 0xff
+		return b.Put([]byte("tampered"), v)
+	})
+	bdb.Close()
+
+	db, err = storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	var out bytes.Buffer
+	if err := runCheck(db, false, &out); err == nil {
+		t.Fatal("Check passed a damaged database")
+	}
+	for _, want := range []string{
+		"[invalid] vault/not-an-entry",
+		"[corrupt] vault/tampered",
+		"[orphaned] locked_dirs//nonexistent/ark-check",
+		"[orphaned] ec2_instances/web: AWS profile deleted-profile",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Check output missing %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "vault/good") {
+		t.Errorf("Check reported a good record:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := runCheck(db, true, &out); err != nil {
+		t.Fatalf("Repair failed: %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "Moved 4 record(s)") {
+		t.Errorf("Repair output = %q", out.String())
+	}
+
+	// The bad records are kept, and the database now checks clean
+	var rec storage.QuarantinedRecord
+	if err := db.Get(storage.QuarantineBucket, "vault/tampered", &rec); err != nil || rec.Kind != storage.ProblemCorrupt {
+		t.Errorf("Quarantined record = %+v, %v", rec, err)
+	}
+	if ok, _ := db.Exists("vault", "tampered"); ok {
+		t.Error("Tampered record is still in the vault")
+	}
+	var entry models.VaultEntry
+	if err := db.Get("vault", "good", &entry); err != nil {
+		t.Errorf("Good record lost: %v", err)
+	}
+
+	out.Reset()
+	if err := runCheck(db, false, &out); err != nil {
+		t.Errorf("Check after repair failed: %v\n%s", err, out.String())
+	}
+}
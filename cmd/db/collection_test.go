@@ -0,0 +1,171 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+)
+
+type testRecord struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+// testCollection returns a collection over backup_metadata indexed by tag
+func testCollection(db storage.Store) *storage.Collection[testRecord] {
+	return storage.NewCollection(db, "backup_metadata", storage.Index[testRecord]{
+		Name:   "tag",
+		Values: func(r *testRecord) []string { return r.Tags },
+	})
+}
+
+// scanKeys returns the keys of the items q selects
+func scanKeys(t *testing.T, c *storage.Collection[testRecord], q storage.Query) []string {
+	t.Helper()
+	page, err := c.Scan(q)
+	if err != nil {
+		t.Fatalf("Scan(%+v) failed: %v", q, err)
+	}
+	keys := []string{}
+	for _, item := range page.Items {
+		keys = append(keys, item.Key)
+	}
+	return keys
+}
+
+func TestCollectionIndexes(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestDBEnvironment(t)
+	defer cleanup()
+
+	db, err := storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	records := testCollection(db)
+	for key, tags := range map[string][]string{
+		"app/api":    {"prod", "web"},
+		"app/db":     {"prod", "sql"},
+		"app/worker": {"staging"},
+		"ci/token":   {"ci"},
+		"notes":      nil,
+	} {
+		if err := records.Put(key, &testRecord{Name: key, Tags: tags}); err != nil {
+			t.Fatalf("Put %s failed: %v", key, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		q    storage.Query
+		want []string
+	}{
+		{"tag", storage.Query{Index: "tag", Value: "prod"}, []string{"app/api", "app/db"}},
+		{"tag prefix", storage.Query{Index: "tag", Prefix: "s"}, []string{"app/db", "app/worker"}},
+		{"tag range", storage.Query{Index: "tag", Start: "p", End: "t"}, []string{"app/api", "app/db", "app/db", "app/worker"}},
+		{"missing tag", storage.Query{Index: "tag", Value: "dev"}, []string{}},
+		{"key prefix", storage.Query{Prefix: "app/"}, []string{"app/api", "app/db", "app/worker"}},
+		{"key range", storage.Query{Start: "app/db", End: "notes"}, []string{"app/db", "app/worker", "ci/token"}},
+	} {
+		if got := scanKeys(t, records, tc.q); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// Pages add up to the whole scan
+	var paged []string
+	q := storage.Query{Index: "tag", Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("Paging does not end")
+		}
+		page, err := records.Scan(q)
+		if err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		if len(page.Items) > 2 {
+			t.Errorf("Page holds %d items", len(page.Items))
+		}
+		for _, item := range page.Items {
+			paged = append(paged, item.Value.Name)
+		}
+		if page.Next == "" {
+			break
+		}
+		q.After = page.Next
+	}
+	if all := scanKeys(t, records, storage.Query{Index: "tag"}); !reflect.DeepEqual(paged, all) {
+		t.Errorf("Paged scan = %v, want %v", paged, all)
+	}
+
+	// Updates and deletes move records out of the index
+	if err := records.Put("app/api", &testRecord{Name: "app/api", Tags: []string{"web"}}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := records.Delete("app/db"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if got := scanKeys(t, records, storage.Query{Index: "tag", Value: "prod"}); len(got) != 0 {
+		t.Errorf("prod after update and delete = %v", got)
+	}
+
+	// A failed transaction leaves the index as it was
+	errAbort := errors.New("abort")
+	err = db.Update(func(tx *storage.Tx) error {
+		if err := records.In(tx).Put("app/new", &testRecord{Tags: []string{"prod"}}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if err != errAbort {
+		t.Fatalf("Update returned %v", err)
+	}
+	if got := scanKeys(t, records, storage.Query{Index: "tag", Value: "prod"}); len(got) != 0 {
+		t.Errorf("Rolled back record is indexed: %v", got)
+	}
+
+	if _, err := records.Scan(storage.Query{Index: "owner"}); err == nil {
+		t.Error("Scan of an unknown index succeeded")
+	}
+}
+
+func TestCollectionRebuildsStaleIndex(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestDBEnvironment(t)
+	defer cleanup()
+
+	db, err := storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	records := testCollection(db)
+	records.Put("a", &testRecord{Tags: []string{"x"}})
+
+	// Records written around the collection are picked up
+	if err := db.Set("backup_metadata", "b", testRecord{Tags: []string{"x"}}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got := scanKeys(t, records, storage.Query{Index: "tag", Value: "x"}); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("After raw Set: %v", got)
+	}
+	if err := db.HideKeyNames(); err != nil {
+		t.Fatalf("HideKeyNames failed: %v", err)
+	}
+	db.Delete("backup_metadata", "a")
+	if got := scanKeys(t, records, storage.Query{Index: "tag", Value: "x"}); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("After raw Delete with hidden keys: %v", got)
+	}
+	db.Close()
+
+	// Read-only databases scan without writing the index
+	db, err = storage.Open(dbPath, masterKey, storage.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Failed to open database read-only: %v", err)
+	}
+	defer db.Close()
+	if got := scanKeys(t, testCollection(db), storage.Query{Index: "tag", Value: "x"}); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("Read-only scan: %v", got)
+	}
+}
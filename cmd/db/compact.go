@@ -0,0 +1,52 @@
+package db
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// compactSuggestion is the fragmentation at which 'ark db stats' suggests
+// compacting
+const compactSuggestion = 0.25
+
+var compactCmd = &cobra.Command{
+	Use:   "compact",
+	Short: "Shrink the database file by dropping its free pages",
+	Long: `Rewrite the database without the pages deleted records left free. A bbolt
+database is copied into a new file, which then atomically replaces it; a
+SQLite database is vacuumed in place.
+
+To compact automatically after commands that delete records, set
+storage.auto_compact in config.yaml to the share of free pages at which to
+do it, e.g. 0.5.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDatabase(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return runCompact(db, cmd.OutOrStdout())
+	},
+}
+
+// runCompact compacts db and reports how much smaller it got
+func runCompact(db *storage.Database, out io.Writer) error {
+	before, err := db.Stats()
+	if err != nil {
+		return err
+	}
+	if err := db.Compact(); err != nil {
+		return err
+	}
+	after, err := db.Stats()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "✅ Database compacted: %d -> %d bytes, %d free pages reclaimed\n",
+		before.FileSize, after.FileSize, before.FreePages-after.FreePages)
+	return nil
+}
@@ -0,0 +1,178 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+)
+
+// fillAndDelete writes n large records into backup_metadata and deletes all
+// but the first, leaving most of the database file free
+func fillAndDelete(t *testing.T, db *storage.Database, n int) {
+	t.Helper()
+	value := strings.Repeat("x", 4096)
+	if err := db.Update(func(tx *storage.Tx) error {
+		for i := 0; i < n; i++ {
+			if err := tx.Set("backup_metadata", fmt.Sprintf("key-%03d", i), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to write records: %v", err)
+	}
+	if err := db.Update(func(tx *storage.Tx) error {
+		for i := 1; i < n; i++ {
+			if err := tx.Delete("backup_metadata", fmt.Sprintf("key-%03d", i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to delete records: %v", err)
+	}
+}
+
+// fileSize returns the size of the file at path
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat %s: %v", path, err)
+	}
+	return info.Size()
+}
+
+// fileModTime returns the modification time of the file at path
+func fileModTime(t *testing.T, path string) time.Time {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat %s: %v", path, err)
+	}
+	return info.ModTime()
+}
+
+func TestCompact(t *testing.T) {
+	for _, backend := range []string{storage.BackendBolt, storage.BackendSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			dbPath, masterKey, cleanup := setupTestDBEnvironment(t)
+			defer cleanup()
+
+			db, err := storage.Open(dbPath, masterKey, storage.Options{Backend: backend})
+			if err != nil {
+				t.Fatalf("Failed to create database: %v", err)
+			}
+			defer db.Close()
+			fillAndDelete(t, db, 200)
+
+			stats, err := db.Stats()
+			if err != nil {
+				t.Fatalf("Stats failed: %v", err)
+			}
+			if stats.Backend != backend || stats.FreePages == 0 || stats.Fragmentation() < 0.5 {
+				t.Errorf("Stats after deleting = %+v", stats)
+			}
+			var out bytes.Buffer
+			if err := runStats(db, &out); err != nil {
+				t.Fatalf("runStats failed: %v", err)
+			}
+			if !strings.Contains(out.String(), "backup_metadata") || !strings.Contains(out.String(), "ark db compact") {
+				t.Errorf("Unexpected stats output:\n%s", out.String())
+			}
+
+			before := fileSize(t, dbPath)
+			out.Reset()
+			if err := runCompact(db, &out); err != nil {
+				t.Fatalf("runCompact failed: %v", err)
+			}
+			if !strings.Contains(out.String(), "Database compacted") {
+				t.Errorf("Unexpected compact output: %s", out.String())
+			}
+			if after := fileSize(t, dbPath); after >= before/2 {
+				t.Errorf("Database file went from %d to %d bytes", before, after)
+			}
+			if _, err := os.Stat(dbPath + ".compact"); !os.IsNotExist(err) {
+				t.Errorf("Temporary file left behind: %v", err)
+			}
+
+			// The compacted database is still the same database
+			var value string
+			if err := db.Get("backup_metadata", "key-000", &value); err != nil || len(value) != 4096 {
+				t.Errorf("Get after compact = %d bytes, %v", len(value), err)
+			}
+			if err := db.Set("backup_metadata", "added", "after-compact"); err != nil {
+				t.Errorf("Set after compact failed: %v", err)
+			}
+			stats, err = db.Stats()
+			if err != nil {
+				t.Fatalf("Stats failed: %v", err)
+			}
+			for _, b := range stats.Buckets {
+				if b.Name == "backup_metadata" && b.Keys != 2 {
+					t.Errorf("backup_metadata holds %d keys, want 2", b.Keys)
+				}
+			}
+		})
+	}
+}
+
+func TestAutoCompactAfterDeletes(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestDBEnvironment(t)
+	defer cleanup()
+
+	db, err := storage.Open(dbPath, masterKey, storage.Options{AutoCompact: 0.5})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	fillAndDelete(t, db, 200)
+	before := fileSize(t, dbPath)
+	db.Close()
+
+	if after := fileSize(t, dbPath); after >= before/2 {
+		t.Errorf("Database file went from %d to %d bytes", before, after)
+	}
+
+	// Without deletions, closing leaves the file alone
+	db, err = storage.Open(dbPath, masterKey, storage.Options{AutoCompact: 0.5})
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	var value string
+	if err := db.Get("backup_metadata", "key-000", &value); err != nil {
+		t.Errorf("Get after auto-compaction failed: %v", err)
+	}
+	modified := fileModTime(t, dbPath)
+	db.Close()
+	if !fileModTime(t, dbPath).Equal(modified) {
+		t.Error("Closing without deletions rewrote the database")
+	}
+}
+
+func TestCompactReadOnly(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestDBEnvironment(t)
+	defer cleanup()
+
+	db, err := storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Close()
+
+	db, err = storage.Open(dbPath, masterKey, storage.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Failed to open database read-only: %v", err)
+	}
+	defer db.Close()
+	if err := db.Compact(); err != storage.ErrReadOnly {
+		t.Errorf("Compact on a read-only database returned %v", err)
+	}
+	if _, err := db.Stats(); err != nil {
+		t.Errorf("Stats on a read-only database failed: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/config"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+var convertTo string
+
+var convertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "Move the database to another storage backend",
+	Long: `Copy every record into a new database file written by another storage
+backend, swap it in, and make that backend the configured one.
+
+Records are copied exactly as they are stored, so nothing is decrypted or
+re-encrypted. The previous file is kept next to the database
+(ark.db.<backend>.bak).
+
+Backends:
+  bbolt   - a single-file B+tree store (default)
+  sqlite  - a SQLite database file`,
+	Example: `  ark db convert --to sqlite`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !storage.ValidBackend(convertTo) {
+			return fmt.Errorf("unknown storage backend %q (use bbolt or sqlite)", convertTo)
+		}
+
+		cfg, db, err := openConfigAndDatabase(cmd, storage.Options{})
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return runConvert(cfg, db, convertTo, cmd.OutOrStdout())
+	},
+}
+
+// runConvert moves db to the backend to and records it in cfg
+func runConvert(cfg *config.Config, db *storage.Database, to string, out io.Writer) error {
+	from := db.Backend()
+	if from == to {
+		fmt.Fprintf(out, "Database is already stored in %s\n", to)
+	} else {
+		fmt.Fprintf(out, "Converting database from %s to %s...\n", from, to)
+		if err := db.Convert(to); err != nil {
+			return fmt.Errorf("failed to convert database: %w", err)
+		}
+	}
+
+	cfg.Storage.Backend = to
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+	if from != to {
+		fmt.Fprintf(out, "✅ Database converted to %s\n", to)
+		fmt.Fprintf(out, "Previous database kept at %s\n", storage.ConvertBackupPath(db.Path(), from))
+	}
+	return nil
+}
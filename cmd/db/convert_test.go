@@ -0,0 +1,177 @@
+package db
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/config"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+)
+
+func TestConvertRoundTrip(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestDBEnvironment(t)
+	defer cleanup()
+
+	cfg := config.DefaultConfig(filepath.Dir(dbPath))
+	cfg.DatabasePath = dbPath
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	db, err := cfg.OpenDatabase(masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer func() { db.Close() }()
+	db.Set("backup_metadata", "api-key", "secret-value")
+	db.Set("locked_dirs", filepath.Dir(dbPath), map[string]string{"path": filepath.Dir(dbPath)})
+	if err := db.HideKeyNames(); err != nil {
+		t.Fatalf("HideKeyNames failed: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := runConvert(cfg, db, storage.BackendSQLite, &out); err != nil {
+		t.Fatalf("Convert to sqlite failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Database converted to sqlite") {
+		t.Errorf("Unexpected output: %s", out.String())
+	}
+	if kind, _ := storage.DetectBackend(dbPath); kind != storage.BackendSQLite {
+		t.Errorf("Database file is %q, want sqlite", kind)
+	}
+	if _, err := os.Stat(storage.ConvertBackupPath(dbPath, storage.BackendBolt)); err != nil {
+		t.Errorf("Previous database not kept: %v", err)
+	}
+	reloaded, err := config.Load(cfg.ConfigDir)
+	if err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	if reloaded.Storage.Backend != storage.BackendSQLite {
+		t.Errorf("Configured backend = %q, want sqlite", reloaded.Storage.Backend)
+	}
+
+	// The converted database works for reads, writes, key rotation and checks
+	var value string
+	if err := db.Get("backup_metadata", "api-key", &value); err != nil || value != "secret-value" {
+		t.Fatalf("Get after convert = %q, %v", value, err)
+	}
+	if err := db.Set("backup_metadata", "added", "after-convert"); err != nil {
+		t.Fatalf("Set after convert failed: %v", err)
+	}
+	if err := db.Rekey(masterKey, nil); err != nil {
+		t.Fatalf("Rekey on sqlite failed: %v", err)
+	}
+	storage.RemoveRekeyBackup(dbPath)
+	db.Close()
+
+	db, err = storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to reopen sqlite database: %v", err)
+	}
+	if db.Backend() != storage.BackendSQLite {
+		t.Errorf("Reopened backend = %q, want sqlite", db.Backend())
+	}
+	keys, err := db.List("backup_metadata")
+	if err != nil || len(keys) != 2 {
+		t.Errorf("List after reopen = %v, %v", keys, err)
+	}
+	out.Reset()
+	if err := runCheck(db, false, &out); err != nil {
+		t.Errorf("Check on sqlite failed: %v\n%s", err, out.String())
+	}
+
+	// And back again
+	out.Reset()
+	if err := runConvert(cfg, db, storage.BackendBolt, &out); err != nil {
+		t.Fatalf("Convert to bbolt failed: %v", err)
+	}
+	if kind, _ := storage.DetectBackend(dbPath); kind != storage.BackendBolt {
+		t.Errorf("Database file is %q, want bbolt", kind)
+	}
+	if err := db.Get("backup_metadata", "added", &value); err != nil || value != "after-convert" {
+		t.Errorf("Get after converting back = %q, %v", value, err)
+	}
+}
+
+func TestConfiguredBackendCreatesDatabase(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestDBEnvironment(t)
+	defer cleanup()
+
+	cfg := config.DefaultConfig(filepath.Dir(dbPath))
+	cfg.DatabasePath = dbPath
+	cfg.Storage.Backend = storage.BackendSQLite
+
+	db, err := cfg.OpenDatabase(masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Set("backup_metadata", "k", "v")
+	db.Close()
+
+	if kind, _ := storage.DetectBackend(dbPath); kind != storage.BackendSQLite {
+		t.Fatalf("Database file is %q, want sqlite", kind)
+	}
+
+	// An existing file keeps its backend whatever the configuration says
+	cfg.Storage.Backend = storage.BackendBolt
+	db, err = cfg.OpenDatabase(masterKey)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	if db.Backend() != storage.BackendSQLite {
+		t.Errorf("Backend = %q, want sqlite", db.Backend())
+	}
+}
+
+func TestMemoryDatabase(t *testing.T) {
+	_, masterKey, cleanup := setupTestDBEnvironment(t)
+	defer cleanup()
+
+	db, err := storage.NewMemoryDatabase(masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create in-memory database: %v", err)
+	}
+	defer db.Close()
+
+	db.Set("backup_metadata", "k", "v")
+	if err := db.Update(func(tx *storage.Tx) error {
+		if err := tx.Set("backup_metadata", "k2", "v2"); err != nil {
+			return err
+		}
+		return os.ErrInvalid
+	}); err != os.ErrInvalid {
+		t.Fatalf("Update returned %v", err)
+	}
+	if ok, _ := db.Exists("backup_metadata", "k2"); ok {
+		t.Error("Failed transaction left a record behind")
+	}
+
+	var out bytes.Buffer
+	if err := runCheck(db, false, &out); err != nil {
+		t.Errorf("Check failed: %v\n%s", err, out.String())
+	}
+	if err := runMigrate(db, true, &out); err != nil {
+		t.Errorf("Dry-run migrate failed: %v", err)
+	}
+
+	// Backups of an in-memory database restore into it
+	backup, err := db.Backup()
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	db.Delete("backup_metadata", "k")
+	if err := db.Restore(backup, masterKey); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	var value string
+	if err := db.Get("backup_metadata", "k", &value); err != nil || value != "v" {
+		t.Errorf("Get after restore = %q, %v", value, err)
+	}
+	if db.Path() != "" {
+		t.Errorf("In-memory database has path %q", db.Path())
+	}
+}
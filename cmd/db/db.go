@@ -0,0 +1,183 @@
+package db
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/config"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// DBCmd groups maintenance commands for the encrypted database
+var DBCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Maintain the encrypted database",
+}
+
+var hideKeysCmd = &cobra.Command{
+	Use:   "hide-keys",
+	Short: "Store entry names as keyed digests",
+	Long: `Values in the database are encrypted, but entry names - vault keys, locked
+directory paths, EC2 registration names - are stored in plaintext and can be
+read by anyone with the file.
+
+This rewrites every entry so it is stored under an HMAC digest of its name,
+with the name moved inside the encrypted value. Listing and searching keep
+working, but have to decrypt every entry in a bucket. The change cannot be
+undone.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDatabase(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		if db.KeyNamesHidden() {
+			fmt.Println("Entry names are already hidden.")
+			return nil
+		}
+		if err := db.HideKeyNames(); err != nil {
+			return err
+		}
+		fmt.Println("✅ Entry names are now stored as digests")
+		return nil
+	},
+}
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Show the database schema version",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDatabaseWith(cmd, storage.Options{SkipMigrations: true, ReadOnly: true})
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		version, err := db.SchemaVersion()
+		if err != nil {
+			return err
+		}
+		pending, err := db.PendingMigrations()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Schema version: %d\n", version)
+		fmt.Printf("Latest schema version: %d\n", storage.LatestSchemaVersion())
+		if len(pending) > 0 {
+			fmt.Printf("%d migration(s) pending - run 'ark db migrate'\n", len(pending))
+		}
+		return nil
+	},
+}
+
+var migrateDryRun bool
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the database to the latest schema",
+	Long: `Apply pending schema migrations, in order, each in its own transaction.
+The database is copied next to itself (ark.db.v<N>.bak) first.
+
+Databases are also migrated automatically when opened; this command lets you
+do it explicitly, or check with --dry-run what would change. A dry run
+applies the migrations in a transaction that is rolled back.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDatabaseWith(cmd, storage.Options{SkipMigrations: true})
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return runMigrate(db, migrateDryRun, cmd.OutOrStdout())
+	},
+}
+
+// runMigrate applies or, with dryRun, rehearses the pending migrations
+func runMigrate(db *storage.Database, dryRun bool, out io.Writer) error {
+	from, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		pending, err := db.MigrateDryRun()
+		for _, m := range pending {
+			fmt.Fprintf(out, "Would apply migration %d: %s\n", m.Version, m.Description)
+		}
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			fmt.Fprintf(out, "Database is up to date (schema version %d)\n", from)
+			return nil
+		}
+		fmt.Fprintf(out, "✅ Dry run succeeded - schema version %d would become %d\n", from, pending[len(pending)-1].Version)
+		return nil
+	}
+
+	applied, err := db.Migrate(func(m storage.Migration) {
+		fmt.Fprintf(out, "Applying migration %d: %s\n", m.Version, m.Description)
+	})
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		fmt.Fprintf(out, "Database is up to date (schema version %d)\n", from)
+		return nil
+	}
+	fmt.Fprintf(out, "✅ Database migrated to schema version %d\n", applied[len(applied)-1].Version)
+	fmt.Fprintf(out, "Previous database kept at %s\n", storage.MigrationBackupPath(db.Path(), from))
+	return nil
+}
+
+// openDatabase unlocks the database for the configured installation
+func openDatabase(cmd *cobra.Command) (*storage.Database, error) {
+	return openDatabaseWith(cmd, storage.Options{})
+}
+
+// openDatabaseWith is openDatabase with storage options
+func openDatabaseWith(cmd *cobra.Command, opts storage.Options) (*storage.Database, error) {
+	_, db, err := openConfigAndDatabase(cmd, opts)
+	return db, err
+}
+
+// openConfigAndDatabase loads the configuration and unlocks its database.
+// The configured storage options override opts.Backend, opts.Waiting and
+// opts.AutoCompact.
+func openConfigAndDatabase(cmd *cobra.Command, opts storage.Options) (*config.Config, *storage.Database, error) {
+	cfgDir := cmd.Root().PersistentFlags().Lookup("config-dir").Value.String()
+	cfg, err := config.Load(cfgDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	masterKey, err := cfg.GetMasterKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	configured := cfg.StorageOptions()
+	opts.Backend = configured.Backend
+	opts.Waiting = configured.Waiting
+	opts.AutoCompact = configured.AutoCompact
+	db, err := storage.Open(cfg.DatabasePath, masterKey, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, db, nil
+}
+
+func init() {
+	DBCmd.AddCommand(hideKeysCmd)
+	DBCmd.AddCommand(versionCmd)
+	DBCmd.AddCommand(migrateCmd)
+	DBCmd.AddCommand(checkCmd)
+	DBCmd.AddCommand(convertCmd)
+	DBCmd.AddCommand(statsCmd)
+	DBCmd.AddCommand(compactCmd)
+	checkCmd.Flags().BoolVar(&checkRepair, "repair", false, "Move bad and orphaned records into the 'corrupt' bucket")
+	convertCmd.Flags().StringVar(&convertTo, "to", "", "Backend to move the database to (bbolt or sqlite)")
+	convertCmd.MarkFlagRequired("to")
+	migrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "Show and rehearse pending migrations without applying them")
+}
@@ -0,0 +1,243 @@
+package db
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+	"go.etcd.io/bbolt"
+)
+
+// setupTestDBEnvironment creates a temporary directory and master key
+func setupTestDBEnvironment(t *testing.T) (string, []byte, func()) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "ark-db-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	salt, _ := crypto.GenerateSalt()
+	masterKey, err := crypto.DeriveKey("TestPassword123!", salt)
+	if err != nil {
+		t.Fatalf("Failed to derive master key: %v", err)
+	}
+
+	return filepath.Join(dir, "ark.db"), masterKey, func() { os.RemoveAll(dir) }
+}
+
+// fileContains reports whether the raw database file contains s
+func fileContains(t *testing.T, path, s string) bool {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read database file: %v", err)
+	}
+	return bytes.Contains(data, []byte(s))
+}
+
+func TestHideKeyNames(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestDBEnvironment(t)
+	defer cleanup()
+
+	db, err := storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Set("vault", "prod/stripe-live-key", "sk_live")
+	db.Set("vault", "dev/token", "dev")
+	db.Set("locked_dirs", "/home/user/secret-project", map[string]bool{"hidden": true})
+
+	if err := db.HideKeyNames(); err != nil {
+		t.Fatalf("HideKeyNames failed: %v", err)
+	}
+	db.Set("vault", "prod/new-entry", "added")
+	db.Close()
+
+	for _, name := range []string{"prod/stripe-live-key", "/home/user/secret-project", "prod/new-entry"} {
+		if fileContains(t, dbPath, name) {
+			t.Errorf("Expected %q not to appear in the database file", name)
+		}
+	}
+
+	db, err = storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	if !db.KeyNamesHidden() {
+		t.Fatal("Expected hidden key names to persist")
+	}
+
+	keys, err := db.List("vault")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	sort.Strings(keys)
+	if len(keys) != 3 || keys[0] != "dev/token" || keys[1] != "prod/new-entry" || keys[2] != "prod/stripe-live-key" {
+		t.Errorf("Unexpected keys: %v", keys)
+	}
+
+	matches, _ := db.Search("vault", "prod/")
+	if len(matches) != 2 {
+		t.Errorf("Expected 2 search matches, got %v", matches)
+	}
+
+	var value string
+	if err := db.Get("vault", "prod/stripe-live-key", &value); err != nil || value != "sk_live" {
+		t.Errorf("Expected 'sk_live', got %q (%v)", value, err)
+	}
+	if ok, _ := db.Exists("locked_dirs", "/home/user/secret-project"); !ok {
+		t.Error("Expected locked directory entry to exist")
+	}
+	if ok, _ := db.Exists("vault", "missing"); ok {
+		t.Error("Expected missing entry not to exist")
+	}
+
+	if err := db.Delete("vault", "dev/token"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if ok, _ := db.Exists("vault", "dev/token"); ok {
+		t.Error("Expected deleted entry to be gone")
+	}
+}
+
+func TestHiddenKeyNamesSurviveRekey(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestDBEnvironment(t)
+	defer cleanup()
+
+	db, err := storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	db.Set("vault", "prod/db-password", "hunter2")
+	if err := db.HideKeyNames(); err != nil {
+		t.Fatalf("HideKeyNames failed: %v", err)
+	}
+
+	if err := db.Rekey(masterKey, nil); err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+	storage.RemoveRekeyBackup(dbPath)
+
+	var value string
+	if err := db.Get("vault", "prod/db-password", &value); err != nil || value != "hunter2" {
+		t.Errorf("Expected 'hunter2' after rekey, got %q (%v)", value, err)
+	}
+	if keys, _ := db.List("vault"); len(keys) != 1 || keys[0] != "prod/db-password" {
+		t.Errorf("Unexpected keys after rekey: %v", keys)
+	}
+}
+
+func TestHiddenKeyNamesRejectSwappedRecords(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestDBEnvironment(t)
+	defer cleanup()
+
+	db, err := storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Set("vault", "a", "value-a")
+	db.Set("vault", "b", "value-b")
+	db.HideKeyNames()
+	db.Close()
+
+	// Swap the two values under their digests
+	bdb, _ := bbolt.Open(dbPath, 0600, nil)
+	bdb.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("vault"))
+		var keys, values [][]byte
+		b.ForEach(func(k, v []byte) error {
+			keys = append(keys, append([]byte(nil), k...))
+			values = append(values, append([]byte(nil), v...))
+			return nil
+		})
+		b.Put(keys[0], values[1])
+		return b.Put(keys[1], values[0])
+	})
+	bdb.Close()
+
+	db, err = storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	var value string
+	if err := db.Get("vault", "a", &value); err == nil {
+		t.Errorf("Expected swapped record to be rejected, got %q", value)
+	}
+}
+
+func TestHiddenKeyNamesSkipUnreadableRecords(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestDBEnvironment(t)
+	defer cleanup()
+
+	db, err := storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Set("vault", "prod/api", "value-a")
+	db.Set("vault", "prod/db", "value-b")
+	db.HideKeyNames()
+	db.Close()
+
+	// Corrupt one of the records
+	bdb, _ := bbolt.Open(dbPath, 0600, nil)
+	bdb.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("vault"))
+		k, v := b.Cursor().First()
+		corrupt := append([]byte(nil), v...)
+		corrupt[len(corrupt)-1] ^= 0xff
+		return b.Put(append([]byte(nil), k...), corrupt)
+	})
+	bdb.Close()
+
+	db, err = storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	if keys, err := db.List("vault"); err != nil || len(keys) != 1 {
+		t.Errorf("Expected the readable record to be listed, got %v (%v)", keys, err)
+	}
+	if keys, err := db.Search("vault", "prod"); err != nil || len(keys) != 1 {
+		t.Errorf("Expected search to skip the unreadable record, got %v (%v)", keys, err)
+	}
+
+	// Clear removes the unreadable record too
+	if err := db.Update(func(tx *storage.Tx) error {
+		return storage.NewCollection[string](db, "vault").In(tx).Clear()
+	}); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	db.Close()
+	bdb, _ = bbolt.Open(dbPath, 0600, nil)
+	defer bdb.Close()
+	bdb.View(func(tx *bbolt.Tx) error {
+		if n := tx.Bucket([]byte("vault")).Stats().KeyN; n != 0 {
+			t.Errorf("Expected an empty bucket after Clear, got %d records", n)
+		}
+		return nil
+	})
+}
+
+func TestCloseTwice(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestDBEnvironment(t)
+	defer cleanup()
+
+	db, err := storage.Open(dbPath, masterKey, storage.Options{AutoCompact: 0.01})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Set("vault", "a", "value-a")
+	db.Delete("vault", "a")
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Errorf("Expected a second Close to do nothing, got %v", err)
+	}
+}
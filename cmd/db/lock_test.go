@@ -0,0 +1,140 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+)
+
+func TestLockedDatabaseReportsOwner(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestDBEnvironment(t)
+	defer cleanup()
+
+	storage.SetLockOwner("ark backup create")
+	defer storage.SetLockOwner("")
+
+	db, err := storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	waited := false
+	start := time.Now()
+	_, err = storage.Open(dbPath, masterKey, storage.Options{
+		LockTimeout: 200 * time.Millisecond,
+		Waiting:     func(*storage.LockOwner) { waited = true },
+	})
+	var locked *storage.LockedError
+	if !errors.As(err, &locked) || !errors.Is(err, storage.ErrLocked) {
+		t.Fatalf("Open of a locked database returned %v", err)
+	}
+	if time.Since(start) < 200*time.Millisecond {
+		t.Error("Open gave up before the lock timeout")
+	}
+	if !waited {
+		t.Error("Waiting was not called")
+	}
+	if locked.Owner == nil || locked.Owner.PID != os.Getpid() || locked.Owner.Command != "ark backup create" {
+		t.Errorf("Lock owner = %+v", locked.Owner)
+	}
+	if !strings.HasPrefix(err.Error(), "database is locked by pid") {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+
+	// Readers wait for the writer too
+	if _, err := storage.Open(dbPath, masterKey, storage.Options{ReadOnly: true, LockTimeout: 100 * time.Millisecond}); !errors.Is(err, storage.ErrLocked) {
+		t.Errorf("Read-only open of a locked database returned %v", err)
+	}
+
+	// A writer that is released in time is waited for
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		db.Close()
+	}()
+	db, err = storage.Open(dbPath, masterKey, storage.Options{LockTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("Open after the lock was released failed: %v", err)
+	}
+	db.Close()
+	if _, err := os.Stat(storage.LockOwnerPath(dbPath)); !os.IsNotExist(err) {
+		t.Errorf("Lock owner file left behind: %v", err)
+	}
+}
+
+func TestReadOnlyDatabasesShareTheFile(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestDBEnvironment(t)
+	defer cleanup()
+
+	db, err := storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Set("backup_metadata", "k", "v")
+	db.Close()
+
+	opts := storage.Options{ReadOnly: true, LockTimeout: 100 * time.Millisecond}
+	first, err := storage.Open(dbPath, masterKey, opts)
+	if err != nil {
+		t.Fatalf("First read-only open failed: %v", err)
+	}
+	defer first.Close()
+	second, err := storage.Open(dbPath, masterKey, opts)
+	if err != nil {
+		t.Fatalf("Second read-only open failed: %v", err)
+	}
+	defer second.Close()
+
+	if !first.ReadOnly() || !second.ReadOnly() {
+		t.Error("Databases were not opened read-only")
+	}
+	var value string
+	if err := second.Get("backup_metadata", "k", &value); err != nil || value != "v" {
+		t.Errorf("Get = %q, %v", value, err)
+	}
+	if err := first.Set("backup_metadata", "k", "changed"); !errors.Is(err, storage.ErrReadOnly) {
+		t.Errorf("Set on a read-only database returned %v", err)
+	}
+	if err := first.Rekey(masterKey, nil); !errors.Is(err, storage.ErrReadOnly) {
+		t.Errorf("Rekey on a read-only database returned %v", err)
+	}
+
+	// Writers wait for the readers
+	if _, err := storage.Open(dbPath, masterKey, storage.Options{LockTimeout: 100 * time.Millisecond}); !errors.Is(err, storage.ErrLocked) {
+		t.Errorf("Open while readers hold the database returned %v", err)
+	}
+}
+
+func TestReadOnlyOpenCreatesMissingDatabase(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestDBEnvironment(t)
+	defer cleanup()
+
+	// There is nothing to read yet, so the database is created as usual
+	db, err := storage.Open(dbPath, masterKey, storage.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Read-only open of a missing database failed: %v", err)
+	}
+	if db.ReadOnly() {
+		t.Error("New database was opened read-only")
+	}
+	if err := db.Set("backup_metadata", "k", "v"); err != nil {
+		t.Errorf("Set on the new database failed: %v", err)
+	}
+	db.Close()
+
+	db, err = storage.Open(dbPath, masterKey, storage.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Read-only reopen failed: %v", err)
+	}
+	defer db.Close()
+	if !db.ReadOnly() {
+		t.Error("Existing database was not opened read-only")
+	}
+	var value string
+	if err := db.Get("backup_metadata", "k", &value); err != nil || value != "v" {
+		t.Errorf("Get = %q, %v", value, err)
+	}
+}
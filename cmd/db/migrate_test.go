@@ -0,0 +1,134 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+)
+
+func TestNewDatabaseHasLatestSchema(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestDBEnvironment(t)
+	defer cleanup()
+
+	db, err := storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		t.Fatalf("SchemaVersion failed: %v", err)
+	}
+	if version != storage.LatestSchemaVersion() {
+		t.Errorf("New database is version %d, want %d", version, storage.LatestSchemaVersion())
+	}
+	if pending, _ := db.PendingMigrations(); len(pending) != 0 {
+		t.Errorf("New database has %d pending migrations", len(pending))
+	}
+}
+
+func TestMigrateOldDatabase(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestDBEnvironment(t)
+	defer cleanup()
+
+	// A database from before schema versions were recorded
+	db, err := storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Set("vault", "key", "value")
+	if err := db.Delete("config", "schema_version"); err != nil {
+		t.Fatalf("Failed to drop schema version: %v", err)
+	}
+	db.Close()
+
+	db, err = storage.Open(dbPath, masterKey, storage.Options{SkipMigrations: true})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if version, _ := db.SchemaVersion(); version != 0 {
+		t.Fatalf("Old database is version %d, want 0", version)
+	}
+
+	// A dry run reports the migrations but leaves the database alone
+	var out bytes.Buffer
+	if err := runMigrate(db, true, &out); err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Would apply migration 1") {
+		t.Errorf("Dry run output = %q", out.String())
+	}
+	if version, _ := db.SchemaVersion(); version != 0 {
+		t.Errorf("Dry run changed the schema version to %d", version)
+	}
+	if _, err := os.Stat(storage.MigrationBackupPath(dbPath, 0)); !os.IsNotExist(err) {
+		t.Error("Dry run took a backup")
+	}
+
+	out.Reset()
+	if err := runMigrate(db, false, &out); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if version, _ := db.SchemaVersion(); version != storage.LatestSchemaVersion() {
+		t.Errorf("Migrated database is version %d, want %d", version, storage.LatestSchemaVersion())
+	}
+	if _, err := os.Stat(storage.MigrationBackupPath(dbPath, 0)); err != nil {
+		t.Errorf("No backup taken before migrating: %v", err)
+	}
+
+	var value string
+	if err := db.Get("vault", "key", &value); err != nil || value != "value" {
+		t.Errorf("Get after migrating = %q, %v", value, err)
+	}
+
+	// Migrating again is a no-op
+	out.Reset()
+	if err := runMigrate(db, false, &out); err != nil || !strings.Contains(out.String(), "up to date") {
+		t.Errorf("Second migrate = %q, %v", out.String(), err)
+	}
+}
+
+func TestOpenMigratesAutomatically(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestDBEnvironment(t)
+	defer cleanup()
+
+	db, err := storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Set("vault", "key", "value")
+	db.Delete("config", "schema_version")
+	db.Close()
+
+	db, err = storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	if version, _ := db.SchemaVersion(); version != storage.LatestSchemaVersion() {
+		t.Errorf("Reopened database is version %d, want %d", version, storage.LatestSchemaVersion())
+	}
+}
+
+func TestOpenRejectsNewerSchema(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestDBEnvironment(t)
+	defer cleanup()
+
+	db, err := storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Set("config", "schema_version", storage.LatestSchemaVersion()+1)
+	db.Close()
+
+	if _, err := storage.NewDatabase(dbPath, masterKey); !errors.Is(err, storage.ErrSchemaTooNew) {
+		t.Errorf("Expected ErrSchemaTooNew, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show database size, bucket contents and free space",
+	Long: `Show how many records each bucket holds and how many bytes they take up
+as stored, encrypted, along with the free pages in the database file.
+
+Deleting records frees pages, which are reused before the file grows but
+never given back. When much of the file is free, 'ark db compact' shrinks it.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDatabaseWith(cmd, storage.Options{ReadOnly: true})
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return runStats(db, cmd.OutOrStdout())
+	},
+}
+
+// runStats prints the statistics of db
+func runStats(db *storage.Database, out io.Writer) error {
+	stats, err := db.Stats()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Backend:    %s\n", stats.Backend)
+	if db.Path() != "" {
+		fmt.Fprintf(out, "File:       %s (%d bytes)\n", db.Path(), stats.FileSize)
+	}
+	if stats.Pages > 0 {
+		fmt.Fprintf(out, "Pages:      %d of %d bytes, %d free (%.1f%% fragmentation)\n",
+			stats.Pages, stats.PageSize, stats.FreePages, stats.Fragmentation()*100)
+	}
+	fmt.Fprintln(out)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BUCKET\tKEYS\tBYTES")
+	for _, b := range stats.Buckets {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", b.Name, b.Keys, b.Bytes)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if stats.Fragmentation() >= compactSuggestion {
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "⚠️  Much of the file is free space - run 'ark db compact' to shrink it")
+	}
+	return nil
+}
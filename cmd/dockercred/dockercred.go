@@ -0,0 +1,79 @@
+package dockercred
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/config"
+	"github.com/mbeniwal-imwe/ark/internal/features/dockercred"
+	"github.com/mbeniwal-imwe/ark/internal/storage/vault"
+	"github.com/spf13/cobra"
+)
+
+// DockerCredentialCmd implements the docker-credential-helpers protocol
+var DockerCredentialCmd = &cobra.Command{
+	Use:   "docker-credential <get|store|erase|list>",
+	Short: "Docker credential helper backed by the vault",
+	Long: `Docker credential helper backed by the Ark vault.
+
+Registry logins are stored as JSON vault entries under docker/<server-url>
+instead of base64 in ~/.docker/config.json.
+
+Enable it by setting the credential store in ~/.docker/config.json:
+  { "credsStore": "ark" }
+
+Docker runs docker-credential-ark, which make install links to the ark binary.`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"get", "store", "erase", "list"},
+	// Errors are part of the protocol and are written to stdout instead
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	RunE:          runDockerCredential,
+}
+
+func runDockerCredential(cmd *cobra.Command, args []string) error {
+	err := serveDockerCredential(cmd, args[0])
+	if err != nil {
+		fmt.Fprintln(cmd.OutOrStdout(), err.Error())
+	}
+	return err
+}
+
+func serveDockerCredential(cmd *cobra.Command, action string) error {
+	switch action {
+	case "get", "store", "erase", "list":
+	default:
+		return fmt.Errorf("unknown credential action: %s", action)
+	}
+
+	// Read the request before anything else touches stdin
+	input, err := io.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return fmt.Errorf("failed to read request: %w", err)
+	}
+
+	configDir := cmd.Root().PersistentFlags().Lookup("config-dir").Value.String()
+	cfg, err := config.Load(configDir)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	masterKey, err := cfg.GetMasterKey()
+	if err != nil {
+		return err
+	}
+	// Lookups should not wait for, or block, other ark processes
+	open := cfg.OpenDatabase
+	if action == "get" || action == "list" {
+		open = cfg.OpenDatabaseReadOnly
+	}
+	db, err := open(masterKey)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	helper := &dockercred.Helper{Vault: vault.NewVaultManager(db)}
+	return dockercred.Serve(helper, action, bytes.NewReader(input), cmd.OutOrStdout())
+}
@@ -0,0 +1,126 @@
+package dockercred
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+	"github.com/mbeniwal-imwe/ark/internal/features/dockercred"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+	"github.com/mbeniwal-imwe/ark/internal/storage/vault"
+)
+
+// setupTestHelper creates a credential helper over a temporary database
+func setupTestHelper(t *testing.T) (*dockercred.Helper, func()) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "ark-dockercred-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	salt, _ := crypto.GenerateSalt()
+	masterKey, err := crypto.DeriveKey("TestPassword123!", salt)
+	if err != nil {
+		t.Fatalf("Failed to derive master key: %v", err)
+	}
+
+	db, err := storage.NewDatabase(filepath.Join(dir, "ark.db"), masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	cleanup := func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+	return &dockercred.Helper{Vault: vault.NewVaultManager(db)}, cleanup
+}
+
+func TestServeStoreGetListErase(t *testing.T) {
+	helper, cleanup := setupTestHelper(t)
+	defer cleanup()
+
+	serverURL := "https://index.docker.io/v1/"
+	payload := `{"ServerURL":"https://index.docker.io/v1/","Username":"whale","Secret":"dckr_pat_123"}`
+	if err := dockercred.Serve(helper, "store", strings.NewReader(payload), &bytes.Buffer{}); err != nil {
+		t.Fatalf("store failed: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := dockercred.Serve(helper, "get", strings.NewReader(serverURL+"\n"), &out); err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	var creds dockercred.Credentials
+	if err := json.Unmarshal(out.Bytes(), &creds); err != nil {
+		t.Fatalf("Failed to decode get output %q: %v", out.String(), err)
+	}
+	if creds.ServerURL != serverURL || creds.Username != "whale" || creds.Secret != "dckr_pat_123" {
+		t.Errorf("Unexpected credentials: %+v", creds)
+	}
+
+	out.Reset()
+	if err := dockercred.Serve(helper, "list", strings.NewReader(""), &out); err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	var list map[string]string
+	if err := json.Unmarshal(out.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to decode list output %q: %v", out.String(), err)
+	}
+	if list[serverURL] != "whale" {
+		t.Errorf("Expected list to map %s to 'whale', got %v", serverURL, list)
+	}
+
+	if err := dockercred.Serve(helper, "erase", strings.NewReader(serverURL), &bytes.Buffer{}); err != nil {
+		t.Fatalf("erase failed: %v", err)
+	}
+	if _, err := helper.Get(serverURL); err != dockercred.ErrCredentialsNotFound {
+		t.Errorf("Expected ErrCredentialsNotFound after erase, got %v", err)
+	}
+}
+
+func TestGetMissingCredentials(t *testing.T) {
+	helper, cleanup := setupTestHelper(t)
+	defer cleanup()
+
+	err := dockercred.Serve(helper, "get", strings.NewReader("ghcr.io\n"), &bytes.Buffer{})
+	if err != dockercred.ErrCredentialsNotFound {
+		t.Errorf("Expected ErrCredentialsNotFound, got %v", err)
+	}
+	if err.Error() != "credentials not found in native keychain" {
+		t.Errorf("Protocol error message changed: %q", err.Error())
+	}
+}
+
+func TestListIgnoresOtherEntries(t *testing.T) {
+	helper, cleanup := setupTestHelper(t)
+	defer cleanup()
+
+	if err := helper.Vault.Set("my-api-key", "sk-123", "text", "", nil); err != nil {
+		t.Fatalf("Failed to set vault entry: %v", err)
+	}
+
+	list, err := helper.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(list) != 0 {
+		t.Errorf("Expected no registries, got %v", list)
+	}
+}
+
+func TestUnknownAction(t *testing.T) {
+	var out bytes.Buffer
+	DockerCredentialCmd.SetOut(&out)
+	defer DockerCredentialCmd.SetOut(nil)
+
+	if err := runDockerCredential(DockerCredentialCmd, []string{"version2"}); err == nil {
+		t.Error("Expected error for unknown action, but got none")
+	}
+	if !strings.Contains(out.String(), "unknown credential action") {
+		t.Errorf("Expected protocol error on stdout, got %q", out.String())
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/mbeniwal-imwe/ark/internal/core/config"
 	awsfeat "github.com/mbeniwal-imwe/ark/internal/features/aws"
-	"github.com/mbeniwal-imwe/ark/internal/storage"
 	"github.com/spf13/cobra"
 )
 
@@ -39,7 +38,7 @@ var listCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		db, err := storage.NewDatabase(cfg.DatabasePath, masterKey)
+		db, err := cfg.OpenDatabaseReadOnly(masterKey)
 		if err != nil {
 			return err
 		}
@@ -111,7 +110,7 @@ var registerCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		db, err := storage.NewDatabase(cfg.DatabasePath, masterKey)
+		db, err := cfg.OpenDatabase(masterKey)
 		if err != nil {
 			return err
 		}
@@ -157,7 +156,7 @@ var startCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		db, err := storage.NewDatabase(cfg.DatabasePath, masterKey)
+		db, err := cfg.OpenDatabase(masterKey)
 		if err != nil {
 			return err
 		}
@@ -212,7 +211,7 @@ var stopCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		db, err := storage.NewDatabase(cfg.DatabasePath, masterKey)
+		db, err := cfg.OpenDatabase(masterKey)
 		if err != nil {
 			return err
 		}
@@ -267,7 +266,7 @@ var metricsCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		db, err := storage.NewDatabase(cfg.DatabasePath, masterKey)
+		db, err := cfg.OpenDatabase(masterKey)
 		if err != nil {
 			return err
 		}
@@ -307,7 +306,7 @@ var metricsCmd = &cobra.Command{
 }
 
 var sshCmd = &cobra.Command{
-	Use:   "ssh <name>",
+	Use:   "ssh <name|instance-id>",
 	Short: "SSH to an EC2 instance",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -323,7 +322,7 @@ var sshCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		db, err := storage.NewDatabase(cfg.DatabasePath, masterKey)
+		db, err := cfg.OpenDatabase(masterKey)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,83 @@
+package gitcred
+
+import (
+	"fmt"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/config"
+	"github.com/mbeniwal-imwe/ark/internal/features/gitcred"
+	"github.com/mbeniwal-imwe/ark/internal/storage/vault"
+	"github.com/spf13/cobra"
+)
+
+// GitCredentialCmd implements git's credential-helper protocol
+var GitCredentialCmd = &cobra.Command{
+	Use:   "git-credential <get|store|erase>",
+	Short: "Git credential helper backed by the vault",
+	Long: `Git credential helper backed by the Ark vault.
+
+Credentials are stored as JSON vault entries under git/<host> (or
+git/<host>/<path> when credential.useHttpPath is enabled) with username
+and password fields.
+
+Enable it for all repositories with:
+  git config --global credential.helper ark
+
+This requires the git-credential-ark link installed next to the ark binary
+(make install creates it). Alternatively, point git at the subcommand:
+  git config --global credential.helper '!ark git-credential'`,
+	Args: cobra.ExactArgs(1),
+	RunE: runGitCredential,
+}
+
+func runGitCredential(cmd *cobra.Command, args []string) error {
+	op := args[0]
+	if op != "get" && op != "store" && op != "erase" {
+		// Helpers must ignore operations they do not understand
+		return nil
+	}
+
+	// Read the request before anything else touches stdin
+	req, err := gitcred.Parse(cmd.InOrStdin())
+	if err != nil {
+		return err
+	}
+
+	configDir := cmd.Root().PersistentFlags().Lookup("config-dir").Value.String()
+	cfg, err := config.Load(configDir)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	masterKey, err := cfg.GetMasterKey()
+	if err != nil {
+		return err
+	}
+	// Lookups should not wait for, or block, other ark processes
+	open := cfg.OpenDatabase
+	if op == "get" {
+		open = cfg.OpenDatabaseReadOnly
+	}
+	db, err := open(masterKey)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	helper := &gitcred.Helper{Vault: vault.NewVaultManager(db)}
+
+	switch op {
+	case "get":
+		cred, err := helper.Get(req)
+		if err != nil {
+			return err
+		}
+		if cred == nil {
+			return nil
+		}
+		return cred.Write(cmd.OutOrStdout())
+	case "store":
+		return helper.Store(req)
+	default:
+		return helper.Erase(req)
+	}
+}
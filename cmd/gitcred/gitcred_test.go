@@ -0,0 +1,149 @@
+package gitcred
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+	"github.com/mbeniwal-imwe/ark/internal/features/gitcred"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+	"github.com/mbeniwal-imwe/ark/internal/storage/vault"
+)
+
+// setupTestHelper creates a credential helper over a temporary database
+func setupTestHelper(t *testing.T) (*gitcred.Helper, func()) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "ark-gitcred-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	salt, _ := crypto.GenerateSalt()
+	masterKey, err := crypto.DeriveKey("TestPassword123!", salt)
+	if err != nil {
+		t.Fatalf("Failed to derive master key: %v", err)
+	}
+
+	db, err := storage.NewDatabase(filepath.Join(dir, "ark.db"), masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	cleanup := func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+	return &gitcred.Helper{Vault: vault.NewVaultManager(db)}, cleanup
+}
+
+func TestParseCredential(t *testing.T) {
+	input := "protocol=https\nhost=github.com\npath=org/repo.git\nusername=octo\ncapability[]=authtype\n\nignored=after-blank\n"
+	cred, err := gitcred.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if cred.Protocol != "https" || cred.Host != "github.com" || cred.Path != "org/repo.git" || cred.Username != "octo" {
+		t.Errorf("Unexpected credential: %+v", cred)
+	}
+	if cred.VaultKey() != "git/github.com/org/repo.git" {
+		t.Errorf("Expected key 'git/github.com/org/repo.git', got '%s'", cred.VaultKey())
+	}
+}
+
+func TestParseCredentialURL(t *testing.T) {
+	cred, err := gitcred.Parse(strings.NewReader("url=https://octo@example.com:8443/team/repo.git\n"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if cred.Host != "example.com:8443" || cred.Username != "octo" || cred.Path != "team/repo.git" {
+		t.Errorf("Unexpected credential from url: %+v", cred)
+	}
+}
+
+func TestParseCredentialInvalidLine(t *testing.T) {
+	if _, err := gitcred.Parse(strings.NewReader("not-a-pair\n")); err == nil {
+		t.Error("Expected error for malformed line, but got none")
+	}
+}
+
+func TestStoreGetErase(t *testing.T) {
+	helper, cleanup := setupTestHelper(t)
+	defer cleanup()
+
+	stored := &gitcred.Credential{Protocol: "https", Host: "github.com", Username: "octo", Password: "ghp_secret"}
+	if err := helper.Store(stored); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	// Fields are extracted from the JSON vault entry
+	password, err := helper.Vault.GetField("git/github.com", "password")
+	if err != nil {
+		t.Fatalf("GetField failed: %v", err)
+	}
+	if password != "ghp_secret" {
+		t.Errorf("Expected stored password 'ghp_secret', got '%s'", password)
+	}
+
+	// A request with a path falls back to the host-level entry
+	got, err := helper.Get(&gitcred.Credential{Protocol: "https", Host: "github.com", Path: "org/repo.git"})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got == nil || got.Username != "octo" || got.Password != "ghp_secret" {
+		t.Fatalf("Unexpected credential: %+v", got)
+	}
+
+	var out bytes.Buffer
+	if err := got.Write(&out); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "username=octo\n") || !strings.Contains(out.String(), "password=ghp_secret\n") {
+		t.Errorf("Unexpected helper output: %q", out.String())
+	}
+
+	// A different username must not match
+	other, err := helper.Get(&gitcred.Credential{Protocol: "https", Host: "github.com", Username: "someone-else"})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if other != nil {
+		t.Errorf("Expected no credential for a different username, got %+v", other)
+	}
+
+	if err := helper.Erase(&gitcred.Credential{Protocol: "https", Host: "github.com", Username: "octo"}); err != nil {
+		t.Fatalf("Erase failed: %v", err)
+	}
+	exists, _ := helper.Vault.Exists("git/github.com")
+	if exists {
+		t.Error("Expected credential to be erased")
+	}
+}
+
+func TestGetUnknownHost(t *testing.T) {
+	helper, cleanup := setupTestHelper(t)
+	defer cleanup()
+
+	got, err := helper.Get(&gitcred.Credential{Protocol: "https", Host: "gitlab.com"})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got != nil {
+		t.Errorf("Expected no credential, got %+v", got)
+	}
+}
+
+func TestGitCredentialCommandStructure(t *testing.T) {
+	if GitCredentialCmd.Name() != "git-credential" {
+		t.Errorf("Expected command name 'git-credential', got '%s'", GitCredentialCmd.Name())
+	}
+
+	// Unknown operations are ignored without touching stdin or the vault
+	if err := runGitCredential(GitCredentialCmd, []string{"capability"}); err != nil {
+		t.Errorf("Expected unknown operation to be ignored, got %v", err)
+	}
+}
@@ -6,7 +6,10 @@ import (
 	"path/filepath"
 
 	"github.com/mbeniwal-imwe/ark/internal/core/config"
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
 	"github.com/mbeniwal-imwe/ark/internal/core/password"
+	"github.com/mbeniwal-imwe/ark/internal/core/strength"
+	"github.com/mbeniwal-imwe/ark/internal/features/recovery"
 	"github.com/spf13/cobra"
 )
 
@@ -24,8 +27,15 @@ This command will:
 	RunE: runInit,
 }
 
+var (
+	initRecoveryCode bool
+	initMinScore     int
+)
+
 func init() {
 	rootCmd.AddCommand(initCmd)
+	initCmd.Flags().BoolVar(&initRecoveryCode, "recovery-code", false, "Also create a recovery code in case the master password is forgotten")
+	initCmd.Flags().IntVar(&initMinScore, "min-password-score", 0, fmt.Sprintf("Minimum master password strength, 1-%d (default %d)", strength.MaxScore, strength.DefaultMinScore))
 }
 
 func runInit(cmd *cobra.Command, args []string) error {
@@ -37,22 +47,40 @@ func runInit(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
+	if initMinScore < 0 || initMinScore > strength.MaxScore {
+		return fmt.Errorf("--min-password-score must be between 1 and %d", strength.MaxScore)
+	}
+	security := config.SecurityConfig{MinPasswordScore: initMinScore}
+
 	// Create directory structure
 	if err := createDirectoryStructure(configDir); err != nil {
 		return fmt.Errorf("failed to create directory structure: %w", err)
 	}
 
 	// Initialize master password
-	masterPassword, err := password.SetupMasterPassword()
+	masterPassword, err := password.SetupMasterPassword(security.MinScore())
 	if err != nil {
 		return fmt.Errorf("failed to setup master password: %w", err)
 	}
+	defer masterPassword.Close()
 
 	// Initialize configuration
-	cfg, err := config.Initialize(configDir, masterPassword)
+	cfg, err := config.Initialize(configDir, masterPassword.Bytes())
 	if err != nil {
 		return fmt.Errorf("failed to initialize configuration: %w", err)
 	}
+	cfg.Security.MinPasswordScore = initMinScore
+
+	// Require a keyfile alongside the password when one was given
+	if config.KeyfileOverride != "" {
+		created, err := setupKeyfile(cfg, config.KeyfileOverride, masterPassword.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to set up keyfile: %w", err)
+		}
+		if created {
+			fmt.Printf("🔑 Generated keyfile %s - keep a copy somewhere safe\n", config.KeyfileOverride)
+		}
+	}
 
 	// Save configuration
 	if err := cfg.Save(); err != nil {
@@ -63,9 +91,49 @@ func runInit(cmd *cobra.Command, args []string) error {
 	fmt.Printf("Configuration directory: %s\n", configDir)
 	fmt.Println("You can now use Ark commands to manage your credentials and automate tasks.")
 
+	if !initRecoveryCode {
+		fmt.Println("Tip: run 'ark recovery create' so a forgotten password does not lock you out.")
+		return nil
+	}
+
+	code, err := createInitialRecoveryCode(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create recovery code: %w", err)
+	}
+	fmt.Println()
+	fmt.Println("🔑 Recovery code (shown only once - write it down and keep it offline):")
+	fmt.Println()
+	fmt.Printf("    %s\n", code)
+
 	return nil
 }
 
+// setupKeyfile makes the keyfile at path a second unlock factor, generating a
+// new random keyfile when none exists
+func setupKeyfile(cfg *config.Config, path string, masterPassword []byte) (bool, error) {
+	created := false
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := crypto.GenerateKeyfile(path); err != nil {
+			return false, err
+		}
+		created = true
+	}
+	_, err := cfg.UseKeyfile(path, masterPassword)
+	return created, err
+}
+
+// createInitialRecoveryCode creates the database and a recovery key slot
+func createInitialRecoveryCode(cfg *config.Config) (string, error) {
+	db, err := cfg.OpenDatabase(cfg.MasterKey)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	code, _, err := recovery.CreateCode(db)
+	return code, err
+}
+
 func isInitialized(configDir string) bool {
 	configFile := filepath.Join(configDir, "config.yaml")
 	_, err := os.Stat(configFile)
@@ -6,7 +6,7 @@ import (
 	"github.com/mbeniwal-imwe/ark/internal/core/config"
 	"github.com/mbeniwal-imwe/ark/internal/core/password"
 	"github.com/mbeniwal-imwe/ark/internal/features/dirlock"
-	"github.com/mbeniwal-imwe/ark/internal/storage"
+	"github.com/mbeniwal-imwe/ark/internal/storage/models"
 	"github.com/spf13/cobra"
 )
 
@@ -14,6 +14,7 @@ var (
 	useMaster bool
 	hideDir   bool
 	passOpt   string
+	listState string
 )
 
 var LockCmd = &cobra.Command{
@@ -38,23 +39,24 @@ var addCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		db, err := storage.NewDatabase(cfg.DatabasePath, masterKey)
+		db, err := cfg.OpenDatabase(masterKey)
 		if err != nil {
 			return err
 		}
 		defer db.Close()
 
 		svc := &dirlock.Service{DB: db}
-		passwordValue := ""
+		var passwordValue []byte
 		if !useMaster {
 			if passOpt == "" {
 				p, err := password.GetPasswordWithConfirmation("Set directory password: ", "Confirm password: ")
 				if err != nil {
 					return err
 				}
-				passwordValue = p
+				defer p.Close()
+				passwordValue = p.Bytes()
 			} else {
-				passwordValue = passOpt
+				passwordValue = []byte(passOpt)
 			}
 		}
 		if err := svc.Lock(dir, useMaster, passwordValue, hideDir); err != nil {
@@ -82,7 +84,7 @@ var unlockCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		db, err := storage.NewDatabase(cfg.DatabasePath, masterKey)
+		db, err := cfg.OpenDatabase(masterKey)
 		if err != nil {
 			return err
 		}
@@ -96,14 +98,15 @@ var unlockCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		provided := master
-		if err := svc.Unlock(dir, master, provided); err != nil {
+		defer master.Close()
+		if err := svc.Unlock(dir, master.Bytes()); err != nil {
 			// Try custom
 			p, err2 := password.GetMasterPassword()
 			if err2 != nil {
 				return err
 			}
-			if err3 := svc.Unlock(dir, master, p); err3 != nil {
+			defer p.Close()
+			if err3 := svc.Unlock(dir, p.Bytes()); err3 != nil {
 				return err
 			}
 		}
@@ -125,13 +128,18 @@ var listCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		db, err := storage.NewDatabase(cfg.DatabasePath, masterKey)
+		db, err := cfg.OpenDatabaseReadOnly(masterKey)
 		if err != nil {
 			return err
 		}
 		defer db.Close()
 		svc := &dirlock.Service{DB: db}
-		recs, err := svc.List()
+		var recs []models.LockedDirectory
+		if listState != "" {
+			recs, err = svc.ListByState(listState)
+		} else {
+			recs, err = svc.List()
+		}
 		if err != nil {
 			return err
 		}
@@ -154,4 +162,5 @@ func init() {
 	addCmd.Flags().BoolVar(&useMaster, "use-master", false, "Use Ark master password")
 	addCmd.Flags().BoolVar(&hideDir, "hide", false, "Hide directory (macOS)")
 	addCmd.Flags().StringVar(&passOpt, "password", "", "Set a custom password (non-interactive)")
+	listCmd.Flags().StringVar(&listState, "state", "", "Only list directories in this state (locked or unlocked)")
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
 	"github.com/mbeniwal-imwe/ark/internal/features/dirlock"
 	"github.com/mbeniwal-imwe/ark/internal/storage"
+	"github.com/mbeniwal-imwe/ark/internal/storage/models"
 	"github.com/spf13/cobra"
 )
 
@@ -153,3 +154,91 @@ func TestLockServiceIsLocked(t *testing.T) {
 // 2. Password input (requires mocking or stdin manipulation)
 // 3. File system encryption operations
 // These should be tested with integration tests
+
+func TestEncryptDirectoryRoundTrip(t *testing.T) {
+	configDir, masterKey := setupTestLockEnvironment(t)
+	defer cleanupTestLockEnvironment(t, configDir)
+
+	dir := filepath.Join(configDir, "project")
+	os.MkdirAll(filepath.Join(dir, "sub"), 0700)
+
+	// Larger than one stream chunk, so it is encrypted in several
+	large := make([]byte, 3*crypto.DefaultStreamChunkSize+123)
+	for i := range large {
+		large[i] = byte(i)
+	}
+	os.WriteFile(filepath.Join(dir, "large.bin"), large, 0600)
+	os.WriteFile(filepath.Join(dir, "sub", "notes.txt"), []byte("top secret"), 0600)
+	os.WriteFile(filepath.Join(dir, "empty"), nil, 0600)
+
+	if err := dirlock.EncryptDirectory(dir, masterKey); err != nil {
+		t.Fatalf("EncryptDirectory failed: %v", err)
+	}
+	if fi, err := os.Stat(dir); err != nil || fi.IsDir() {
+		t.Fatalf("Expected directory to be replaced by an archive: %v", err)
+	}
+
+	wrongKey, _ := crypto.DeriveKey("WrongPassword!", make([]byte, crypto.SaltSize))
+	if err := dirlock.DecryptDirectory(dir, wrongKey); err == nil {
+		t.Fatal("Expected decryption with the wrong key to fail")
+	}
+
+	if err := dirlock.DecryptDirectory(dir, masterKey); err != nil {
+		t.Fatalf("DecryptDirectory failed: %v", err)
+	}
+	got, _ := os.ReadFile(filepath.Join(dir, "large.bin"))
+	if string(got) != string(large) {
+		t.Errorf("Large file did not round-trip (%d bytes, want %d)", len(got), len(large))
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "sub", "notes.txt")); string(got) != "top secret" {
+		t.Errorf("Expected 'top secret', got %q", got)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "empty")); err != nil || fi.Size() != 0 {
+		t.Errorf("Expected empty file to round-trip: %v", err)
+	}
+}
+
+func TestLockServiceListByState(t *testing.T) {
+	configDir, masterKey := setupTestLockEnvironment(t)
+	defer cleanupTestLockEnvironment(t, configDir)
+
+	testDir, err := os.MkdirTemp("", "ark-lock-test-dir-*")
+	if err != nil {
+		t.Fatalf("Failed to create test directory: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+	// Lock removes all permissions from the directory
+	defer os.Chmod(testDir, 0700)
+
+	cfg, err := config.Load(configDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	db, err := storage.NewDatabase(cfg.DatabasePath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	svc := &dirlock.Service{DB: db}
+	if err := svc.Lock(testDir, true, nil, false); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+
+	locked, err := svc.ListByState(models.LockStateLocked)
+	if err != nil {
+		t.Fatalf("ListByState failed: %v", err)
+	}
+	if len(locked) != 1 || locked[0].Path != testDir {
+		t.Errorf("Locked directories = %v", locked)
+	}
+	if unlocked, _ := svc.ListByState(models.LockStateUnlocked); len(unlocked) != 0 {
+		t.Errorf("Unlocked directories = %v", unlocked)
+	}
+
+	// Stamping rewrites the record without moving it in the index
+	svc.Stamp(testDir)
+	if locked, _ := svc.ListByState(models.LockStateLocked); len(locked) != 1 || locked[0].LastAccessed.IsZero() {
+		t.Errorf("Locked directories after Stamp = %v", locked)
+	}
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/agent"
+	"github.com/mbeniwal-imwe/ark/internal/core/config"
+	"github.com/spf13/cobra"
+)
+
+// lockNowCmd represents the lock-now command
+var lockNowCmd = &cobra.Command{
+	Use:   "lock-now",
+	Short: "Forget the cached master key immediately",
+	Long: `Evict the cached master key from every cache backend (cache file and
+kernel keyring) and lock a running agent. The next command prompts for the
+master password again.`,
+	RunE: runLockNow,
+}
+
+func init() {
+	rootCmd.AddCommand(lockNowCmd)
+}
+
+func runLockNow(cmd *cobra.Command, args []string) error {
+	configDir := GetConfigDir()
+
+	if err := config.ClearPasswordCache(configDir); err != nil {
+		return fmt.Errorf("failed to clear key cache: %w", err)
+	}
+	if agent.IsRunning(configDir) {
+		if err := agent.Lock(configDir); err != nil {
+			return fmt.Errorf("failed to lock agent: %w", err)
+		}
+	}
+
+	fmt.Println("🔒 Master key cleared from all caches")
+	return nil
+}
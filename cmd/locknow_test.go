@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/config"
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+)
+
+// setupTestKeyCache returns a config using the given cache backend
+func setupTestKeyCache(t *testing.T, configDir, backend string) (*config.Config, config.KeyCache) {
+	t.Helper()
+	cfg := config.DefaultConfig(configDir)
+	cfg.Salt, _ = crypto.GenerateSalt()
+	cfg.Security.KeyCache = backend
+
+	cache, err := cfg.KeyCache()
+	if err != nil {
+		t.Skipf("Key cache %s unavailable: %v", backend, err)
+	}
+	return cfg, cache
+}
+
+func TestKeyCacheRoundTrip(t *testing.T) {
+	for _, backend := range []string{config.KeyCacheFile, config.KeyCacheKeyring} {
+		t.Run(backend, func(t *testing.T) {
+			configDir := setupTestConfigDir(t)
+			defer cleanupTestConfigDir(t, configDir)
+			_, cache := setupTestKeyCache(t, configDir, backend)
+
+			key := bytes.Repeat([]byte{0x5a}, 32)
+			if err := cache.Store(key, time.Minute); err != nil {
+				t.Skipf("Key cache %s unavailable: %v", backend, err)
+			}
+			defer cache.Clear()
+
+			got, err := cache.Load()
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if !bytes.Equal(got, key) {
+				t.Errorf("Expected key %x, got %x", key, got)
+			}
+
+			if err := cache.Clear(); err != nil {
+				t.Fatalf("Clear failed: %v", err)
+			}
+			if _, err := cache.Load(); err == nil {
+				t.Error("Expected error after clear, but got none")
+			}
+		})
+	}
+}
+
+func TestKeyCacheNone(t *testing.T) {
+	configDir := setupTestConfigDir(t)
+	defer cleanupTestConfigDir(t, configDir)
+	_, cache := setupTestKeyCache(t, configDir, config.KeyCacheNone)
+
+	if err := cache.Store(bytes.Repeat([]byte{0x01}, 32), time.Minute); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	if _, err := cache.Load(); err == nil {
+		t.Error("Expected no cached key, but got one")
+	}
+}
+
+func TestKeyCacheInvalidBackend(t *testing.T) {
+	cfg := config.DefaultConfig("/tmp/ark")
+	cfg.Security.KeyCache = "carrier-pigeon"
+	if _, err := cfg.KeyCache(); err == nil {
+		t.Error("Expected error for unknown backend, but got none")
+	}
+}
+
+func TestLockNowClearsAllBackends(t *testing.T) {
+	configDir := setupTestConfigDir(t)
+	defer cleanupTestConfigDir(t, configDir)
+
+	original := GetConfigDir()
+	rootCmd.PersistentFlags().Set("config-dir", configDir)
+	defer rootCmd.PersistentFlags().Set("config-dir", original)
+
+	// Populate whichever backends work here
+	key := bytes.Repeat([]byte{0x33}, 32)
+	var caches []config.KeyCache
+	for _, backend := range []string{config.KeyCacheFile, config.KeyCacheKeyring} {
+		cfg := config.DefaultConfig(configDir)
+		cfg.Security.KeyCache = backend
+		cache, err := cfg.KeyCache()
+		if err != nil {
+			continue
+		}
+		if err := cache.Store(key, time.Minute); err != nil {
+			continue
+		}
+		caches = append(caches, cache)
+	}
+	if len(caches) == 0 {
+		t.Fatal("Expected at least the file cache to be usable")
+	}
+
+	if err := runLockNow(lockNowCmd, nil); err != nil {
+		t.Fatalf("lock-now failed: %v", err)
+	}
+
+	for _, cache := range caches {
+		if _, err := cache.Load(); err == nil {
+			t.Errorf("Expected %T to be cleared", cache)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/config"
+	"github.com/mbeniwal-imwe/ark/internal/core/password"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// passwdCmd represents the passwd command
+var passwdCmd = &cobra.Command{
+	Use:   "passwd",
+	Short: "Change the master password",
+	Long: `Change the master password.
+
+The records are encrypted with a data key that the master password only wraps,
+so by default just the password key slot is rewritten. With --rotate-data-key
+every record is also re-encrypted under a fresh data key, in a single
+transaction into a new database file that atomically replaces the old one;
+this revokes all other key slots. If anything fails the database and
+configuration are left as they were.
+
+Backups are encrypted with a backup key kept in the database rather than the
+master key, so existing backups still restore after the change.`,
+	RunE: runPasswd,
+}
+
+var rotateDataKey bool
+
+func init() {
+	rootCmd.AddCommand(passwdCmd)
+	passwdCmd.Flags().BoolVar(&rotateDataKey, "rotate-data-key", false, "Also re-encrypt every record under a new data key")
+}
+
+func runPasswd(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(GetConfigDir())
+	if err != nil {
+		return err
+	}
+
+	// Always ask, even if the key is cached: the old password must be verified
+	oldPassword, err := password.GetMasterPassword()
+	if err != nil {
+		return err
+	}
+	defer oldPassword.Close()
+
+	newPassword, err := password.GetNewMasterPassword(cfg.Security.MinScore())
+	if err != nil {
+		return err
+	}
+	defer newPassword.Close()
+	if subtle.ConstantTimeCompare(newPassword.Bytes(), oldPassword.Bytes()) == 1 {
+		return fmt.Errorf("new password must differ from the current one")
+	}
+
+	if err := changeMasterPassword(cfg, oldPassword.Bytes(), newPassword.Bytes(), rotateDataKey, os.Stderr); err != nil {
+		return err
+	}
+
+	fmt.Println("✅ Master password changed")
+	if rotateDataKey {
+		fmt.Println("Note: other key slots were revoked.")
+	}
+	return nil
+}
+
+// changeMasterPassword wraps the data key under a key derived from
+// newPassword, optionally rotating the data key itself, and saves the new
+// salt, rolling back if either step fails
+func changeMasterPassword(cfg *config.Config, oldPassword, newPassword []byte, rotate bool, progressOut io.Writer) error {
+	oldKey, err := cfg.Unlock(oldPassword)
+	if err != nil {
+		return err
+	}
+
+	db, err := cfg.OpenDatabase(oldKey)
+	if errors.Is(err, storage.ErrInvalidKey) {
+		return fmt.Errorf("incorrect master password")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	// Keep the old key so restored backups whose key slots it wraps still open
+	if err := db.RetireKey(oldKey); err != nil {
+		return err
+	}
+
+	// SetMasterPassword replaces all of these, and a failure below puts them back
+	oldSalt, oldKDF, oldVerifier, oldBackupKey := cfg.Salt, cfg.KDF, cfg.Verifier, cfg.Backup.EncryptionKey
+	rollback := func() {
+		cfg.Salt, cfg.KDF, cfg.Verifier, cfg.Backup.EncryptionKey = oldSalt, oldKDF, oldVerifier, oldBackupKey
+		cfg.MasterKey = oldKey
+	}
+	if err := cfg.SetMasterPassword(newPassword); err != nil {
+		rollback()
+		return err
+	}
+
+	if !rotate {
+		slotID := db.UnlockedSlot()
+		if err := db.RewrapKeySlot(slotID, cfg.MasterKey); err != nil {
+			rollback()
+			return fmt.Errorf("failed to update key slot: %w", err)
+		}
+		if err := cfg.Save(); err != nil {
+			rollback()
+			if rollbackErr := db.RewrapKeySlot(slotID, oldKey); rollbackErr != nil {
+				return fmt.Errorf("failed to save configuration: %w (rollback failed: %v)", err, rollbackErr)
+			}
+			return fmt.Errorf("failed to save configuration: %w", err)
+		}
+
+		// Re-key the cache so the next command does not prompt again
+		cfg.CacheMasterKey(cfg.MasterKey)
+		return nil
+	}
+
+	progress := func(done, total int) {
+		// Only worth reporting on large databases
+		if total < 1000 || (done%100 != 0 && done != total) {
+			return
+		}
+		fmt.Fprintf(progressOut, "\rRe-encrypting records: %d/%d", done, total)
+		if done == total {
+			fmt.Fprintln(progressOut)
+		}
+	}
+
+	if err := db.Rekey(cfg.MasterKey, progress); err != nil {
+		rollback()
+		return fmt.Errorf("failed to re-encrypt database: %w", err)
+	}
+
+	if err := cfg.Save(); err != nil {
+		rollback()
+		db.Close()
+		if restoreErr := storage.RestoreRekeyBackup(cfg.DatabasePath); restoreErr != nil {
+			return fmt.Errorf("failed to save configuration: %w (%v; the previous database is at %s)",
+				err, restoreErr, storage.BackupPath(cfg.DatabasePath))
+		}
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	if err := storage.RemoveRekeyBackup(cfg.DatabasePath); err != nil {
+		fmt.Fprintf(progressOut, "Warning: failed to remove %s: %v\n", storage.BackupPath(cfg.DatabasePath), err)
+	}
+
+	// Re-key the cache so the next command does not prompt again
+	cfg.CacheMasterKey(cfg.MasterKey)
+	return nil
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/config"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+)
+
+// setupTestInitializedConfig creates an initialized installation with a few records
+func setupTestInitializedConfig(t *testing.T, configDir, masterPassword string) *config.Config {
+	t.Helper()
+	cfg, err := config.Initialize(configDir, []byte(masterPassword))
+	if err != nil {
+		t.Fatalf("Failed to initialize config: %v", err)
+	}
+	cfg.Security.KeyCache = config.KeyCacheNone
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	db, err := storage.NewDatabase(cfg.DatabasePath, cfg.MasterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	for _, key := range []string{"alpha", "beta", "gamma"} {
+		if err := db.Set("vault", key, "secret-"+key); err != nil {
+			t.Fatalf("Failed to store %s: %v", key, err)
+		}
+	}
+	db.Set("aws_profiles", "dev", map[string]string{"name": "dev"})
+	return cfg
+}
+
+func TestChangeMasterPassword(t *testing.T) {
+	for _, rotate := range []bool{false, true} {
+		t.Run(fmt.Sprintf("rotate=%v", rotate), func(t *testing.T) {
+			testChangeMasterPassword(t, rotate)
+		})
+	}
+}
+
+func testChangeMasterPassword(t *testing.T, rotate bool) {
+	configDir := setupTestConfigDir(t)
+	defer cleanupTestConfigDir(t, configDir)
+	cfg := setupTestInitializedConfig(t, configDir, "OldPassword123!")
+
+	before, err := storage.NewDatabase(cfg.DatabasePath, cfg.MasterKey)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	backupKey, _ := before.BackupKey()
+	before.Close()
+
+	if err := changeMasterPassword(cfg, []byte("OldPassword123!"), []byte("NewPassword456!"), rotate, io.Discard); err != nil {
+		t.Fatalf("changeMasterPassword failed: %v", err)
+	}
+
+	if _, err := os.Stat(storage.BackupPath(cfg.DatabasePath)); !os.IsNotExist(err) {
+		t.Error("Expected rekey backup to be removed")
+	}
+
+	// Reload from disk: the new salt and password must open every record
+	loaded, err := config.Load(configDir)
+	if err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	newKey, _ := loaded.DeriveMasterKey([]byte("NewPassword456!"))
+	db, err := storage.NewDatabase(loaded.DatabasePath, newKey)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	for _, key := range []string{"alpha", "beta", "gamma"} {
+		var value string
+		if err := db.Get("vault", key, &value); err != nil {
+			t.Errorf("Failed to read %s with new key: %v", key, err)
+		} else if value != "secret-"+key {
+			t.Errorf("Expected 'secret-%s', got '%s'", key, value)
+		}
+	}
+	var prof map[string]string
+	if err := db.Get("aws_profiles", "dev", &prof); err != nil {
+		t.Errorf("Failed to read aws profile with new key: %v", err)
+	}
+
+	// Backups stay encrypted with the same key
+	if key, err := db.BackupKey(); err != nil || !bytes.Equal(key, backupKey) {
+		t.Errorf("Expected the backup key to survive the password change (%v)", err)
+	}
+
+	// The old password derives a different key under the new salt
+	oldKey, _ := loaded.DeriveMasterKey([]byte("OldPassword123!"))
+	if bytes.Equal(oldKey, newKey) {
+		t.Error("Expected old and new keys to differ")
+	}
+}
+
+func TestChangeMasterPasswordWrongPassword(t *testing.T) {
+	configDir := setupTestConfigDir(t)
+	defer cleanupTestConfigDir(t, configDir)
+	cfg := setupTestInitializedConfig(t, configDir, "OldPassword123!")
+	originalSalt := append([]byte(nil), cfg.Salt...)
+
+	err := changeMasterPassword(cfg, []byte("WrongPassword!"), []byte("NewPassword456!"), false, io.Discard)
+	if err == nil || err.Error() != "incorrect master password" {
+		t.Fatalf("Expected 'incorrect master password', got %v", err)
+	}
+
+	// Nothing changed on disk
+	loaded, err := config.Load(configDir)
+	if err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	if !bytes.Equal(loaded.Salt, originalSalt) {
+		t.Error("Expected salt to be unchanged after a failed change")
+	}
+
+	oldKey, _ := loaded.DeriveMasterKey([]byte("OldPassword123!"))
+	db, err := storage.NewDatabase(loaded.DatabasePath, oldKey)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	var value string
+	if err := db.Get("vault", "alpha", &value); err != nil || value != "secret-alpha" {
+		t.Errorf("Expected database to be readable with the old key, got %q (%v)", value, err)
+	}
+}
+
+func TestChangeMasterPasswordSaveFailure(t *testing.T) {
+	for _, rotate := range []bool{false, true} {
+		t.Run(fmt.Sprintf("rotate=%v", rotate), func(t *testing.T) {
+			configDir := setupTestConfigDir(t)
+			defer cleanupTestConfigDir(t, configDir)
+			cfg := setupTestInitializedConfig(t, configDir, "OldPassword123!")
+			before := *cfg
+
+			// A directory in place of the config file makes Save fail
+			configFile := filepath.Join(configDir, "config.yaml")
+			os.Remove(configFile)
+			os.Mkdir(configFile, 0700)
+
+			if err := changeMasterPassword(cfg, []byte("OldPassword123!"), []byte("NewPassword456!"), rotate, io.Discard); err == nil {
+				t.Fatal("Expected changeMasterPassword to fail")
+			}
+
+			// The configuration in memory is back to the old password
+			if !bytes.Equal(cfg.Salt, before.Salt) || cfg.KDF != before.KDF ||
+				!bytes.Equal(cfg.Verifier, before.Verifier) ||
+				!bytes.Equal(cfg.Backup.EncryptionKey, before.Backup.EncryptionKey) {
+				t.Error("Expected the configuration to be rolled back")
+			}
+			oldKey, err := cfg.Unlock([]byte("OldPassword123!"))
+			if err != nil {
+				t.Fatalf("Expected the old password to unlock the configuration: %v", err)
+			}
+			db, err := storage.NewDatabase(cfg.DatabasePath, oldKey)
+			if err != nil {
+				t.Fatalf("Failed to open database: %v", err)
+			}
+			defer db.Close()
+			var value string
+			if err := db.Get("vault", "alpha", &value); err != nil || value != "secret-alpha" {
+				t.Errorf("Expected database to be readable with the old key, got %q (%v)", value, err)
+			}
+		})
+	}
+}
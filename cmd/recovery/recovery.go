@@ -0,0 +1,229 @@
+package recovery
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/config"
+	"github.com/mbeniwal-imwe/ark/internal/core/password"
+	"github.com/mbeniwal-imwe/ark/internal/features/recovery"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	showQR     bool
+	numShares  int
+	threshold  int
+	fromShares bool
+)
+
+// RecoveryCmd manages ways to regain access without the master password
+var RecoveryCmd = &cobra.Command{
+	Use:   "recovery",
+	Short: "Recover access if the master password is forgotten",
+	Long: `Recovery codes and Shamir shares unlock the database through their own key
+slots, so a forgotten master password does not mean losing ark.db.
+
+Each code is shown once. Store it offline; anyone holding it (or enough
+shares) can read your data.`,
+}
+
+var createCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a one-time recovery code",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDatabase(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		code, slot, err := recovery.CreateCode(db)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("🔑 Recovery code (shown only once - write it down and keep it offline):")
+		fmt.Println()
+		fmt.Printf("    %s\n", code)
+		fmt.Println()
+		if err := printQR(code); err != nil {
+			return err
+		}
+		fmt.Printf("Key slot: %s. Restore with 'ark recovery restore'.\n", slot.ID)
+		return nil
+	},
+}
+
+var splitCmd = &cobra.Command{
+	Use:   "split",
+	Short: "Create a recovery key split into Shamir shares",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDatabase(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		shares, slot, err := recovery.CreateShares(db, numShares, threshold)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("🔑 %d recovery shares - any %d restore access. Give each to a different person.\n", numShares, threshold)
+		fmt.Println("They are shown only once.")
+		for i, share := range shares {
+			fmt.Println()
+			fmt.Printf("Share %d of %d:\n    %s\n", i+1, numShares, share)
+			if err := printQR(share); err != nil {
+				return err
+			}
+		}
+		fmt.Println()
+		fmt.Printf("Key slot: %s. Restore with 'ark recovery restore --shares'.\n", slot.ID)
+		return nil
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Regain access with a recovery code and set a new master password",
+	Long: `Unlock the database with a recovery code (or, with --shares, enough Shamir
+shares) and set a new master password. The recovery code is used up;
+create a new one afterwards.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfgDir := cmd.Root().PersistentFlags().Lookup("config-dir").Value.String()
+		cfg, err := config.Load(cfgDir)
+		if err != nil {
+			return err
+		}
+
+		in := bufio.NewReader(os.Stdin)
+		var secret []byte
+		if fromShares {
+			secret, err = readShares(in, os.Stderr)
+		} else {
+			fmt.Fprint(os.Stderr, "Enter recovery code: ")
+			var line string
+			line, err = in.ReadString('\n')
+			if err == nil || err == io.EOF {
+				secret, err = recovery.ParseCode(line)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		newPassword, err := password.GetNewMasterPassword(cfg.Security.MinScore())
+		if err != nil {
+			return err
+		}
+		defer newPassword.Close()
+
+		if err := restoreAccess(cfg, secret, newPassword.Bytes()); err != nil {
+			return err
+		}
+		fmt.Println("✅ Access restored and master password changed")
+		fmt.Println("The recovery code was used up - run 'ark recovery create' for a new one.")
+		return nil
+	},
+}
+
+// readShares prompts for shares until the threshold they carry is reached
+func readShares(in *bufio.Reader, prompt io.Writer) ([]byte, error) {
+	var shares [][]byte
+	needed := 0
+	for needed == 0 || len(shares) < needed {
+		if needed == 0 {
+			fmt.Fprint(prompt, "Enter share: ")
+		} else {
+			fmt.Fprintf(prompt, "Enter share (%d of %d): ", len(shares)+1, needed)
+		}
+		line, err := in.ReadString('\n')
+		if err != nil && (err != io.EOF || strings.TrimSpace(line) == "") {
+			return nil, fmt.Errorf("failed to read share: %w", err)
+		}
+
+		share, n, err := recovery.ParseShare(line)
+		if err != nil {
+			return nil, err
+		}
+		if needed != 0 && n != needed {
+			return nil, fmt.Errorf("share belongs to a different split")
+		}
+		needed = n
+		shares = append(shares, share)
+	}
+	return recovery.CombineShares(shares)
+}
+
+// restoreAccess unlocks the database with a recovery secret, puts a new
+// master password in place and uses up the recovery slot
+func restoreAccess(cfg *config.Config, secret, newPassword []byte) error {
+	db, err := recovery.Open(cfg.DatabasePath, secret)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	usedSlot := db.UnlockedSlot()
+
+	if err := cfg.SetMasterPassword(newPassword); err != nil {
+		return err
+	}
+	if err := db.SetPasswordSlot(cfg.MasterKey); err != nil {
+		return fmt.Errorf("failed to update password key slot: %w", err)
+	}
+	// If saving fails the recovery slot still works, so the restore can be retried
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	if err := db.RemoveKeySlot(usedSlot); err != nil {
+		return fmt.Errorf("access restored, but failed to remove used recovery slot %s: %w", usedSlot, err)
+	}
+	return nil
+}
+
+// printQR prints text as a QR code when --qr is set
+func printQR(text string) error {
+	if !showQR {
+		return nil
+	}
+	code, err := recovery.QR(text)
+	if err != nil {
+		return err
+	}
+	fmt.Print(code)
+	return nil
+}
+
+// openDatabase unlocks the database for the configured installation
+func openDatabase(cmd *cobra.Command) (*storage.Database, error) {
+	cfgDir := cmd.Root().PersistentFlags().Lookup("config-dir").Value.String()
+	cfg, err := config.Load(cfgDir)
+	if err != nil {
+		return nil, err
+	}
+
+	masterKey, err := cfg.GetMasterKey()
+	if err != nil {
+		return nil, err
+	}
+	return cfg.OpenDatabase(masterKey)
+}
+
+func init() {
+	RecoveryCmd.AddCommand(createCmd)
+	RecoveryCmd.AddCommand(splitCmd)
+	RecoveryCmd.AddCommand(restoreCmd)
+
+	createCmd.Flags().BoolVar(&showQR, "qr", false, "Also print the code as a QR code")
+	splitCmd.Flags().BoolVar(&showQR, "qr", false, "Also print each share as a QR code")
+	splitCmd.Flags().IntVar(&numShares, "shares", 5, "Number of shares to create")
+	splitCmd.Flags().IntVar(&threshold, "threshold", 3, "Number of shares needed to restore")
+	restoreCmd.Flags().BoolVar(&fromShares, "shares", false, "Restore from Shamir shares instead of a recovery code")
+}
@@ -0,0 +1,185 @@
+package recovery
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/config"
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+	"github.com/mbeniwal-imwe/ark/internal/features/recovery"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+)
+
+// setupTestRecoveryEnvironment creates an initialized installation with one record
+func setupTestRecoveryEnvironment(t *testing.T) (*config.Config, func()) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "ark-recovery-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	os.MkdirAll(filepath.Join(dir, "data"), 0700)
+
+	cfg, err := config.Initialize(dir, []byte("TestPassword123!"))
+	if err != nil {
+		t.Fatalf("Failed to initialize config: %v", err)
+	}
+	cfg.Security.KeyCache = config.KeyCacheNone
+	cfg.Save()
+
+	db, err := storage.NewDatabase(cfg.DatabasePath, cfg.MasterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Set("vault", "k", "v")
+	db.Close()
+
+	return cfg, func() { os.RemoveAll(dir) }
+}
+
+func TestShamirSplitAndCombine(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	shares, err := crypto.SplitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("SplitSecret failed: %v", err)
+	}
+
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var picked [][]byte
+		for _, i := range subset {
+			picked = append(picked, shares[i])
+		}
+		got, err := crypto.CombineShares(picked)
+		if err != nil {
+			t.Fatalf("CombineShares(%v) failed: %v", subset, err)
+		}
+		if !bytes.Equal(got, secret) {
+			t.Errorf("CombineShares(%v) = %q, expected %q", subset, got, secret)
+		}
+	}
+
+	// Below the threshold the secret stays hidden
+	got, _ := crypto.CombineShares(shares[:2])
+	if bytes.Equal(got, secret) {
+		t.Error("Expected 2 of 3 shares not to reveal the secret")
+	}
+
+	if _, err := crypto.SplitSecret(secret, 2, 3); err == nil {
+		t.Error("Expected error for threshold above share count, but got none")
+	}
+	if _, err := crypto.CombineShares([][]byte{shares[0], shares[0]}); err == nil {
+		t.Error("Expected error for duplicate shares, but got none")
+	}
+}
+
+func TestRecoveryCodeEncoding(t *testing.T) {
+	secret, _ := crypto.GenerateRecoverySecret()
+	code := crypto.EncodeRecoveryCode(secret)
+
+	// Case and separators don't matter
+	sloppy := strings.ToLower(strings.ReplaceAll(code, "-", " "))
+	got, err := recovery.ParseCode(sloppy)
+	if err != nil {
+		t.Fatalf("ParseCode failed: %v", err)
+	}
+	if !bytes.Equal(got, secret) {
+		t.Error("Expected decoded code to match the secret")
+	}
+
+	// A typo is caught by the checksum
+	typo := []byte(code)
+	if typo[0] == 'A' {
+		typo[0] = 'B'
+	} else {
+		typo[0] = 'A'
+	}
+	if _, err := recovery.ParseCode(string(typo)); err == nil {
+		t.Error("Expected error for a mistyped code, but got none")
+	}
+}
+
+func TestRestoreWithRecoveryCode(t *testing.T) {
+	cfg, cleanup := setupTestRecoveryEnvironment(t)
+	defer cleanup()
+
+	db, _ := storage.NewDatabase(cfg.DatabasePath, cfg.MasterKey)
+	code, _, err := recovery.CreateCode(db)
+	db.Close()
+	if err != nil {
+		t.Fatalf("CreateCode failed: %v", err)
+	}
+
+	// The password is forgotten; restore with the code
+	loaded, _ := config.Load(cfg.ConfigDir)
+	secret, err := recovery.ParseCode(code)
+	if err != nil {
+		t.Fatalf("ParseCode failed: %v", err)
+	}
+	if err := restoreAccess(loaded, secret, []byte("NewPassword456!")); err != nil {
+		t.Fatalf("restoreAccess failed: %v", err)
+	}
+
+	reloaded, _ := config.Load(cfg.ConfigDir)
+	key, err := reloaded.Unlock([]byte("NewPassword456!"))
+	if err != nil {
+		t.Fatalf("Unlock with new password failed: %v", err)
+	}
+	db, err = storage.NewDatabase(reloaded.DatabasePath, key)
+	if err != nil {
+		t.Fatalf("Failed to open database with new password: %v", err)
+	}
+	var value string
+	if err := db.Get("vault", "k", &value); err != nil || value != "v" {
+		t.Errorf("Expected 'v', got %q (%v)", value, err)
+	}
+	db.Close()
+
+	// The code is used up
+	if err := restoreAccess(reloaded, secret, []byte("OtherPassword789!")); err == nil {
+		t.Error("Expected a used recovery code to be rejected")
+	}
+}
+
+func TestRestoreWithShares(t *testing.T) {
+	cfg, cleanup := setupTestRecoveryEnvironment(t)
+	defer cleanup()
+
+	db, _ := storage.NewDatabase(cfg.DatabasePath, cfg.MasterKey)
+	shares, _, err := recovery.CreateShares(db, 5, 3)
+	db.Close()
+	if err != nil {
+		t.Fatalf("CreateShares failed: %v", err)
+	}
+
+	input := bufio.NewReader(strings.NewReader(shares[4] + "\n" + shares[1] + "\n" + shares[2] + "\n"))
+	secret, err := readShares(input, io.Discard)
+	if err != nil {
+		t.Fatalf("readShares failed: %v", err)
+	}
+
+	loaded, _ := config.Load(cfg.ConfigDir)
+	if err := restoreAccess(loaded, secret, []byte("NewPassword456!")); err != nil {
+		t.Fatalf("restoreAccess failed: %v", err)
+	}
+
+	// Two shares are not enough
+	input = bufio.NewReader(strings.NewReader(shares[0] + "\n" + shares[3] + "\n"))
+	if _, err := readShares(input, io.Discard); err == nil {
+		t.Error("Expected error with too few shares, but got none")
+	}
+}
+
+func TestRecoveryQR(t *testing.T) {
+	out, err := recovery.QR("ABCD-EFGH-IJKL")
+	if err != nil {
+		t.Fatalf("QR failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) < 10 || !strings.Contains(out, "█") {
+		t.Errorf("Expected a rendered QR code, got:\n%s", out)
+	}
+}
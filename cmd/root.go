@@ -5,14 +5,23 @@ import (
 	"os"
 	"path/filepath"
 
+	agentCmd "github.com/mbeniwal-imwe/ark/cmd/agent"
 	awsCmd "github.com/mbeniwal-imwe/ark/cmd/aws"
 	"github.com/mbeniwal-imwe/ark/cmd/backup"
 	"github.com/mbeniwal-imwe/ark/cmd/caffeinate"
+	dbCmd "github.com/mbeniwal-imwe/ark/cmd/db"
+	"github.com/mbeniwal-imwe/ark/cmd/dockercred"
 	ec2Cmd "github.com/mbeniwal-imwe/ark/cmd/ec2"
+	"github.com/mbeniwal-imwe/ark/cmd/gitcred"
 	"github.com/mbeniwal-imwe/ark/cmd/lock"
 	"github.com/mbeniwal-imwe/ark/cmd/logs"
+	recoveryCmd "github.com/mbeniwal-imwe/ark/cmd/recovery"
 	s3cmd "github.com/mbeniwal-imwe/ark/cmd/s3"
+	"github.com/mbeniwal-imwe/ark/cmd/security"
 	"github.com/mbeniwal-imwe/ark/cmd/vault"
+	"github.com/mbeniwal-imwe/ark/internal/core/config"
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
 	"github.com/spf13/cobra"
 )
 
@@ -40,10 +49,30 @@ var rootCmd = &cobra.Command{
 
 Built with security and user experience as top priorities.`,
 	// Version is handled by the version command
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// Processes waiting for the database report who holds it
+		storage.SetLockOwner(cmd.CommandPath())
+	},
+}
+
+// helperAliases maps the names ark can be linked as to the subcommand they run,
+// so external tools that look up helpers by binary name reach ark directly
+var helperAliases = map[string]string{
+	"git-credential-ark":    gitcred.GitCredentialCmd.Name(),
+	"docker-credential-ark": dockercred.DockerCredentialCmd.Name(),
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 func Execute() error {
+	// Core dumps would contain any key material in memory
+	if err := crypto.DisableCoreDumps(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	defer config.WipeMasterKeys()
+
+	if sub, ok := helperAliases[filepath.Base(os.Args[0])]; ok {
+		rootCmd.SetArgs(append([]string{sub}, os.Args[1:]...))
+	}
 	return rootCmd.Execute()
 }
 
@@ -60,6 +89,7 @@ func init() {
 
 	configDir := filepath.Join(homeDir, ".ark")
 	rootCmd.PersistentFlags().String("config-dir", configDir, "Configuration directory")
+	rootCmd.PersistentFlags().StringVar(&config.KeyfileOverride, "keyfile", "", "Keyfile to unlock with (default is security.keyfile)")
 
 	// Add subcommands
 	rootCmd.AddCommand(vault.VaultCmd)
@@ -70,6 +100,12 @@ func init() {
 	rootCmd.AddCommand(s3cmd.S3Cmd)
 	rootCmd.AddCommand(backup.BackupCmd)
 	rootCmd.AddCommand(logs.LogsCmd)
+	rootCmd.AddCommand(gitcred.GitCredentialCmd)
+	rootCmd.AddCommand(dockercred.DockerCredentialCmd)
+	rootCmd.AddCommand(agentCmd.AgentCmd)
+	rootCmd.AddCommand(security.SecurityCmd)
+	rootCmd.AddCommand(recoveryCmd.RecoveryCmd)
+	rootCmd.AddCommand(dbCmd.DBCmd)
 }
 
 // GetConfigDir returns the configuration directory path
@@ -8,13 +8,15 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/mbeniwal-imwe/ark/internal/core/config"
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
 	awsfeat "github.com/mbeniwal-imwe/ark/internal/features/aws"
-	"github.com/mbeniwal-imwe/ark/internal/storage"
 	"github.com/spf13/cobra"
 )
 
 var (
 	profileName string
+	encrypt     bool
+	decrypt     bool
 )
 
 var S3Cmd = &cobra.Command{
@@ -35,7 +37,7 @@ var bucketsCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		db, err := storage.NewDatabase(cfg.DatabasePath, masterKey)
+		db, err := cfg.OpenDatabaseReadOnly(masterKey)
 		if err != nil {
 			return err
 		}
@@ -88,7 +90,7 @@ var lsCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		db, err := storage.NewDatabase(cfg.DatabasePath, masterKey)
+		db, err := cfg.OpenDatabaseReadOnly(masterKey)
 		if err != nil {
 			return err
 		}
@@ -139,7 +141,7 @@ var uploadCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		db, err := storage.NewDatabase(cfg.DatabasePath, masterKey)
+		db, err := cfg.OpenDatabase(masterKey)
 		if err != nil {
 			return err
 		}
@@ -156,7 +158,18 @@ var uploadCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		if err := s3svc.UploadFile(context.Background(), local, bucket, key); err != nil {
+		if encrypt {
+			// The backup key outlives master password changes
+			backupKey, keyErr := db.BackupKey()
+			if keyErr != nil {
+				return keyErr
+			}
+			defer crypto.Wipe(backupKey)
+			err = s3svc.UploadFileEncrypted(context.Background(), local, bucket, key, backupKey, db.Cipher())
+		} else {
+			err = s3svc.UploadFile(context.Background(), local, bucket, key)
+		}
+		if err != nil {
 			return err
 		}
 		fmt.Printf("✅ Uploaded %s to s3://%s/%s\n", filepath.Base(local), bucket, key)
@@ -181,7 +194,7 @@ var downloadCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		db, err := storage.NewDatabase(cfg.DatabasePath, masterKey)
+		db, err := cfg.OpenDatabaseReadOnly(masterKey)
 		if err != nil {
 			return err
 		}
@@ -198,7 +211,22 @@ var downloadCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		if err := s3svc.DownloadFile(context.Background(), bucket, key, local); err != nil {
+		if decrypt {
+			// Objects uploaded before backup keys existed use a master key
+			keys, keyErr := db.BackupKeys()
+			if keyErr != nil {
+				return keyErr
+			}
+			defer func() {
+				for _, k := range keys {
+					crypto.Wipe(k)
+				}
+			}()
+			err = s3svc.DownloadFileDecrypted(context.Background(), bucket, key, local, append([][]byte{masterKey}, keys...))
+		} else {
+			err = s3svc.DownloadFile(context.Background(), bucket, key, local)
+		}
+		if err != nil {
 			return err
 		}
 		fmt.Printf("✅ Downloaded s3://%s/%s to %s\n", bucket, key, local)
@@ -214,4 +242,6 @@ func init() {
 	for _, c := range []*cobra.Command{bucketsCmd, lsCmd, uploadCmd, downloadCmd} {
 		c.Flags().StringVarP(&profileName, "profile", "p", "", "AWS profile to use")
 	}
+	uploadCmd.Flags().BoolVar(&encrypt, "encrypt", false, "Encrypt the file client-side with the backup key")
+	downloadCmd.Flags().BoolVar(&decrypt, "decrypt", false, "Decrypt an object uploaded with --encrypt")
 }
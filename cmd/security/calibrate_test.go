@@ -0,0 +1,98 @@
+package security
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/config"
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+)
+
+func TestCalibrateKDF(t *testing.T) {
+	params, elapsed, err := crypto.CalibrateKDF(50*time.Millisecond, 19*1024)
+	if err != nil {
+		t.Fatalf("CalibrateKDF failed: %v", err)
+	}
+	if err := params.Validate(); err != nil {
+		t.Errorf("Calibrated parameters are invalid: %v", err)
+	}
+	if params.MemoryKiB > 19*1024 {
+		t.Errorf("Expected at most 19MiB, got %dKiB", params.MemoryKiB)
+	}
+	if elapsed <= 0 {
+		t.Errorf("Expected a measured duration, got %s", elapsed)
+	}
+
+	if _, _, err := crypto.CalibrateKDF(time.Second, 1024); err == nil {
+		t.Error("Expected error for too little memory, but got none")
+	}
+}
+
+func TestUnlockMigratesKDFParams(t *testing.T) {
+	dir, err := os.MkdirTemp("", "ark-kdf-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(dir+"/data", 0700)
+
+	// An installation from before parameters were recorded
+	cfg := config.DefaultConfig(dir)
+	cfg.Salt, _ = crypto.GenerateSalt()
+	cfg.Save()
+	legacyKey, _ := crypto.DeriveKey("TestPassword123!", cfg.Salt)
+	db, err := storage.NewDatabase(cfg.DatabasePath, legacyKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Set("vault", "k", "v")
+	db.Close()
+
+	cfg, _ = config.Load(dir)
+	if cfg.KDFParams() != crypto.LegacyKDFParams {
+		t.Fatalf("Expected legacy parameters, got %s", cfg.KDFParams())
+	}
+
+	// Calibrated target, as saved by 'ark security calibrate'
+	target := crypto.KDFParams{Version: crypto.KDFArgon2id, Time: 2, MemoryKiB: 19 * 1024, Threads: 1}
+	cfg.Security.KDFTarget = &target
+
+	key, err := cfg.Unlock([]byte("TestPassword123!"))
+	if err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+
+	reloaded, _ := config.Load(dir)
+	if reloaded.KDF != target {
+		t.Errorf("Expected recorded parameters %s, got %s", target, reloaded.KDF)
+	}
+	expected, _ := crypto.DeriveKeyWithParams("TestPassword123!", reloaded.Salt, target)
+	if string(key) != string(expected) {
+		t.Error("Expected Unlock to return the key derived with the new parameters")
+	}
+
+	// The new key opens the existing data; the legacy one no longer does
+	db, err = storage.NewDatabase(reloaded.DatabasePath, key)
+	if err != nil {
+		t.Fatalf("Failed to open database with migrated key: %v", err)
+	}
+	var value string
+	if err := db.Get("vault", "k", &value); err != nil || value != "v" {
+		t.Errorf("Expected 'v', got %q (%v)", value, err)
+	}
+	db.Close()
+	if _, err := storage.NewDatabase(reloaded.DatabasePath, legacyKey); err == nil {
+		t.Error("Expected legacy key to be rejected after migration")
+	}
+
+	// Unlocking again with matching parameters changes nothing
+	saltBefore := string(reloaded.Salt)
+	if _, err := reloaded.Unlock([]byte("TestPassword123!")); err != nil {
+		t.Fatalf("Second unlock failed: %v", err)
+	}
+	if string(reloaded.Salt) != saltBefore {
+		t.Error("Expected no migration when parameters already match")
+	}
+}
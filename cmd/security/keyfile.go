@@ -0,0 +1,102 @@
+package security
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/config"
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+	"github.com/mbeniwal-imwe/ark/internal/core/password"
+	"github.com/spf13/cobra"
+)
+
+var addKeyfileCmd = &cobra.Command{
+	Use:   "add-keyfile <path>",
+	Short: "Require a keyfile in addition to the master password",
+	Long: `Mix the contents of a keyfile into the master key, so unlocking needs both
+the master password and the keyfile (for example one kept on a USB stick).
+
+A new random keyfile is generated when <path> does not exist; any existing
+file can also serve as a keyfile, as long as its contents never change.
+The path is saved as security.keyfile and can be overridden with --keyfile.
+
+Keep a copy of the keyfile: without it the database can only be opened
+with a recovery code.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfgDir := cmd.Root().PersistentFlags().Lookup("config-dir").Value.String()
+		cfg, err := config.Load(cfgDir)
+		if err != nil {
+			return err
+		}
+
+		masterPassword, err := password.GetMasterPassword()
+		if err != nil {
+			return err
+		}
+		defer masterPassword.Close()
+
+		created, err := addKeyfile(cfg, masterPassword.Bytes(), args[0])
+		if err != nil {
+			return err
+		}
+		if created {
+			fmt.Printf("🔑 Generated keyfile %s\n", cfg.Security.Keyfile)
+		}
+		fmt.Println("✅ Keyfile added. Keep a copy somewhere safe - it is now needed to unlock.")
+		return nil
+	},
+}
+
+// addKeyfile makes the keyfile at path a second unlock factor and re-wraps
+// the password key slot with the combined key
+func addKeyfile(cfg *config.Config, masterPassword []byte, path string) (bool, error) {
+	oldKey, err := cfg.Unlock(masterPassword)
+	if err != nil {
+		return false, err
+	}
+
+	db, err := cfg.OpenDatabase(oldKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	created := false
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := crypto.GenerateKeyfile(path); err != nil {
+			return false, err
+		}
+		created = true
+	}
+
+	previous, previousVerifier := cfg.Security, cfg.Verifier
+	newKey, err := cfg.UseKeyfile(path, masterPassword)
+	if err != nil {
+		return false, err
+	}
+
+	if err := db.RetireKey(oldKey); err != nil {
+		cfg.Security, cfg.Verifier, cfg.MasterKey = previous, previousVerifier, oldKey
+		return false, err
+	}
+	slot := db.UnlockedSlot()
+	if err := db.RewrapKeySlot(slot, newKey); err != nil {
+		cfg.Security, cfg.Verifier, cfg.MasterKey = previous, previousVerifier, oldKey
+		return false, fmt.Errorf("failed to re-wrap key slot: %w", err)
+	}
+	if err := cfg.Save(); err != nil {
+		// Keep the database and configuration in step
+		db.RewrapKeySlot(slot, oldKey)
+		cfg.Security, cfg.Verifier, cfg.MasterKey = previous, previousVerifier, oldKey
+		return false, fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	config.ClearPasswordCache(cfg.ConfigDir)
+	cfg.CacheMasterKey(newKey)
+	return created, nil
+}
+
+func init() {
+	SecurityCmd.AddCommand(addKeyfileCmd)
+}
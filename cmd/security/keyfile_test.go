@@ -0,0 +1,99 @@
+package security
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/config"
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+)
+
+func TestAddKeyfile(t *testing.T) {
+	cfg, cleanup := setupTestUnlockConfig(t)
+	defer cleanup()
+
+	db, err := storage.NewDatabase(cfg.DatabasePath, cfg.MasterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if err := db.Set("vault", "secret", "value"); err != nil {
+		t.Fatalf("Failed to store record: %v", err)
+	}
+	db.Close()
+
+	path := filepath.Join(cfg.ConfigDir, "ark.key")
+	created, err := addKeyfile(cfg, []byte("TestPassword123!"), path)
+	if err != nil {
+		t.Fatalf("addKeyfile failed: %v", err)
+	}
+	if !created {
+		t.Error("Expected a new keyfile to be generated")
+	}
+
+	// The password alone no longer unlocks the database
+	loaded, err := config.Load(cfg.ConfigDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if !loaded.Security.KeyfileRequired || loaded.Security.Keyfile != path {
+		t.Errorf("Expected keyfile settings to be saved, got %+v", loaded.Security)
+	}
+	passwordOnly, _ := crypto.DeriveKeyWithParams("TestPassword123!", loaded.Salt, loaded.KDFParams())
+	if _, err := storage.NewDatabase(cfg.DatabasePath, passwordOnly); !errors.Is(err, storage.ErrInvalidKey) {
+		t.Errorf("Expected ErrInvalidKey without the keyfile, got %v", err)
+	}
+
+	key, err := loaded.Unlock([]byte("TestPassword123!"))
+	if err != nil {
+		t.Fatalf("Unlock with keyfile failed: %v", err)
+	}
+	db, err = storage.NewDatabase(cfg.DatabasePath, key)
+	if err != nil {
+		t.Fatalf("Failed to open database with keyfile: %v", err)
+	}
+	defer db.Close()
+	var value string
+	if err := db.Get("vault", "secret", &value); err != nil || value != "value" {
+		t.Errorf("Expected stored record to survive, got %q (%v)", value, err)
+	}
+}
+
+func TestUnlockRejectsWrongKeyfile(t *testing.T) {
+	cfg, cleanup := setupTestUnlockConfig(t)
+	defer cleanup()
+
+	path := filepath.Join(cfg.ConfigDir, "ark.key")
+	if _, err := addKeyfile(cfg, []byte("TestPassword123!"), path); err != nil {
+		t.Fatalf("addKeyfile failed: %v", err)
+	}
+
+	other := filepath.Join(cfg.ConfigDir, "other.key")
+	if err := crypto.GenerateKeyfile(other); err != nil {
+		t.Fatalf("Failed to generate keyfile: %v", err)
+	}
+
+	defer func() { config.KeyfileOverride = "" }()
+	config.KeyfileOverride = other
+	if _, err := cfg.Unlock([]byte("TestPassword123!")); !errors.Is(err, config.ErrIncorrectPassword) {
+		t.Errorf("Expected ErrIncorrectPassword with the wrong keyfile, got %v", err)
+	}
+
+	config.KeyfileOverride = filepath.Join(cfg.ConfigDir, "missing.key")
+	if _, err := cfg.Unlock([]byte("TestPassword123!")); err == nil {
+		t.Error("Expected error for a missing keyfile, but got none")
+	}
+
+	// --keyfile takes precedence over the configured path
+	config.KeyfileOverride = path
+	cfg.Security.Keyfile = other
+	key, err := cfg.Unlock([]byte("TestPassword123!"))
+	if err != nil {
+		t.Fatalf("Unlock with --keyfile failed: %v", err)
+	}
+	if !bytes.Equal(key, cfg.MasterKey) {
+		t.Error("Expected Unlock to return the master key")
+	}
+}
@@ -0,0 +1,81 @@
+package security
+
+import (
+	"io"
+	"testing"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+	"go.etcd.io/bbolt"
+)
+
+func TestReencryptDatabase(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestSecurityEnvironment(t)
+	defer cleanup()
+
+	db, err := storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Set("vault", "old", "written with aes")
+	if db.Cipher() != crypto.CipherAESGCM {
+		t.Errorf("Expected new databases to default to AES-GCM, got %d", db.Cipher())
+	}
+
+	if _, err := reencryptDatabase(db, "rot13", io.Discard); err == nil {
+		t.Error("Expected error for an unknown cipher, but got none")
+	}
+
+	suite, err := reencryptDatabase(db, "xchacha20", io.Discard)
+	if err != nil {
+		t.Fatalf("reencryptDatabase failed: %v", err)
+	}
+	if suite.ID != crypto.CipherXChaCha20 {
+		t.Errorf("Expected xchacha20, got %s", suite.Name)
+	}
+	db.Set("vault", "new", "written with xchacha20")
+	db.Close()
+
+	// Every record now names the XChaCha20 suite in its header
+	bdb, err := bbolt.Open(dbPath, 0600, nil)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	bdb.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("vault")).ForEach(func(k, v []byte) error {
+			if len(v) < 2 || v[1] != crypto.CipherXChaCha20 {
+				t.Errorf("Expected %s to be sealed with xchacha20", k)
+			}
+			return nil
+		})
+	})
+	bdb.Close()
+
+	db, err = storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	if db.Cipher() != crypto.CipherXChaCha20 {
+		t.Errorf("Expected cipher to persist, got %d", db.Cipher())
+	}
+	for key, want := range map[string]string{"old": "written with aes", "new": "written with xchacha20"} {
+		var value string
+		if err := db.Get("vault", key, &value); err != nil || value != want {
+			t.Errorf("Expected %q for %s, got %q (%v)", want, key, value, err)
+		}
+	}
+
+	// Rotating the data key keeps the chosen cipher
+	if err := db.Rekey(masterKey, nil); err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+	storage.RemoveRekeyBackup(dbPath)
+	if db.Cipher() != crypto.CipherXChaCha20 {
+		t.Errorf("Expected cipher to survive rekey, got %d", db.Cipher())
+	}
+	var value string
+	if err := db.Get("vault", "old", &value); err != nil || value != "written with aes" {
+		t.Errorf("Expected record to survive rekey, got %q (%v)", value, err)
+	}
+}
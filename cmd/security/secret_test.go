@@ -0,0 +1,113 @@
+package security
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+)
+
+func TestSecretIsWipedOnClose(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	secret := crypto.NewSecret(key)
+
+	if !bytes.Equal(secret.Bytes(), key) {
+		t.Fatal("Secret does not hold a copy of the key")
+	}
+	if &secret.Bytes()[0] == &key[0] {
+		t.Fatal("Secret aliases the caller's buffer")
+	}
+	if secret.String() != "[REDACTED]" {
+		t.Errorf("Secret formats as %q", secret.String())
+	}
+
+	// Keep a heap-backed view to check the wipe without touching unmapped memory
+	if !secret.Locked() {
+		buf := secret.Bytes()
+		secret.Close()
+		if !bytes.Equal(buf, make([]byte, len(buf))) {
+			t.Error("Close did not zero the secret")
+		}
+	} else {
+		secret.Close()
+	}
+
+	if secret.Len() != 0 || secret.Bytes() != nil {
+		t.Error("Closed secret still exposes its bytes")
+	}
+	if err := secret.Close(); err != nil {
+		t.Errorf("Second Close failed: %v", err)
+	}
+}
+
+func TestEncryptorUnusableAfterClose(t *testing.T) {
+	salt, _ := crypto.GenerateSalt()
+	key, _ := crypto.DeriveKey("TestPassword123!", salt)
+
+	enc, err := crypto.NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	ciphertext, err := enc.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	enc.Close()
+
+	if _, err := enc.Decrypt(ciphertext); err == nil {
+		t.Error("Closed encryptor still decrypts")
+	}
+	if _, err := enc.Seal([]byte("secret"), nil); err == nil {
+		t.Error("Closed encryptor still encrypts")
+	}
+}
+
+func TestConfigCloseWipesMasterKey(t *testing.T) {
+	cfg, cleanup := setupTestUnlockConfig(t)
+	defer cleanup()
+
+	key, err := cfg.Unlock([]byte("TestPassword123!"))
+	if err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	keyCopy := append([]byte(nil), key...)
+
+	db, err := storage.NewDatabase(cfg.DatabasePath, key)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.Set("vault", "k", "v"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	db.Close()
+
+	// A closed database has dropped its data key
+	var value string
+	if err := db.Get("vault", "k", &value); err == nil {
+		t.Error("Closed database still decrypts records")
+	}
+
+	held := cfg.MasterKey
+	if err := cfg.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if cfg.MasterKey != nil {
+		t.Error("Close left MasterKey set")
+	}
+	// The configuration owns the key memory, so a slice kept past Close is
+	// zeroed rather than left dangling
+	if len(held) == 0 || !bytes.Equal(held, make([]byte, len(held))) {
+		t.Error("Close did not zero the master key")
+	}
+
+	// Wiping the config does not affect copies the caller made
+	reopened, err := storage.NewDatabase(cfg.DatabasePath, keyCopy)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer reopened.Close()
+	if err := reopened.Get("vault", "k", &value); err != nil || value != "v" {
+		t.Errorf("Get after reopen = %q, %v", value, err)
+	}
+}
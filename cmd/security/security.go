@@ -0,0 +1,149 @@
+package security
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/config"
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// SecurityCmd groups commands that manage how the database is unlocked
+var SecurityCmd = &cobra.Command{
+	Use:   "security",
+	Short: "Manage key slots and key derivation settings",
+}
+
+var keySlotsCmd = &cobra.Command{
+	Use:   "keyslots",
+	Short: "Manage the key slots that unlock the database",
+	Long: `The database is encrypted with a random data key. Each key slot holds that
+data key wrapped by one unlock method - the master password, a recovery code
+or a keyfile - so methods can be added and revoked without re-encrypting.`,
+}
+
+var listSlotsCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List key slots",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDatabase(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		slots, err := db.KeySlots()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTYPE\tCREATED\t")
+		for _, slot := range slots {
+			current := ""
+			if slot.ID == db.UnlockedSlot() {
+				current = "(unlocked with)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", slot.ID, slot.Type, slot.CreatedAt.Format("2006-01-02 15:04"), current)
+		}
+		return w.Flush()
+	},
+}
+
+var removeSlotCmd = &cobra.Command{
+	Use:   "remove <id>",
+	Short: "Revoke a key slot",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDatabase(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		if err := removeKeySlot(db, args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("🗑️  Key slot %s removed\n", args[0])
+		return nil
+	},
+}
+
+var calibrateCmd = &cobra.Command{
+	Use:   "calibrate",
+	Short: "Pick key derivation parameters for this machine",
+	Long: `Benchmark Argon2id on this machine and pick parameters that take about
+--target to derive the master key. The parameters are saved to the
+configuration and applied the next time the master password is entered.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfgDir := cmd.Root().PersistentFlags().Lookup("config-dir").Value.String()
+		cfg, err := config.Load(cfgDir)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Calibrating for %s using up to %dMiB...\n", calibrateTarget, calibrateMemory)
+		params, elapsed, err := crypto.CalibrateKDF(calibrateTarget, uint32(calibrateMemory)*1024)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Current:  %s\n", cfg.KDFParams())
+		fmt.Printf("Selected: %s, %s per unlock\n", params, elapsed.Round(time.Millisecond))
+
+		cfg.Security.KDFTarget = &params
+		if err := cfg.Save(); err != nil {
+			return err
+		}
+		fmt.Println("✅ Saved. The new parameters apply the next time the master password is entered.")
+		return nil
+	},
+}
+
+var (
+	calibrateTarget time.Duration
+	calibrateMemory int
+)
+
+// removeKeySlot revokes a slot, refusing to remove the password slot
+func removeKeySlot(db *storage.Database, id string) error {
+	slots, err := db.KeySlots()
+	if err != nil {
+		return err
+	}
+	for _, slot := range slots {
+		if slot.ID == id && slot.Type == storage.SlotTypePassword {
+			return fmt.Errorf("the password slot cannot be removed; use 'ark passwd' to change it")
+		}
+	}
+	return db.RemoveKeySlot(id)
+}
+
+// openDatabase unlocks the database for the configured installation
+func openDatabase(cmd *cobra.Command) (*storage.Database, error) {
+	cfgDir := cmd.Root().PersistentFlags().Lookup("config-dir").Value.String()
+	cfg, err := config.Load(cfgDir)
+	if err != nil {
+		return nil, err
+	}
+
+	masterKey, err := cfg.GetMasterKey()
+	if err != nil {
+		return nil, err
+	}
+	return cfg.OpenDatabase(masterKey)
+}
+
+func init() {
+	SecurityCmd.AddCommand(keySlotsCmd)
+	keySlotsCmd.AddCommand(listSlotsCmd)
+	keySlotsCmd.AddCommand(removeSlotCmd)
+	SecurityCmd.AddCommand(calibrateCmd)
+
+	calibrateCmd.Flags().DurationVar(&calibrateTarget, "target", time.Second, "Time one key derivation should take")
+	calibrateCmd.Flags().IntVar(&calibrateMemory, "max-memory", 256, "Most memory to use, in MiB")
+}
@@ -0,0 +1,208 @@
+package security
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+	"go.etcd.io/bbolt"
+)
+
+// setupTestSecurityEnvironment creates a temporary directory and master key
+func setupTestSecurityEnvironment(t *testing.T) (string, []byte, func()) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "ark-security-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	salt, _ := crypto.GenerateSalt()
+	masterKey, err := crypto.DeriveKey("TestPassword123!", salt)
+	if err != nil {
+		t.Fatalf("Failed to derive master key: %v", err)
+	}
+
+	return filepath.Join(dir, "ark.db"), masterKey, func() { os.RemoveAll(dir) }
+}
+
+func TestNewDatabaseCreatesPasswordSlot(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestSecurityEnvironment(t)
+	defer cleanup()
+
+	db, err := storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Set("vault", "k", "v")
+	db.Close()
+
+	slots, err := storage.ReadKeySlots(dbPath)
+	if err != nil {
+		t.Fatalf("ReadKeySlots failed: %v", err)
+	}
+	if len(slots) != 1 || slots[0].Type != storage.SlotTypePassword {
+		t.Fatalf("Expected a single password slot, got %+v", slots)
+	}
+
+	// The wrong key is rejected up front
+	wrongKey, _ := crypto.DeriveKey("WrongPassword!", make([]byte, crypto.SaltSize))
+	if _, err := storage.NewDatabase(dbPath, wrongKey); !errors.Is(err, storage.ErrInvalidKey) {
+		t.Errorf("Expected ErrInvalidKey, got %v", err)
+	}
+
+	db, err = storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	var value string
+	if err := db.Get("vault", "k", &value); err != nil || value != "v" {
+		t.Errorf("Expected 'v', got %q (%v)", value, err)
+	}
+}
+
+func TestAddAndRemoveKeySlot(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestSecurityEnvironment(t)
+	defer cleanup()
+
+	db, err := storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Set("vault", "k", "v")
+
+	salt, _ := crypto.GenerateSalt()
+	recoveryKey, _ := crypto.DeriveKey("recovery-code", salt)
+	slot, err := db.AddKeySlot(storage.SlotTypeRecovery, salt, recoveryKey)
+	if err != nil {
+		t.Fatalf("AddKeySlot failed: %v", err)
+	}
+	db.Close()
+
+	// The new slot unlocks the same data
+	db, err = storage.NewDatabase(dbPath, recoveryKey)
+	if err != nil {
+		t.Fatalf("Failed to unlock with recovery slot: %v", err)
+	}
+	if db.UnlockedSlot() != slot.ID {
+		t.Errorf("Expected to unlock with slot %s, got %s", slot.ID, db.UnlockedSlot())
+	}
+	var value string
+	if err := db.Get("vault", "k", &value); err != nil || value != "v" {
+		t.Errorf("Expected 'v', got %q (%v)", value, err)
+	}
+
+	// The password slot is protected, other slots can be revoked
+	if err := removeKeySlot(db, "password"); err == nil {
+		t.Error("Expected error removing the password slot, but got none")
+	}
+	if err := removeKeySlot(db, slot.ID); err != nil {
+		t.Fatalf("removeKeySlot failed: %v", err)
+	}
+	db.Close()
+
+	if _, err := storage.NewDatabase(dbPath, recoveryKey); !errors.Is(err, storage.ErrInvalidKey) {
+		t.Errorf("Expected revoked slot to be rejected, got %v", err)
+	}
+}
+
+func TestLegacyDatabaseMigratesToKeySlots(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestSecurityEnvironment(t)
+	defer cleanup()
+
+	// Write a database the way older versions did: records encrypted directly
+	// with the master key and no key slots
+	enc, _ := crypto.NewEncryptor(masterKey)
+	raw, _ := json.Marshal("legacy-secret")
+	ciphertext, _ := enc.Encrypt(raw)
+	bdb, err := bbolt.Open(dbPath, 0600, nil)
+	if err != nil {
+		t.Fatalf("Failed to create legacy database: %v", err)
+	}
+	bdb.Update(func(tx *bbolt.Tx) error {
+		b, _ := tx.CreateBucketIfNotExists([]byte("vault"))
+		return b.Put([]byte("old"), ciphertext)
+	})
+	bdb.Close()
+
+	// A wrong key must not trigger the migration
+	wrongKey, _ := crypto.DeriveKey("WrongPassword!", make([]byte, crypto.SaltSize))
+	if _, err := storage.NewDatabase(dbPath, wrongKey); !errors.Is(err, storage.ErrInvalidKey) {
+		t.Fatalf("Expected ErrInvalidKey for legacy database, got %v", err)
+	}
+
+	db, err := storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to open legacy database: %v", err)
+	}
+	var value string
+	if err := db.Get("vault", "old", &value); err != nil || value != "legacy-secret" {
+		t.Errorf("Expected 'legacy-secret', got %q (%v)", value, err)
+	}
+	db.Close()
+
+	slots, _ := storage.ReadKeySlots(dbPath)
+	if len(slots) != 1 {
+		t.Fatalf("Expected migration to create a key slot, got %+v", slots)
+	}
+	if _, err := os.Stat(storage.BackupPath(dbPath)); !os.IsNotExist(err) {
+		t.Error("Expected migration backup to be removed")
+	}
+
+	// Records are no longer encrypted with the master key itself
+	bdb, _ = bbolt.Open(dbPath, 0600, nil)
+	defer bdb.Close()
+	bdb.View(func(tx *bbolt.Tx) error {
+		if _, err := enc.Decrypt(tx.Bucket([]byte("vault")).Get([]byte("old"))); err == nil {
+			t.Error("Expected record to be re-encrypted under the data key")
+		}
+		return nil
+	})
+}
+
+func TestGetRejectsMovedRecords(t *testing.T) {
+	dbPath, masterKey, cleanup := setupTestSecurityEnvironment(t)
+	defer cleanup()
+
+	db, err := storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Set("vault", "admin", "admin-secret")
+	db.Set("vault", "guest", "guest-secret")
+	db.Close()
+
+	// Copy one entry's ciphertext over another and into another bucket
+	bdb, err := bbolt.Open(dbPath, 0600, nil)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	bdb.Update(func(tx *bbolt.Tx) error {
+		vault := tx.Bucket([]byte("vault"))
+		guest := append([]byte(nil), vault.Get([]byte("guest"))...)
+		vault.Put([]byte("admin"), guest)
+		return tx.Bucket([]byte("config")).Put([]byte("guest"), guest)
+	})
+	bdb.Close()
+
+	db, err = storage.NewDatabase(dbPath, masterKey)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	var value string
+	if err := db.Get("vault", "admin", &value); !errors.Is(err, storage.ErrRecordTampered) {
+		t.Errorf("Expected ErrRecordTampered for a record moved to another key, got %q (%v)", value, err)
+	}
+	if err := db.Get("config", "guest", &value); !errors.Is(err, storage.ErrRecordTampered) {
+		t.Errorf("Expected ErrRecordTampered for a record moved to another bucket, got %q (%v)", value, err)
+	}
+	if err := db.Get("vault", "guest", &value); err != nil || value != "guest-secret" {
+		t.Errorf("Expected 'guest-secret', got %q (%v)", value, err)
+	}
+}
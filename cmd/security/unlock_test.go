@@ -0,0 +1,114 @@
+package security
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/config"
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+)
+
+// setupTestUnlockConfig creates an initialized installation
+func setupTestUnlockConfig(t *testing.T) (*config.Config, func()) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "ark-unlock-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	os.MkdirAll(filepath.Join(dir, "data"), 0700)
+
+	cfg, err := config.Initialize(dir, []byte("TestPassword123!"))
+	if err != nil {
+		t.Fatalf("Failed to initialize config: %v", err)
+	}
+	cfg.Security.KeyCache = config.KeyCacheNone
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	return cfg, func() { os.RemoveAll(dir) }
+}
+
+func TestUnlockVerifiesPassword(t *testing.T) {
+	cfg, cleanup := setupTestUnlockConfig(t)
+	defer cleanup()
+
+	if len(cfg.Verifier) == 0 || bytes.Equal(cfg.Verifier, cfg.MasterKey) {
+		t.Fatal("Expected a verifier distinct from the master key")
+	}
+
+	if _, err := cfg.Unlock([]byte("WrongPassword!")); !errors.Is(err, config.ErrIncorrectPassword) {
+		t.Errorf("Expected ErrIncorrectPassword, got %v", err)
+	}
+
+	key, err := cfg.Unlock([]byte("TestPassword123!"))
+	if err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	if !bytes.Equal(key, cfg.MasterKey) {
+		t.Error("Expected Unlock to return the master key")
+	}
+}
+
+func TestUnlockThrottlesRepeatedFailures(t *testing.T) {
+	cfg, cleanup := setupTestUnlockConfig(t)
+	defer cleanup()
+
+	for i := 0; i < 3; i++ {
+		if _, err := cfg.Unlock([]byte("WrongPassword!")); !errors.Is(err, config.ErrIncorrectPassword) {
+			t.Fatalf("Attempt %d: expected ErrIncorrectPassword, got %v", i+1, err)
+		}
+	}
+
+	// The count survives across processes, and even the right password waits
+	reloaded, _ := config.Load(cfg.ConfigDir)
+	var throttled *config.ThrottledError
+	if _, err := reloaded.Unlock([]byte("TestPassword123!")); !errors.As(err, &throttled) {
+		t.Fatalf("Expected ThrottledError, got %v", err)
+	}
+	if throttled.RetryIn <= 0 || throttled.RetryIn > time.Second {
+		t.Errorf("Expected a wait of up to 1s, got %s", throttled.RetryIn)
+	}
+
+	time.Sleep(throttled.RetryIn + 50*time.Millisecond)
+	if _, err := reloaded.Unlock([]byte("TestPassword123!")); err != nil {
+		t.Fatalf("Expected unlock after the backoff, got %v", err)
+	}
+
+	// Success resets the count
+	if _, err := reloaded.Unlock([]byte("WrongPassword!")); !errors.Is(err, config.ErrIncorrectPassword) {
+		t.Errorf("Expected ErrIncorrectPassword after reset, got %v", err)
+	}
+}
+
+func TestUnlockRecordsVerifierForLegacyInstall(t *testing.T) {
+	cfg, cleanup := setupTestUnlockConfig(t)
+	defer cleanup()
+
+	db, err := storage.NewDatabase(cfg.DatabasePath, cfg.MasterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Close()
+
+	// Strip the verifier, as in configs written by older versions
+	cfg.Verifier = nil
+	cfg.Save()
+	legacy, _ := config.Load(cfg.ConfigDir)
+
+	if _, err := legacy.Unlock([]byte("WrongPassword!")); !errors.Is(err, config.ErrIncorrectPassword) {
+		t.Errorf("Expected the database to reject a wrong password, got %v", err)
+	}
+	if _, err := legacy.Unlock([]byte("TestPassword123!")); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+
+	reloaded, _ := config.Load(cfg.ConfigDir)
+	if !bytes.Equal(reloaded.Verifier, crypto.KeyVerifier(cfg.MasterKey)) {
+		t.Error("Expected a verifier to be recorded after a successful unlock")
+	}
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/config"
+	"github.com/mbeniwal-imwe/ark/internal/core/password"
+	"github.com/mbeniwal-imwe/ark/internal/core/strength"
+)
+
+func TestEstimatePasswordStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		maxScore int
+		minScore int
+		warning  string
+	}{
+		{"password", 0, 0, "top-10 common password"},
+		{"p@ssw0rd", 0, 0, "similar to a commonly used password"},
+		{"drowssap", 0, 0, "similar to a commonly used password"},
+		{"qwertyui", 1, 0, ""},
+		{"zxcvbnm,./", 1, 0, "rows of keys"},
+		{"aaaaaaaaaaaa", 0, 0, `Repeats like "aaa"`},
+		{"abcdefghijk", 0, 0, "Sequences"},
+		{"Sunshine2019", 2, 0, ""},
+		{"correcthorsebatterystaple", 4, 4, ""},
+		{"kj3$Lq9!xW2#vB", 4, 4, ""},
+	}
+
+	for _, tt := range tests {
+		result := strength.Estimate(tt.password)
+		if result.Score > tt.maxScore || result.Score < tt.minScore {
+			t.Errorf("%q scored %d, want %d-%d", tt.password, result.Score, tt.minScore, tt.maxScore)
+		}
+		if tt.warning != "" && !strings.Contains(result.Warning, tt.warning) {
+			t.Errorf("%q warning = %q, want it to mention %q", tt.password, result.Warning, tt.warning)
+		}
+	}
+}
+
+func TestEstimateSuggestsAnotherWord(t *testing.T) {
+	result := strength.Estimate("monkey")
+	if !strings.Contains(result.Feedback(), "Add another word or two") {
+		t.Errorf("Feedback = %q", result.Feedback())
+	}
+
+	// Strong passwords need no feedback
+	if fb := strength.Estimate("correcthorsebatterystaple").Feedback(); fb != "" {
+		t.Errorf("Strong password got feedback %q", fb)
+	}
+}
+
+func TestEstimatePenalisesUserInputs(t *testing.T) {
+	plain := strength.Estimate("mbeniwal1984")
+	personal := strength.Estimate("mbeniwal1984", "mbeniwal")
+	if personal.Guesses >= plain.Guesses {
+		t.Errorf("User input did not lower the estimate: %g >= %g", personal.Guesses, plain.Guesses)
+	}
+	if !strings.Contains(personal.Warning, "personal") {
+		t.Errorf("Warning = %q", personal.Warning)
+	}
+}
+
+func TestCheckStrengthEnforcesMinimumScore(t *testing.T) {
+	if err := password.CheckStrength([]byte("short"), 0); err == nil {
+		t.Error("Accepted a password shorter than 8 characters")
+	}
+
+	err := password.CheckStrength([]byte("iloveyou"), strength.DefaultMinScore)
+	if err == nil || !strings.Contains(err.Error(), "too weak") {
+		t.Errorf("Expected weak password error, got %v", err)
+	}
+
+	if err := password.CheckStrength([]byte("TestPassword123!"), strength.DefaultMinScore); err != nil {
+		t.Errorf("Rejected a strong enough password: %v", err)
+	}
+	if err := password.CheckStrength([]byte("TestPassword123!"), strength.MaxScore); err == nil {
+		t.Error("Accepted a password below the configured score")
+	}
+}
+
+func TestMinPasswordScoreConfig(t *testing.T) {
+	if got := (config.SecurityConfig{}).MinScore(); got != strength.DefaultMinScore {
+		t.Errorf("Default MinScore = %d, want %d", got, strength.DefaultMinScore)
+	}
+	if got := (config.SecurityConfig{MinPasswordScore: 2}).MinScore(); got != 2 {
+		t.Errorf("MinScore = %d, want 2", got)
+	}
+	if got := (config.SecurityConfig{MinPasswordScore: 9}).MinScore(); got != strength.MaxScore {
+		t.Errorf("MinScore = %d, want %d", got, strength.MaxScore)
+	}
+}
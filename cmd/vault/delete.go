@@ -7,7 +7,6 @@ import (
 	"strings"
 
 	"github.com/mbeniwal-imwe/ark/internal/core/config"
-	"github.com/mbeniwal-imwe/ark/internal/storage"
 	"github.com/mbeniwal-imwe/ark/internal/storage/vault"
 	"github.com/spf13/cobra"
 )
@@ -50,7 +49,7 @@ func runDelete(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	db, err := storage.NewDatabase(cfg.DatabasePath, masterKey)
+	db, err := cfg.OpenDatabase(masterKey)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 
 	"github.com/mbeniwal-imwe/ark/internal/core/config"
-	"github.com/mbeniwal-imwe/ark/internal/storage"
 	"github.com/mbeniwal-imwe/ark/internal/storage/vault"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
@@ -53,7 +52,7 @@ func runGet(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	db, err := storage.NewDatabase(cfg.DatabasePath, masterKey)
+	db, err := cfg.OpenDatabaseReadOnly(masterKey)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
@@ -2,10 +2,11 @@ package vault
 
 import (
 	"fmt"
+	"os"
 	"sort"
+	"strings"
 
 	"github.com/mbeniwal-imwe/ark/internal/core/config"
-	"github.com/mbeniwal-imwe/ark/internal/storage"
 	"github.com/mbeniwal-imwe/ark/internal/storage/vault"
 	"github.com/spf13/cobra"
 )
@@ -51,7 +52,7 @@ func runList(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	db, err := storage.NewDatabase(cfg.DatabasePath, masterKey)
+	db, err := cfg.OpenDatabaseReadOnly(masterKey)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
@@ -62,14 +63,18 @@ func runList(cmd *cobra.Command, args []string) error {
 
 	// Get entries
 	var entries []*VaultEntry
+	var skipped []string
 	if listFilter != "" {
 		entries, err = vaultManager.Search(listFilter)
 	} else {
-		entries, err = vaultManager.List()
+		entries, skipped, err = vaultManager.ListWithSkipped()
 	}
 	if err != nil {
 		return fmt.Errorf("failed to list credentials: %w", err)
 	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(os.Stderr, "⚠️  %d entries could not be read (%s) - run 'ark db check'\n", len(skipped), strings.Join(skipped, ", "))
+	}
 
 	// Filter by tags if specified
 	if len(listTags) > 0 {
@@ -4,7 +4,6 @@ import (
 	"fmt"
 
 	"github.com/mbeniwal-imwe/ark/internal/core/config"
-	"github.com/mbeniwal-imwe/ark/internal/storage"
 	"github.com/mbeniwal-imwe/ark/internal/storage/vault"
 	"github.com/spf13/cobra"
 )
@@ -69,7 +68,7 @@ func runSet(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	db, err := storage.NewDatabase(cfg.DatabasePath, masterKey)
+	db, err := cfg.OpenDatabase(masterKey)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
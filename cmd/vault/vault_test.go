@@ -1,6 +1,7 @@
 package vault
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -8,6 +9,8 @@ import (
 	"github.com/mbeniwal-imwe/ark/internal/core/config"
 	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
 	"github.com/mbeniwal-imwe/ark/internal/storage"
+	"github.com/mbeniwal-imwe/ark/internal/storage/models"
+	"github.com/mbeniwal-imwe/ark/internal/storage/vault"
 	"github.com/spf13/cobra"
 )
 
@@ -91,3 +94,180 @@ func getTestMasterKey(t *testing.T, configDir string, masterKey []byte) []byte {
 	cfg.MasterKey = masterKey
 	return masterKey
 }
+
+// setupTestMemoryVault returns a vault manager on an in-memory database
+func setupTestMemoryVault(t *testing.T) (*storage.Database, *vault.VaultManager) {
+	t.Helper()
+	salt, _ := crypto.GenerateSalt()
+	masterKey, err := crypto.DeriveKey("TestPassword123!", salt)
+	if err != nil {
+		t.Fatalf("Failed to derive master key: %v", err)
+	}
+	db, err := storage.NewMemoryDatabase(masterKey)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, vault.NewVaultManager(db)
+}
+
+func TestTransactionRollsBack(t *testing.T) {
+	db, vm := setupTestMemoryVault(t)
+	vm.Set("keep", "kept", "text", "", nil)
+
+	errAbort := errors.New("abort")
+	err := db.Update(func(tx *storage.Tx) error {
+		if err := tx.Set("vault", "new", models.NewVaultEntry("new", "v", "text")); err != nil {
+			return err
+		}
+		if err := tx.Delete("vault", "keep"); err != nil {
+			return err
+		}
+
+		// Reads inside the transaction see its own writes
+		var keys []string
+		if err := tx.ForEach("vault", func(key string, decode func(interface{}) error) error {
+			var entry models.VaultEntry
+			if err := decode(&entry); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+			return nil
+		}); err != nil {
+			return err
+		}
+		if len(keys) != 1 || keys[0] != "new" {
+			t.Errorf("ForEach inside transaction = %v", keys)
+		}
+		return errAbort
+	})
+	if err != errAbort {
+		t.Fatalf("Update returned %v", err)
+	}
+
+	if ok, _ := vm.Exists("new"); ok {
+		t.Error("Rolled back Set is visible")
+	}
+	if ok, _ := vm.Exists("keep"); !ok {
+		t.Error("Rolled back Delete removed the entry")
+	}
+}
+
+func TestVaultManagerOnMemoryStore(t *testing.T) {
+	_, vm := setupTestMemoryVault(t)
+
+	if err := vm.Update("missing", "v", "text", "", nil); err == nil {
+		t.Error("Update of a missing entry succeeded")
+	}
+	if ok, _ := vm.Exists("missing"); ok {
+		t.Error("Failed Update created the entry")
+	}
+
+	vm.Set("a", "1", "text", "", []string{"x"})
+	vm.Set("b", "2", "text", "", nil)
+	if err := vm.Update("a", "updated", "text", "desc", []string{"y"}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := vm.AddTag("b", "z"); err != nil {
+		t.Fatalf("AddTag failed: %v", err)
+	}
+
+	entry, err := vm.Get("a")
+	if err != nil || entry.Value != "updated" || !entry.HasTag("y") || entry.HasTag("x") {
+		t.Errorf("Get after Update = %+v, %v", entry, err)
+	}
+	tagged, _ := vm.GetByTag("z")
+	if len(tagged) != 1 || tagged[0].Key != "b" {
+		t.Errorf("GetByTag = %v", tagged)
+	}
+
+	if err := vm.Clear(); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if entries, _ := vm.List(); len(entries) != 0 {
+		t.Errorf("Clear left %d entries", len(entries))
+	}
+}
+
+func TestVaultManagerReadOnly(t *testing.T) {
+	configDir, masterKey := setupTestVaultEnvironment(t)
+	defer cleanupTestVaultEnvironment(t, configDir)
+
+	cfg, err := config.Load(configDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	db, err := cfg.OpenDatabase(masterKey)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	vault.NewVaultManager(db).Set("api-key", "secret", "text", "", []string{"prod"})
+	db.Close()
+
+	db, err = cfg.OpenDatabaseReadOnly(masterKey)
+	if err != nil {
+		t.Fatalf("Failed to open database read-only: %v", err)
+	}
+	defer db.Close()
+	vm := vault.NewVaultManager(db)
+
+	// Reads work without recording the access
+	entry, err := vm.Get("api-key")
+	if err != nil || entry.Value != "secret" {
+		t.Fatalf("Get = %+v, %v", entry, err)
+	}
+	if entries, err := vm.List(); err != nil || len(entries) != 1 {
+		t.Errorf("List = %v, %v", entries, err)
+	}
+	if found, err := vm.Search("api"); err != nil || len(found) != 1 {
+		t.Errorf("Search = %v, %v", found, err)
+	}
+	if err := vm.Set("other", "v", "text", "", nil); !errors.Is(err, storage.ErrReadOnly) {
+		t.Errorf("Set on a read-only vault returned %v", err)
+	}
+}
+
+func TestVaultTagIndex(t *testing.T) {
+	_, vm := setupTestMemoryVault(t)
+
+	vm.Set("aws/prod", "1", "text", "", []string{"aws", "prod"})
+	vm.Set("aws/dev", "2", "text", "", []string{"aws"})
+	vm.Set("github", "3", "text", "", []string{"prod"})
+
+	keys := func(entries []*models.VaultEntry, err error) []string {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("Lookup failed: %v", err)
+		}
+		var out []string
+		for _, e := range entries {
+			out = append(out, e.Key)
+		}
+		return out
+	}
+
+	if got := keys(vm.GetByTag("prod")); len(got) != 2 || got[0] != "aws/prod" || got[1] != "github" {
+		t.Errorf("GetByTag(prod) = %v", got)
+	}
+	if got := keys(vm.ListByPrefix("aws/")); len(got) != 2 || got[0] != "aws/dev" || got[1] != "aws/prod" {
+		t.Errorf("ListByPrefix(aws/) = %v", got)
+	}
+
+	// Every way of changing tags keeps the index current
+	vm.RemoveTag("github", "prod")
+	vm.AddTag("aws/dev", "prod")
+	vm.Update("aws/prod", "1", "text", "", []string{"aws"})
+	if got := keys(vm.GetByTag("prod")); len(got) != 1 || got[0] != "aws/dev" {
+		t.Errorf("GetByTag(prod) after retagging = %v", got)
+	}
+	vm.Delete("aws/dev")
+	if got := keys(vm.GetByTag("prod")); len(got) != 0 {
+		t.Errorf("GetByTag(prod) after delete = %v", got)
+	}
+	if err := vm.Clear(); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if got := keys(vm.GetByTag("aws")); len(got) != 0 {
+		t.Errorf("GetByTag(aws) after clear = %v", got)
+	}
+}
@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"time"
+)
+
+// dialTimeout bounds how long commands wait for an agent before falling back
+const dialTimeout = 500 * time.Millisecond
+
+// Operations understood by the agent
+const (
+	OpGet      = "get"
+	OpPut      = "put"
+	OpLock     = "lock"
+	OpStatus   = "status"
+	OpShutdown = "shutdown"
+)
+
+// Request is a single message sent to the agent
+type Request struct {
+	Op  string `json:"op"`
+	Key []byte `json:"key,omitempty"`
+}
+
+// Response is the agent's reply to a Request
+type Response struct {
+	OK        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"`
+	Key       []byte `json:"key,omitempty"`
+	Unlocked  bool   `json:"unlocked"`
+	ExpiresIn int    `json:"expires_in_seconds,omitempty"`
+	PID       int    `json:"pid,omitempty"`
+}
+
+// SocketPath returns the agent socket path for an Ark installation
+func SocketPath(configDir string) string {
+	return filepath.Join(configDir, "data", "agent.sock")
+}
+
+// call sends a request to the agent serving configDir and waits for the reply
+func call(configDir string, req Request) (*Response, error) {
+	conn, err := net.DialTimeout("unix", SocketPath(configDir), dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("agent not running: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("failed to send agent request: %w", err)
+	}
+
+	var resp Response
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read agent response: %w", err)
+	}
+	if !resp.OK {
+		return &resp, fmt.Errorf("agent: %s", resp.Error)
+	}
+	return &resp, nil
+}
+
+// GetKey returns the master key held by the agent
+func GetKey(configDir string) ([]byte, error) {
+	resp, err := call(configDir, Request{Op: OpGet})
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Unlocked || len(resp.Key) == 0 {
+		return nil, fmt.Errorf("agent is locked")
+	}
+	return resp.Key, nil
+}
+
+// PutKey hands the master key to the agent
+func PutKey(configDir string, key []byte) error {
+	_, err := call(configDir, Request{Op: OpPut, Key: key})
+	return err
+}
+
+// Lock makes the agent forget the master key
+func Lock(configDir string) error {
+	_, err := call(configDir, Request{Op: OpLock})
+	return err
+}
+
+// Status reports whether the agent is running and unlocked
+func Status(configDir string) (*Response, error) {
+	return call(configDir, Request{Op: OpStatus})
+}
+
+// Shutdown stops the agent
+func Shutdown(configDir string) error {
+	_, err := call(configDir, Request{Op: OpShutdown})
+	return err
+}
+
+// IsRunning reports whether an agent answers on the socket
+func IsRunning(configDir string) bool {
+	_, err := Status(configDir)
+	return err == nil
+}
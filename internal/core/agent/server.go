@@ -0,0 +1,233 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+)
+
+// Server holds the unlocked master key in locked memory and hands it out
+// over a Unix socket to processes of the same user
+type Server struct {
+	SocketPath string
+	// IdleTimeout locks the agent when the key has not been used for this long.
+	// Zero keeps the key until the agent is locked or stopped.
+	IdleTimeout time.Duration
+
+	mu       sync.Mutex
+	key      *crypto.Secret
+	lastUsed time.Time
+	listener net.Listener
+	done     chan struct{}
+}
+
+// ListenAndServe listens on the socket and serves requests until Close
+func (s *Server) ListenAndServe() error {
+	if err := s.listen(); err != nil {
+		return err
+	}
+	return s.Serve()
+}
+
+// listen creates the socket with owner-only permissions
+func (s *Server) listen() error {
+	if err := os.MkdirAll(filepath.Dir(s.SocketPath), 0700); err != nil {
+		return fmt.Errorf("failed to create socket directory: %w", err)
+	}
+
+	// A socket left behind by a crashed agent blocks Listen
+	if _, err := os.Stat(s.SocketPath); err == nil {
+		if conn, err := net.DialTimeout("unix", s.SocketPath, dialTimeout); err == nil {
+			conn.Close()
+			return fmt.Errorf("agent already running on %s", s.SocketPath)
+		}
+		os.Remove(s.SocketPath)
+	}
+
+	listener, err := net.Listen("unix", s.SocketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.SocketPath, err)
+	}
+	if err := os.Chmod(s.SocketPath, 0600); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+
+	s.listener = listener
+	s.done = make(chan struct{})
+	return nil
+}
+
+// Serve accepts connections until the listener is closed
+func (s *Server) Serve() error {
+	go s.expireLoop()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+				return nil
+			default:
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// Close wipes the key and stops the server
+func (s *Server) Close() error {
+	s.lock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done == nil {
+		return nil
+	}
+	select {
+	case <-s.done:
+		return nil
+	default:
+		close(s.done)
+	}
+	err := s.listener.Close()
+	os.Remove(s.SocketPath)
+	return err
+}
+
+// expireLoop locks the agent once the idle timeout has passed
+func (s *Server) expireLoop() {
+	if s.IdleTimeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			expired := s.key != nil && time.Since(s.lastUsed) >= s.IdleTimeout
+			s.mu.Unlock()
+			if expired {
+				s.lock()
+			}
+		}
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	// Only processes running as the same user may talk to the agent
+	if err := checkPeer(conn); err != nil {
+		json.NewEncoder(conn).Encode(Response{Error: err.Error()})
+		return
+	}
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	var req Request
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+		return
+	}
+
+	resp := s.dispatch(req)
+	json.NewEncoder(conn).Encode(resp)
+	crypto.Wipe(resp.Key)
+
+	if req.Op == OpShutdown {
+		s.Close()
+	}
+}
+
+func (s *Server) dispatch(req Request) Response {
+	switch req.Op {
+	case OpGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.key == nil || s.expiredLocked() {
+			return Response{OK: true}
+		}
+		s.lastUsed = time.Now()
+		key := make([]byte, s.key.Len())
+		copy(key, s.key.Bytes())
+		return Response{OK: true, Unlocked: true, Key: key, ExpiresIn: s.expiresInLocked()}
+	case OpPut:
+		defer crypto.Wipe(req.Key)
+		if len(req.Key) == 0 {
+			return Response{Error: "empty key"}
+		}
+		if err := s.store(req.Key); err != nil {
+			return Response{Error: err.Error()}
+		}
+		return Response{OK: true, Unlocked: true, ExpiresIn: int(s.IdleTimeout.Seconds())}
+	case OpLock:
+		s.lock()
+		return Response{OK: true}
+	case OpStatus:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		unlocked := s.key != nil && !s.expiredLocked()
+		resp := Response{OK: true, Unlocked: unlocked, PID: os.Getpid()}
+		if unlocked {
+			resp.ExpiresIn = s.expiresInLocked()
+		}
+		return resp
+	case OpShutdown:
+		return Response{OK: true}
+	default:
+		return Response{Error: fmt.Sprintf("unknown operation: %s", req.Op)}
+	}
+}
+
+// store copies key into locked memory, replacing any previous key
+func (s *Server) store(key []byte) error {
+	secret := crypto.NewSecret(key)
+	if crypto.MemoryLockSupported && !secret.Locked() {
+		secret.Close()
+		return fmt.Errorf("failed to lock key memory")
+	}
+
+	s.mu.Lock()
+	old := s.key
+	s.key = secret
+	s.lastUsed = time.Now()
+	s.mu.Unlock()
+
+	old.Close()
+	return nil
+}
+
+// lock wipes the key from memory
+func (s *Server) lock() {
+	s.mu.Lock()
+	key := s.key
+	s.key = nil
+	s.mu.Unlock()
+
+	key.Close()
+}
+
+func (s *Server) expiredLocked() bool {
+	return s.IdleTimeout > 0 && time.Since(s.lastUsed) >= s.IdleTimeout
+}
+
+func (s *Server) expiresInLocked() int {
+	if s.IdleTimeout <= 0 {
+		return 0
+	}
+	return int((s.IdleTimeout - time.Since(s.lastUsed)).Seconds())
+}
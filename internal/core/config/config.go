@@ -1,35 +1,50 @@
 package config
 
 import (
-	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 
+	"github.com/mbeniwal-imwe/ark/internal/core/agent"
 	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
 	"github.com/mbeniwal-imwe/ark/internal/core/password"
+	"github.com/mbeniwal-imwe/ark/internal/core/strength"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
 	"gopkg.in/yaml.v3"
 )
 
 // Config represents the Ark configuration
 type Config struct {
-	Version      string         `yaml:"version" json:"version"`
-	CreatedAt    time.Time      `yaml:"created_at" json:"created_at"`
-	UpdatedAt    time.Time      `yaml:"updated_at" json:"updated_at"`
-	MasterKey    []byte         `yaml:"-" json:"-"` // Not serialized
-	Salt         []byte         `yaml:"salt" json:"-"`
-	ConfigDir    string         `yaml:"-" json:"-"`
-	DatabasePath string         `yaml:"database_path" json:"database_path"`
-	LogLevel     string         `yaml:"log_level" json:"log_level"`
-	LogRotation  LogConfig      `yaml:"log_rotation" json:"log_rotation"`
-	AWS          AWSConfig      `yaml:"aws" json:"aws"`
-	Backup       BackupConfig   `yaml:"backup" json:"backup"`
-	Security     SecurityConfig `yaml:"security" json:"security"`
+	Version      string           `yaml:"version" json:"version"`
+	CreatedAt    time.Time        `yaml:"created_at" json:"created_at"`
+	UpdatedAt    time.Time        `yaml:"updated_at" json:"updated_at"`
+	MasterKey    []byte           `yaml:"-" json:"-"` // Not serialized
+	Salt         []byte           `yaml:"salt" json:"-"`
+	KDF          crypto.KDFParams `yaml:"kdf" json:"kdf"`
+	Verifier     []byte           `yaml:"verifier,omitempty" json:"-"` // Confirms the password, not the key
+	ConfigDir    string           `yaml:"-" json:"-"`
+	DatabasePath string           `yaml:"database_path" json:"database_path"`
+	LogLevel     string           `yaml:"log_level" json:"log_level"`
+	LogRotation  LogConfig        `yaml:"log_rotation" json:"log_rotation"`
+	AWS          AWSConfig        `yaml:"aws" json:"aws"`
+	Backup       BackupConfig     `yaml:"backup" json:"backup"`
+	Security     SecurityConfig   `yaml:"security" json:"security"`
+	Storage      StorageConfig    `yaml:"storage" json:"storage"`
+
+	// keys are the master keys this configuration has held, MasterKey last.
+	// The Config owns them, so slices handed out stay valid until Close.
+	keys [][]byte
 }
 
+var (
+	liveConfigsMu sync.Mutex
+	liveConfigs   = map[*Config]struct{}{}
+)
+
 // LogConfig represents logging configuration
 type LogConfig struct {
 	Enabled  bool `yaml:"enabled" json:"enabled"`
@@ -55,13 +70,37 @@ type BackupConfig struct {
 
 // SecurityConfig represents security configuration
 type SecurityConfig struct {
-	PasswordCacheTimeout int `yaml:"password_cache_timeout_seconds" json:"password_cache_timeout_seconds"` // Timeout in seconds
+	PasswordCacheTimeout int    `yaml:"password_cache_timeout_seconds" json:"password_cache_timeout_seconds"` // Timeout in seconds
+	KeyCache             string `yaml:"key_cache" json:"key_cache"`                                           // file, keyring or none
+	KeyringScope         string `yaml:"keyring_scope,omitempty" json:"keyring_scope,omitempty"`               // session or user
+	// KeyfileRequired mixes a keyfile into the master key as a second factor
+	KeyfileRequired bool   `yaml:"keyfile_required,omitempty" json:"keyfile_required,omitempty"`
+	Keyfile         string `yaml:"keyfile,omitempty" json:"keyfile,omitempty"` // Default keyfile path
+	// KDFTarget are calibrated key derivation parameters, applied the next
+	// time the master password is entered
+	KDFTarget *crypto.KDFParams `yaml:"kdf_target,omitempty" json:"kdf_target,omitempty"`
+	// MinPasswordScore is the strength score (1-4) a new master password
+	// must reach. Zero uses strength.DefaultMinScore.
+	MinPasswordScore int `yaml:"min_password_score,omitempty" json:"min_password_score,omitempty"`
+}
+
+// MinScore returns the strength score new master passwords must reach
+func (s SecurityConfig) MinScore() int {
+	if s.MinPasswordScore <= 0 {
+		return strength.DefaultMinScore
+	}
+	return min(s.MinPasswordScore, strength.MaxScore)
 }
 
-// cacheEntry represents a cached master key entry
-type cacheEntry struct {
-	Key       []byte    `json:"key"`
-	ExpiresAt time.Time `json:"expires_at"`
+// StorageConfig represents database storage configuration
+type StorageConfig struct {
+	// Backend is the storage backend a new database is created with, bbolt
+	// or sqlite. 'ark db convert' moves an existing database.
+	Backend string `yaml:"backend" json:"backend"`
+	// AutoCompact compacts the database after a command deleted records if
+	// at least this share of its pages is free, e.g. 0.5. Zero disables it;
+	// 'ark db compact' compacts on demand.
+	AutoCompact float64 `yaml:"auto_compact,omitempty" json:"auto_compact,omitempty"`
 }
 
 var (
@@ -95,12 +134,16 @@ func DefaultConfig(configDir string) *Config {
 		},
 		Security: SecurityConfig{
 			PasswordCacheTimeout: 300, // Default 5 minutes
+			KeyCache:             defaultKeyCache,
+		},
+		Storage: StorageConfig{
+			Backend: storage.DefaultBackend,
 		},
 	}
 }
 
 // Initialize creates a new configuration with master password
-func Initialize(configDir, masterPassword string) (*Config, error) {
+func Initialize(configDir string, masterPassword []byte) (*Config, error) {
 	config := DefaultConfig(configDir)
 
 	// Generate salt for key derivation
@@ -109,13 +152,15 @@ func Initialize(configDir, masterPassword string) (*Config, error) {
 		return nil, fmt.Errorf("failed to generate salt: %w", err)
 	}
 	config.Salt = salt
+	config.KDF = crypto.DefaultKDFParams
 
 	// Derive master key from password
-	masterKey, err := crypto.DeriveKey(masterPassword, salt)
+	masterKey, err := crypto.DeriveKeyWithKeyfile(masterPassword, salt, config.KDF, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to derive master key: %w", err)
 	}
-	config.MasterKey = masterKey
+	config.Verifier = crypto.KeyVerifier(masterKey)
+	config.setMasterKey(masterKey)
 
 	// Generate backup encryption key
 	backupKey, err := crypto.GenerateSalt()
@@ -176,126 +221,36 @@ func (c *Config) Save() error {
 	return nil
 }
 
-// getCacheFilePath returns the path to the password cache file
-func (c *Config) getCacheFilePath() string {
-	return filepath.Join(c.ConfigDir, "data", ".master_key_cache")
+// OpenDatabase opens the database with masterKey, creating it with the
+// configured storage backend if it does not exist yet
+func (c *Config) OpenDatabase(masterKey []byte) (*storage.Database, error) {
+	return storage.Open(c.DatabasePath, masterKey, c.StorageOptions())
 }
 
-// getCacheEncryptionKey derives an encryption key from config directory and salt
-func (c *Config) getCacheEncryptionKey() ([]byte, error) {
-	// Use config directory path + salt to derive a stable encryption key
-	// This ensures the cache is tied to this specific Ark installation
-	data := []byte(c.ConfigDir + string(c.Salt))
-	hash := sha256.Sum256(data)
-	return hash[:], nil
+// OpenDatabaseReadOnly opens the database without blocking other readers.
+// Writes to it fail with storage.ErrReadOnly.
+func (c *Config) OpenDatabaseReadOnly(masterKey []byte) (*storage.Database, error) {
+	opts := c.StorageOptions()
+	opts.ReadOnly = true
+	return storage.Open(c.DatabasePath, masterKey, opts)
 }
 
-// loadCachedMasterKey loads and decrypts the cached master key if valid
-func (c *Config) loadCachedMasterKey() ([]byte, error) {
-	cacheMutex.RLock()
-	defer cacheMutex.RUnlock()
-
-	cachePath := c.getCacheFilePath()
-
-	// Check if cache file exists
-	if _, err := os.Stat(cachePath); err != nil {
-		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("cache not found")
-		}
-		return nil, err
-	}
-
-	// Read encrypted cache file
-	encryptedData, err := os.ReadFile(cachePath)
-	if err != nil {
-		return nil, err
-	}
-
-	// Derive encryption key for cache
-	encKey, err := c.getCacheEncryptionKey()
-	if err != nil {
-		return nil, err
-	}
-
-	// Create encryptor with cache encryption key
-	encryptor, err := crypto.NewEncryptor(encKey)
-	if err != nil {
-		os.Remove(cachePath)
-		return nil, fmt.Errorf("failed to create encryptor: %w", err)
-	}
-
-	// Decrypt cache data (Encryptor.Decrypt expects nonce prepended)
-	plaintext, err := encryptor.Decrypt(encryptedData)
-	if err != nil {
-		// If decryption fails, cache might be corrupted - delete it
-		os.Remove(cachePath)
-		return nil, fmt.Errorf("failed to decrypt cache: %w", err)
-	}
-
-	// Unmarshal cache entry
-	var entry cacheEntry
-	if err := json.Unmarshal(plaintext, &entry); err != nil {
-		os.Remove(cachePath)
-		return nil, fmt.Errorf("failed to unmarshal cache: %w", err)
-	}
-
-	// Check if cache is expired
-	if time.Now().After(entry.ExpiresAt) {
-		os.Remove(cachePath)
-		return nil, fmt.Errorf("cache expired")
+// StorageOptions returns the options the database is opened with
+func (c *Config) StorageOptions() storage.Options {
+	return storage.Options{
+		Backend:     c.Storage.Backend,
+		Waiting:     waitingForDatabase,
+		AutoCompact: c.Storage.AutoCompact,
 	}
-
-	return entry.Key, nil
 }
 
-// saveCachedMasterKey saves and encrypts the master key to cache file
-func (c *Config) saveCachedMasterKey(masterKey []byte, timeoutSeconds int) error {
-	cacheMutex.Lock()
-	defer cacheMutex.Unlock()
-
-	// Create cache entry
-	entry := cacheEntry{
-		Key:       masterKey,
-		ExpiresAt: time.Now().Add(time.Duration(timeoutSeconds) * time.Second),
-	}
-
-	// Marshal to JSON
-	data, err := json.Marshal(entry)
-	if err != nil {
-		return fmt.Errorf("failed to marshal cache: %w", err)
-	}
-
-	// Derive encryption key
-	encKey, err := c.getCacheEncryptionKey()
-	if err != nil {
-		return err
-	}
-
-	// Create encryptor with cache encryption key
-	encryptor, err := crypto.NewEncryptor(encKey)
-	if err != nil {
-		return fmt.Errorf("failed to create encryptor: %w", err)
-	}
-
-	// Encrypt cache data (Encryptor.Encrypt prepends nonce)
-	encryptedData, err := encryptor.Encrypt(data)
-	if err != nil {
-		return fmt.Errorf("failed to encrypt cache: %w", err)
-	}
-
-	// Ensure cache directory exists
-	cachePath := c.getCacheFilePath()
-	cacheDir := filepath.Dir(cachePath)
-	if err := os.MkdirAll(cacheDir, 0700); err != nil {
-		return fmt.Errorf("failed to create cache directory: %w", err)
+// waitingForDatabase tells the user why opening the database is taking a while
+func waitingForDatabase(owner *storage.LockOwner) {
+	if owner == nil {
+		fmt.Fprintln(os.Stderr, "⏳ Database is locked by another process, waiting...")
+		return
 	}
-
-	// Write encrypted cache file with restrictive permissions
-	if err := os.WriteFile(cachePath, encryptedData, 0600); err != nil {
-		return fmt.Errorf("failed to write cache file: %w", err)
-	}
-
-	return nil
+	fmt.Fprintf(os.Stderr, "⏳ Database is locked by pid %d (%s), waiting...\n", owner.PID, owner.Command)
 }
 
 // GetMasterKey returns the master encryption key
@@ -305,12 +260,21 @@ func (c *Config) GetMasterKey() ([]byte, error) {
 		return c.MasterKey, nil
 	}
 
-	// Check file-based cache
-	cachedKey, err := c.loadCachedMasterKey()
-	if err == nil && len(cachedKey) > 0 {
+	// Ask a running agent first
+	if agentKey, err := agent.GetKey(c.ConfigDir); err == nil && c.keyMatches(agentKey) {
+		return c.setMasterKey(agentKey), nil
+	}
+
+	cache, err := c.KeyCache()
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the configured key cache
+	cachedKey, err := cache.Load()
+	if err == nil && c.keyMatches(cachedKey) {
 		// Cache hit - use cached key
-		c.MasterKey = cachedKey
-		return cachedKey, nil
+		return c.setMasterKey(cachedKey), nil
 	}
 
 	// If no master key is loaded, we need to prompt for the master password
@@ -319,33 +283,94 @@ func (c *Config) GetMasterKey() ([]byte, error) {
 		return nil, fmt.Errorf("no salt found in config - Ark may not be initialized. Run 'ark init' first")
 	}
 
+	// Don't prompt while wrong passwords are being throttled
+	if err := c.checkThrottle(); err != nil {
+		return nil, err
+	}
+
 	// Prompt for master password
 	masterPassword, err := password.GetMasterPassword()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get master password: %w", err)
 	}
+	defer masterPassword.Close()
 
-	// Derive master key from password and salt
-	masterKey, err := crypto.DeriveKey(masterPassword, c.Salt)
+	masterKey, err := c.Unlock(masterPassword.Bytes())
 	if err != nil {
-		return nil, fmt.Errorf("failed to derive master key: %w", err)
+		return nil, err
 	}
 
-	// Cache the master key with expiration (file-based)
+	// Also cache in the config instance
+	masterKey = c.setMasterKey(masterKey)
+
+	// Caching is a convenience feature - don't fail if it is unavailable
+	c.CacheMasterKey(masterKey)
+	return masterKey, nil
+}
+
+// CacheMasterKey hands the master key to a running agent, or stores it in the
+// configured key cache for the password cache timeout
+func (c *Config) CacheMasterKey(masterKey []byte) error {
 	timeout := c.Security.PasswordCacheTimeout
 	if timeout <= 0 {
 		timeout = 300 // Default 5 minutes if not set
 	}
 
-	// Save to cache file (ignore errors - cache is optional)
-	if err := c.saveCachedMasterKey(masterKey, timeout); err != nil {
-		// Log but don't fail - caching is a convenience feature
-		// In production, you might want to log this
+	// Prefer handing the key to a running agent over the other caches
+	if err := agent.PutKey(c.ConfigDir, masterKey); err == nil {
+		return ClearPasswordCache(c.ConfigDir)
 	}
 
-	// Also cache in the config instance
-	c.MasterKey = masterKey
-	return masterKey, nil
+	cache, err := c.KeyCache()
+	if err != nil {
+		return err
+	}
+	return cache.Store(masterKey, time.Duration(timeout)*time.Second)
+}
+
+// setMasterKey copies key into a buffer owned by the configuration, wiping
+// the original, and makes MasterKey refer to the copy, which it returns.
+// Earlier master keys stay valid until Close, as callers may still hold them.
+func (c *Config) setMasterKey(key []byte) []byte {
+	owned := append([]byte(nil), key...)
+	crypto.Wipe(key)
+
+	liveConfigsMu.Lock()
+	defer liveConfigsMu.Unlock()
+	liveConfigs[c] = struct{}{}
+	c.keys = append(c.keys, owned)
+	c.MasterKey = owned
+	return owned
+}
+
+// Close wipes every master key this configuration has held. MasterKey and
+// any slice returned by GetMasterKey read as zeros afterwards.
+func (c *Config) Close() error {
+	liveConfigsMu.Lock()
+	defer liveConfigsMu.Unlock()
+	c.wipeKeys()
+	delete(liveConfigs, c)
+	return nil
+}
+
+// wipeKeys zeroes the master keys. liveConfigsMu must be held.
+func (c *Config) wipeKeys() {
+	for _, key := range c.keys {
+		crypto.Wipe(key)
+	}
+	c.keys = nil
+	c.MasterKey = nil
+}
+
+// WipeMasterKeys wipes the master keys held by every configuration in the
+// process. It is meant to run once the command has finished.
+func WipeMasterKeys() {
+	liveConfigsMu.Lock()
+	defer liveConfigsMu.Unlock()
+	for c := range liveConfigs {
+		c.wipeKeys()
+		delete(liveConfigs, c)
+	}
 }
 
 // GetMasterKeySilent returns the master key without prompting (for internal use)
@@ -353,13 +378,23 @@ func (c *Config) GetMasterKeySilent() []byte {
 	return c.MasterKey
 }
 
-// ClearPasswordCache clears the cached master key
-func ClearPasswordCache(configDir string) {
-	cacheMutex.Lock()
-	defer cacheMutex.Unlock()
-
-	cachePath := filepath.Join(configDir, "data", ".master_key_cache")
-	os.Remove(cachePath)
+// ClearPasswordCache evicts the cached master key from every cache backend,
+// whichever one is currently configured
+func ClearPasswordCache(configDir string) error {
+	var errs []error
+	if err := (&fileKeyCache{configDir: configDir}).Clear(); err != nil {
+		errs = append(errs, err)
+	}
+	for _, scope := range []string{KeyringScopeSession, KeyringScopeUser} {
+		cache, err := newKeyringCache(configDir, scope)
+		if err != nil {
+			continue // not supported on this platform
+		}
+		if err := cache.Clear(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // SetPasswordCacheTimeout updates the password cache timeout in the config
@@ -371,9 +406,10 @@ func (c *Config) SetPasswordCacheTimeout(timeoutSeconds int) {
 }
 
 // SetMasterPassword updates the master password and regenerates keys
-func (c *Config) SetMasterPassword(password string) error {
-	// Clear the cache since we're changing the password
+func (c *Config) SetMasterPassword(password []byte) error {
+	// Clear the cache and failed attempts since we're changing the password
 	ClearPasswordCache(c.ConfigDir)
+	c.resetFailures()
 
 	// Generate new salt
 	salt, err := crypto.GenerateSalt()
@@ -381,13 +417,15 @@ func (c *Config) SetMasterPassword(password string) error {
 		return fmt.Errorf("failed to generate salt: %w", err)
 	}
 	c.Salt = salt
+	c.KDF = c.TargetKDFParams()
 
 	// Derive new master key
-	masterKey, err := crypto.DeriveKey(password, salt)
+	masterKey, err := c.deriveKey(password, salt, c.KDF)
 	if err != nil {
 		return fmt.Errorf("failed to derive master key: %w", err)
 	}
-	c.MasterKey = masterKey
+	c.Verifier = crypto.KeyVerifier(masterKey)
+	c.setMasterKey(masterKey)
 
 	// Generate new backup key
 	backupKey, err := crypto.GenerateSalt()
@@ -418,10 +456,22 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid salt size")
 	}
 
+	if !c.KDF.IsZero() {
+		if err := c.KDF.Validate(); err != nil {
+			return err
+		}
+	}
+
 	if c.DatabasePath == "" {
 		return fmt.Errorf("database path is required")
 	}
 
+	switch c.Security.KeyCache {
+	case "", KeyCacheFile, KeyCacheKeyring, KeyCacheNone:
+	default:
+		return fmt.Errorf("invalid key cache: %s", c.Security.KeyCache)
+	}
+
 	if c.LogLevel != "debug" && c.LogLevel != "info" && c.LogLevel != "warn" && c.LogLevel != "error" {
 		return fmt.Errorf("invalid log level: %s", c.LogLevel)
 	}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+)
+
+// ErrIncorrectPassword is returned when the master password does not match
+var ErrIncorrectPassword = errors.New("incorrect master password")
+
+// KDFParams returns the parameters the master key is derived with.
+// Installations that predate recorded parameters use the legacy ones.
+func (c *Config) KDFParams() crypto.KDFParams {
+	if c.KDF.IsZero() {
+		return crypto.LegacyKDFParams
+	}
+	return c.KDF
+}
+
+// TargetKDFParams returns the parameters the master key should be derived
+// with: the calibrated ones if set, otherwise the defaults
+func (c *Config) TargetKDFParams() crypto.KDFParams {
+	if c.Security.KDFTarget != nil {
+		return *c.Security.KDFTarget
+	}
+	return crypto.DefaultKDFParams
+}
+
+// DeriveMasterKey derives the master key from password with the stored salt
+// and parameters
+func (c *Config) DeriveMasterKey(password []byte) ([]byte, error) {
+	if len(c.Salt) == 0 {
+		return nil, fmt.Errorf("no salt found in config - Ark may not be initialized. Run 'ark init' first")
+	}
+	return c.deriveKey(password, c.Salt, c.KDFParams())
+}
+
+// Unlock checks the master password and derives the master key from it,
+// moving it to the target key derivation parameters while the password is at
+// hand. Wrong passwords are counted, and after a few of them Unlock refuses
+// to try again until an exponentially growing delay has passed. The caller
+// keeps ownership of password and should wipe it afterwards.
+func (c *Config) Unlock(password []byte) ([]byte, error) {
+	if err := c.checkThrottle(); err != nil {
+		return nil, err
+	}
+
+	masterKey, err := c.verifyPassword(password)
+	if errors.Is(err, ErrIncorrectPassword) {
+		c.recordFailure()
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.resetFailures()
+
+	// Upgrading is best effort - the current key still works if it fails
+	if upgraded, err := c.upgradeKDF(password, masterKey); err == nil && !hmac.Equal(upgraded, masterKey) {
+		crypto.Wipe(masterKey)
+		masterKey = upgraded
+	}
+	return masterKey, nil
+}
+
+// verifyPassword derives the master key, returning ErrIncorrectPassword if
+// it does not match the stored verifier
+func (c *Config) verifyPassword(password []byte) ([]byte, error) {
+	if len(c.Salt) == 0 {
+		return nil, fmt.Errorf("no salt found in config - Ark may not be initialized. Run 'ark init' first")
+	}
+
+	if len(c.Verifier) > 0 {
+		digest, err := c.keyfileDigest()
+		if err != nil {
+			return nil, err
+		}
+		masterKey, ok := crypto.VerifyPassword(password, c.Verifier, c.Salt, c.KDFParams(), digest)
+		if !ok && digest != nil {
+			return nil, fmt.Errorf("%w or keyfile", ErrIncorrectPassword)
+		}
+		if !ok {
+			return nil, ErrIncorrectPassword
+		}
+		return masterKey, nil
+	}
+
+	// Installations from before verifiers existed: check the key against the
+	// database, then record a verifier for next time
+	masterKey, err := c.DeriveMasterKey(password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive master key: %w", err)
+	}
+	if _, err := os.Stat(c.DatabasePath); err == nil {
+		db, err := c.OpenDatabase(masterKey)
+		if errors.Is(err, storage.ErrInvalidKey) {
+			return nil, ErrIncorrectPassword
+		}
+		if err != nil {
+			return nil, err
+		}
+		db.Close()
+	}
+
+	// The password is already confirmed, so a failed save only costs the
+	// database check again next time
+	c.Verifier = crypto.KeyVerifier(masterKey)
+	if err := c.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save password verifier: %v\n", err)
+	}
+	return masterKey, nil
+}
+
+// keyMatches reports whether a cached key belongs to the current password,
+// so a key cached before a password change is not used
+func (c *Config) keyMatches(key []byte) bool {
+	if len(key) == 0 {
+		return false
+	}
+	if len(c.Verifier) == 0 {
+		return true
+	}
+	return hmac.Equal(crypto.KeyVerifier(key), c.Verifier)
+}
+
+// upgradeKDF moves the master key to the target parameters when they differ
+// from the recorded ones. Only the password key slot has to be re-wrapped, so
+// this is cheap enough to do transparently after the password was entered.
+func (c *Config) upgradeKDF(password []byte, masterKey []byte) ([]byte, error) {
+	target := c.TargetKDFParams()
+	if !c.KDF.IsZero() && c.KDF == target {
+		return masterKey, nil
+	}
+
+	salt, err := crypto.GenerateSalt()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	newKey, err := c.deriveKey(password, salt, target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive master key: %w", err)
+	}
+
+	oldSalt, oldKDF, oldVerifier := c.Salt, c.KDF, c.Verifier
+	commit := func() error {
+		c.Salt, c.KDF, c.Verifier = salt, target, crypto.KeyVerifier(newKey)
+		if err := c.Save(); err != nil {
+			c.Salt, c.KDF, c.Verifier = oldSalt, oldKDF, oldVerifier
+			return err
+		}
+		return nil
+	}
+
+	// Nothing to re-wrap before the database exists
+	if _, err := os.Stat(c.DatabasePath); os.IsNotExist(err) {
+		if err := commit(); err != nil {
+			return nil, err
+		}
+		return newKey, nil
+	}
+
+	db, err := c.OpenDatabase(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	// Backups made so far may be encrypted with the current key
+	if err := db.RetireKey(masterKey); err != nil {
+		return nil, err
+	}
+	slotID := db.UnlockedSlot()
+	if err := db.RewrapKeySlot(slotID, newKey); err != nil {
+		return nil, err
+	}
+	if err := commit(); err != nil {
+		if rollbackErr := db.RewrapKeySlot(slotID, masterKey); rollbackErr != nil {
+			return nil, fmt.Errorf("failed to save configuration: %w (rollback failed: %v)", err, rollbackErr)
+		}
+		return nil, fmt.Errorf("failed to save configuration: %w", err)
+	}
+	return newKey, nil
+}
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+)
+
+// Key cache backends selectable with security.key_cache
+const (
+	KeyCacheFile    = "file"
+	KeyCacheKeyring = "keyring"
+	KeyCacheNone    = "none"
+)
+
+// Keyring scopes selectable with security.keyring_scope
+const (
+	KeyringScopeSession = "session"
+	KeyringScopeUser    = "user"
+)
+
+// KeyCache keeps the derived master key between commands so the master
+// password is not prompted for on every invocation
+type KeyCache interface {
+	// Load returns the cached key, or an error when nothing valid is cached
+	Load() ([]byte, error)
+	// Store caches key for ttl
+	Store(key []byte, ttl time.Duration) error
+	// Clear evicts the cached key
+	Clear() error
+}
+
+// KeyCache returns the cache backend selected in the configuration
+func (c *Config) KeyCache() (KeyCache, error) {
+	backend := c.Security.KeyCache
+	if backend == "" {
+		backend = defaultKeyCache
+	}
+
+	switch backend {
+	case KeyCacheFile:
+		return &fileKeyCache{configDir: c.ConfigDir, salt: c.Salt}, nil
+	case KeyCacheKeyring:
+		return newKeyringCache(c.ConfigDir, c.Security.KeyringScope)
+	case KeyCacheNone:
+		return noKeyCache{}, nil
+	default:
+		return nil, fmt.Errorf("unknown key cache backend: %s", backend)
+	}
+}
+
+// keyringDescription names the keyring entry for an Ark installation
+func keyringDescription(configDir string) string {
+	sum := sha256.Sum256([]byte(configDir))
+	return "ark:master-key:" + hex.EncodeToString(sum[:8])
+}
+
+// fileKeyCache stores the key encrypted in data/.master_key_cache
+type fileKeyCache struct {
+	configDir string
+	salt      []byte
+}
+
+// cacheEntry represents a cached master key entry
+type cacheEntry struct {
+	Key       []byte    `json:"key"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// fileCachePath returns the path to the password cache file
+func fileCachePath(configDir string) string {
+	return filepath.Join(configDir, "data", ".master_key_cache")
+}
+
+// encryptionKey derives the cache encryption key from config directory and salt
+func (f *fileKeyCache) encryptionKey() []byte {
+	// Use config directory path + salt to derive a stable encryption key
+	// This ensures the cache is tied to this specific Ark installation
+	data := []byte(f.configDir + string(f.salt))
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
+
+// Load loads and decrypts the cached master key if valid
+func (f *fileKeyCache) Load() ([]byte, error) {
+	cacheMutex.RLock()
+	defer cacheMutex.RUnlock()
+
+	cachePath := fileCachePath(f.configDir)
+
+	// Read encrypted cache file
+	encryptedData, err := os.ReadFile(cachePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("cache not found")
+		}
+		return nil, err
+	}
+
+	// Create encryptor with cache encryption key
+	encryptor, err := crypto.NewEncryptor(f.encryptionKey())
+	if err != nil {
+		os.Remove(cachePath)
+		return nil, fmt.Errorf("failed to create encryptor: %w", err)
+	}
+	defer encryptor.Close()
+
+	// Decrypt cache data (Encryptor.Decrypt expects nonce prepended)
+	plaintext, err := encryptor.Decrypt(encryptedData)
+	if err != nil {
+		// If decryption fails, cache might be corrupted - delete it
+		os.Remove(cachePath)
+		return nil, fmt.Errorf("failed to decrypt cache: %w", err)
+	}
+	defer crypto.Wipe(plaintext)
+
+	// Unmarshal cache entry
+	var entry cacheEntry
+	if err := json.Unmarshal(plaintext, &entry); err != nil {
+		os.Remove(cachePath)
+		return nil, fmt.Errorf("failed to unmarshal cache: %w", err)
+	}
+
+	// Check if cache is expired
+	if time.Now().After(entry.ExpiresAt) {
+		os.Remove(cachePath)
+		return nil, fmt.Errorf("cache expired")
+	}
+
+	return entry.Key, nil
+}
+
+// Store encrypts the master key into the cache file
+func (f *fileKeyCache) Store(key []byte, ttl time.Duration) error {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	data, err := json.Marshal(cacheEntry{
+		Key:       key,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache: %w", err)
+	}
+
+	encryptor, err := crypto.NewEncryptor(f.encryptionKey())
+	if err != nil {
+		return fmt.Errorf("failed to create encryptor: %w", err)
+	}
+	defer encryptor.Close()
+	defer crypto.Wipe(data)
+
+	// Encrypt cache data (Encryptor.Encrypt prepends nonce)
+	encryptedData, err := encryptor.Encrypt(data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt cache: %w", err)
+	}
+
+	// Ensure cache directory exists
+	cachePath := fileCachePath(f.configDir)
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	// Write encrypted cache file with restrictive permissions
+	if err := os.WriteFile(cachePath, encryptedData, 0600); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+
+	return nil
+}
+
+// Clear removes the cache file
+func (f *fileKeyCache) Clear() error {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	if err := os.Remove(fileCachePath(f.configDir)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// noKeyCache never caches, so every command prompts
+type noKeyCache struct{}
+
+func (noKeyCache) Load() ([]byte, error) {
+	return nil, fmt.Errorf("key caching disabled")
+}
+
+func (noKeyCache) Store(key []byte, ttl time.Duration) error {
+	return nil
+}
+
+func (noKeyCache) Clear() error {
+	return nil
+}
@@ -0,0 +1,104 @@
+//go:build linux
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// defaultKeyCache keeps the key in the kernel rather than on disk
+const defaultKeyCache = KeyCacheKeyring
+
+// keyPerm grants the possessor and the owning user full access, and
+// nobody else anything
+const keyPerm = 0x3f3f0000
+
+// keyringCache stores the key as a "user" key in the kernel keyring. The
+// kernel enforces the timeout and the key never touches the disk.
+type keyringCache struct {
+	description string
+	ringID      int
+}
+
+func newKeyringCache(configDir, scope string) (KeyCache, error) {
+	ringID, err := keyringID(scope)
+	if err != nil {
+		return nil, err
+	}
+	return &keyringCache{description: keyringDescription(configDir), ringID: ringID}, nil
+}
+
+// keyringID maps a scope name to the special keyring it refers to
+func keyringID(scope string) (int, error) {
+	switch scope {
+	case "", KeyringScopeSession:
+		return unix.KEY_SPEC_SESSION_KEYRING, nil
+	case KeyringScopeUser:
+		return unix.KEY_SPEC_USER_KEYRING, nil
+	default:
+		return 0, fmt.Errorf("unknown keyring scope: %s", scope)
+	}
+}
+
+// Load reads the key from the keyring
+func (k *keyringCache) Load() ([]byte, error) {
+	id, err := unix.KeyctlSearch(k.ringID, "user", k.description, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cache not found: %w", err)
+	}
+
+	size, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached key: %w", err)
+	}
+	buf := make([]byte, size)
+	if _, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, buf, 0); err != nil {
+		return nil, fmt.Errorf("failed to read cached key: %w", err)
+	}
+	return buf, nil
+}
+
+// Store adds or updates the key and sets its kernel-enforced timeout
+func (k *keyringCache) Store(key []byte, ttl time.Duration) error {
+	id, err := unix.AddKey("user", k.description, key, k.ringID)
+	if err != nil {
+		return fmt.Errorf("failed to add key to keyring: %w", err)
+	}
+	if _, err := unix.KeyctlInt(unix.KEYCTL_SETPERM, id, keyPerm, 0, 0); err != nil {
+		k.invalidate(id)
+		return fmt.Errorf("failed to restrict key permissions: %w", err)
+	}
+	if _, err := unix.KeyctlInt(unix.KEYCTL_SET_TIMEOUT, id, int(ttl.Seconds()), 0, 0); err != nil {
+		k.invalidate(id)
+		return fmt.Errorf("failed to set key timeout: %w", err)
+	}
+	return nil
+}
+
+// Clear invalidates the key if one is cached
+func (k *keyringCache) Clear() error {
+	id, err := unix.KeyctlSearch(k.ringID, "user", k.description, 0)
+	if err != nil {
+		if errors.Is(err, unix.ENOKEY) || errors.Is(err, unix.EKEYEXPIRED) || errors.Is(err, unix.EKEYREVOKED) {
+			return nil
+		}
+		return fmt.Errorf("failed to search keyring: %w", err)
+	}
+	return k.invalidate(id)
+}
+
+// invalidate removes the key immediately, falling back to revoking it on
+// kernels without KEYCTL_INVALIDATE
+func (k *keyringCache) invalidate(id int) error {
+	if _, err := unix.KeyctlInt(unix.KEYCTL_INVALIDATE, id, 0, 0, 0); err == nil {
+		return nil
+	}
+	if _, err := unix.KeyctlInt(unix.KEYCTL_REVOKE, id, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to evict key from keyring: %w", err)
+	}
+	return nil
+}
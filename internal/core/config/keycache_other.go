@@ -0,0 +1,12 @@
+//go:build !linux
+
+package config
+
+import "fmt"
+
+// defaultKeyCache is the encrypted cache file where no kernel keyring exists
+const defaultKeyCache = KeyCacheFile
+
+func newKeyringCache(configDir, scope string) (KeyCache, error) {
+	return nil, fmt.Errorf("the keyring key cache is only supported on Linux")
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+)
+
+// KeyfileOverride is the keyfile passed with --keyfile. It takes precedence
+// over security.keyfile.
+var KeyfileOverride string
+
+// keyfileDigest returns the digest of the keyfile to unlock with, or nil
+// when the installation does not require one
+func (c *Config) keyfileDigest() ([]byte, error) {
+	if !c.Security.KeyfileRequired {
+		return nil, nil
+	}
+
+	path := KeyfileOverride
+	if path == "" {
+		path = c.Security.Keyfile
+	}
+	if path == "" {
+		return nil, fmt.Errorf("this installation requires a keyfile: pass --keyfile or set security.keyfile")
+	}
+	return crypto.HashKeyfile(path)
+}
+
+// deriveKey derives a master key from password with the given salt and
+// parameters, mixing in the keyfile when one is required
+func (c *Config) deriveKey(password, salt []byte, params crypto.KDFParams) ([]byte, error) {
+	digest, err := c.keyfileDigest()
+	if err != nil {
+		return nil, err
+	}
+	return crypto.DeriveKeyWithKeyfile(password, salt, params, digest)
+}
+
+// UseKeyfile makes the keyfile at path a required second factor and
+// re-derives the master key from password and the keyfile. The caller is
+// responsible for re-wrapping the password key slot and saving.
+func (c *Config) UseKeyfile(path string, password []byte) ([]byte, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := c.Security
+	c.Security.KeyfileRequired = true
+	c.Security.Keyfile = abs
+
+	// The new keyfile must be used even if --keyfile named another one
+	override := KeyfileOverride
+	KeyfileOverride = ""
+	masterKey, err := c.deriveKey(password, c.Salt, c.KDFParams())
+	KeyfileOverride = override
+	if err != nil {
+		c.Security = previous
+		return nil, err
+	}
+
+	c.Verifier = crypto.KeyVerifier(masterKey)
+	return c.setMasterKey(masterKey), nil
+}
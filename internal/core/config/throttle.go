@@ -0,0 +1,97 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// freeAttempts is how many wrong passwords are allowed before backing off
+	freeAttempts = 3
+	// maxBackoff caps the wait between attempts
+	maxBackoff = 15 * time.Minute
+)
+
+// ThrottledError is returned while failed attempts require waiting
+type ThrottledError struct {
+	RetryIn time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("too many failed password attempts - try again in %s", e.RetryIn.Round(time.Second))
+}
+
+// unlockState counts failed master password attempts across invocations
+type unlockState struct {
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+}
+
+// unlockStatePath returns the path to the failed attempt state file
+func unlockStatePath(configDir string) string {
+	return filepath.Join(configDir, "data", ".unlock_state")
+}
+
+// loadUnlockState reads the state file; a missing or damaged file counts as
+// no failures
+func loadUnlockState(configDir string) unlockState {
+	var state unlockState
+	data, err := os.ReadFile(unlockStatePath(configDir))
+	if err != nil {
+		return state
+	}
+	json.Unmarshal(data, &state)
+	return state
+}
+
+// backoff returns how long to wait after the last failure, doubling with
+// every failure past the free attempts
+func (s unlockState) backoff() time.Duration {
+	if s.Failures < freeAttempts {
+		return 0
+	}
+	shift := s.Failures - freeAttempts
+	if shift > 10 {
+		return maxBackoff
+	}
+	d := time.Second << shift
+	if d > maxBackoff {
+		return maxBackoff
+	}
+	return d
+}
+
+// checkThrottle returns a ThrottledError while the backoff has not passed
+func (c *Config) checkThrottle() error {
+	state := loadUnlockState(c.ConfigDir)
+	wait := time.Until(state.LastFailure.Add(state.backoff()))
+	if wait > 0 {
+		return &ThrottledError{RetryIn: wait}
+	}
+	return nil
+}
+
+// recordFailure counts a wrong password
+func (c *Config) recordFailure() error {
+	state := loadUnlockState(c.ConfigDir)
+	state.Failures++
+	state.LastFailure = time.Now()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	path := unlockStatePath(c.ConfigDir)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// resetFailures clears the count after a correct password
+func (c *Config) resetFailures() {
+	os.Remove(unlockStatePath(c.ConfigDir))
+}
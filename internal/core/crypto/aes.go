@@ -3,11 +3,11 @@ package crypto
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"fmt"
 	"io"
-
-	"golang.org/x/crypto/argon2"
 )
 
 const (
@@ -19,23 +19,62 @@ const (
 	SaltSize = 32 // 256 bits
 )
 
-// Encryptor handles encryption and decryption operations
+// Encryptor handles encryption and decryption operations. Its key is kept in
+// a Secret, so Close should be called when the encryptor is no longer needed.
 type Encryptor struct {
-	key []byte
+	key   *Secret
+	suite byte
 }
 
 // NewEncryptor creates a new encryptor with the given key
 func NewEncryptor(key []byte) (*Encryptor, error) {
+	return NewEncryptorWithCipher(key, DefaultCipher)
+}
+
+// NewEncryptorWithCipher creates an encryptor whose Seal uses the given
+// cipher suite. Encrypt and Decrypt always use untagged AES-256-GCM.
+func NewEncryptorWithCipher(key []byte, suiteID byte) (*Encryptor, error) {
 	if len(key) != KeySize {
 		return nil, fmt.Errorf("invalid key size: expected %d bytes, got %d", KeySize, len(key))
 	}
+	if _, err := CipherByID(suiteID); err != nil {
+		return nil, err
+	}
 
-	return &Encryptor{key: key}, nil
+	return &Encryptor{key: NewSecret(key), suite: suiteID}, nil
+}
+
+// Close wipes the encryptor's copy of the key. The encryptor cannot be used
+// afterwards.
+func (e *Encryptor) Close() error {
+	return e.key.Close()
+}
+
+// Cipher returns the suite Seal encrypts with
+func (e *Encryptor) Cipher() byte {
+	return e.suite
+}
+
+// Seal encrypts plaintext with the encryptor's cipher suite, recording the
+// suite in the ciphertext header
+func (e *Encryptor) Seal(plaintext, additionalData []byte) ([]byte, error) {
+	return SealTagged(e.suite, e.key.Bytes(), plaintext, additionalData)
+}
+
+// Open decrypts a ciphertext from Seal, whichever suite it was sealed with
+func (e *Encryptor) Open(ciphertext, additionalData []byte) ([]byte, error) {
+	return OpenTagged(e.key.Bytes(), ciphertext, additionalData)
 }
 
 // Encrypt encrypts the given plaintext using AES-256-GCM
 func (e *Encryptor) Encrypt(plaintext []byte) ([]byte, error) {
-	block, err := aes.NewCipher(e.key)
+	return e.EncryptWithAAD(plaintext, nil)
+}
+
+// EncryptWithAAD encrypts plaintext and authenticates additionalData with it.
+// The same additionalData must be passed to DecryptWithAAD.
+func (e *Encryptor) EncryptWithAAD(plaintext, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(e.key.Bytes())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create cipher: %w", err)
 	}
@@ -52,13 +91,19 @@ func (e *Encryptor) Encrypt(plaintext []byte) ([]byte, error) {
 	}
 
 	// Encrypt and authenticate
-	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, additionalData)
 	return ciphertext, nil
 }
 
 // Decrypt decrypts the given ciphertext using AES-256-GCM
 func (e *Encryptor) Decrypt(ciphertext []byte) ([]byte, error) {
-	block, err := aes.NewCipher(e.key)
+	return e.DecryptWithAAD(ciphertext, nil)
+}
+
+// DecryptWithAAD decrypts ciphertext produced by EncryptWithAAD, failing if
+// additionalData differs from what it was encrypted with
+func (e *Encryptor) DecryptWithAAD(ciphertext, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(e.key.Bytes())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create cipher: %w", err)
 	}
@@ -77,7 +122,7 @@ func (e *Encryptor) Decrypt(ciphertext []byte) ([]byte, error) {
 	ciphertext = ciphertext[NonceSize:]
 
 	// Decrypt and authenticate
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additionalData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt: %w", err)
 	}
@@ -85,15 +130,10 @@ func (e *Encryptor) Decrypt(ciphertext []byte) ([]byte, error) {
 	return plaintext, nil
 }
 
-// DeriveKey derives an encryption key from a password using Argon2id
+// DeriveKey derives an encryption key from a password using Argon2id with
+// the legacy parameters
 func DeriveKey(password string, salt []byte) ([]byte, error) {
-	if len(salt) != SaltSize {
-		return nil, fmt.Errorf("invalid salt size: expected %d bytes, got %d", SaltSize, len(salt))
-	}
-
-	// Argon2id parameters (recommended values)
-	key := argon2.IDKey([]byte(password), salt, 1, 64*1024, 4, KeySize)
-	return key, nil
+	return DeriveKeyWithParams(password, salt, LegacyKDFParams)
 }
 
 // GenerateSalt generates a random salt for key derivation
@@ -105,22 +145,41 @@ func GenerateSalt() ([]byte, error) {
 	return salt, nil
 }
 
-// HashPassword hashes a password using PBKDF2 with SHA-256
-func HashPassword(password string, salt []byte) ([]byte, error) {
-	// Use Argon2id which is more secure than PBKDF2
-	// This provides the same security as PBKDF2 with 100,000 iterations
-	return DeriveKey(password, salt)
+// verifierContext separates the password verifier from the key it is computed from
+const verifierContext = "ark password verifier v1"
+
+// KeyVerifier returns a value that confirms a derived key without revealing it
+func KeyVerifier(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(verifierContext))
+	return mac.Sum(nil)
+}
+
+// HashPassword returns the verifier for a password (and keyfile, if
+// keyfileDigest is not nil): a MAC keyed by the key derived from it, so
+// storing it does not store the key itself
+func HashPassword(password, salt []byte, params KDFParams, keyfileDigest []byte) ([]byte, error) {
+	key, err := DeriveKeyWithKeyfile(password, salt, params, keyfileDigest)
+	if err != nil {
+		return nil, err
+	}
+	defer Wipe(key)
+	return KeyVerifier(key), nil
 }
 
-// VerifyPassword verifies a password against its hash
-func VerifyPassword(password string, hash, salt []byte) bool {
-	computedHash, err := HashPassword(password, salt)
+// VerifyPassword checks a password against its verifier. On success it also
+// returns the derived key, so callers do not pay for key derivation twice.
+func VerifyPassword(password, hash, salt []byte, params KDFParams, keyfileDigest []byte) ([]byte, bool) {
+	key, err := DeriveKeyWithKeyfile(password, salt, params, keyfileDigest)
 	if err != nil {
-		return false
+		return nil, false
 	}
 
-	return len(computedHash) == len(hash) &&
-		compareBytes(computedHash, hash)
+	if !compareBytes(KeyVerifier(key), hash) {
+		Wipe(key)
+		return nil, false
+	}
+	return key, true
 }
 
 // compareBytes compares two byte slices in constant time
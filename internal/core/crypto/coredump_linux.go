@@ -0,0 +1,23 @@
+//go:build linux
+
+package crypto
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// DisableCoreDumps stops the process from writing core dumps, which would
+// contain any key material in memory. On Linux the process is also marked
+// non-dumpable, which keeps other processes of the same user from attaching
+// to it or reading its memory.
+func DisableCoreDumps() error {
+	if err := unix.Setrlimit(unix.RLIMIT_CORE, &unix.Rlimit{}); err != nil {
+		return fmt.Errorf("failed to disable core dumps: %w", err)
+	}
+	if err := unix.Prctl(unix.PR_SET_DUMPABLE, 0, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to mark process non-dumpable: %w", err)
+	}
+	return nil
+}
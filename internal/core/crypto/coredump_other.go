@@ -0,0 +1,8 @@
+//go:build !unix
+
+package crypto
+
+// DisableCoreDumps is a no-op where core dump limits are unavailable
+func DisableCoreDumps() error {
+	return nil
+}
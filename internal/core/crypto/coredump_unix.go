@@ -0,0 +1,18 @@
+//go:build unix && !linux
+
+package crypto
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// DisableCoreDumps stops the process from writing core dumps, which would
+// contain any key material in memory
+func DisableCoreDumps() error {
+	if err := unix.Setrlimit(unix.RLIMIT_CORE, &unix.Rlimit{}); err != nil {
+		return fmt.Errorf("failed to disable core dumps: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package crypto
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// KDFArgon2id is the version tag for Argon2id key derivation
+const KDFArgon2id = 1
+
+// KDFParams are the cost parameters for deriving a key from a password
+type KDFParams struct {
+	Version   int    `yaml:"version" json:"version"`
+	Time      uint32 `yaml:"time" json:"time"`
+	MemoryKiB uint32 `yaml:"memory_kib" json:"memory_kib"`
+	Threads   uint8  `yaml:"threads" json:"threads"`
+}
+
+// LegacyKDFParams are the parameters used before they were configurable
+var LegacyKDFParams = KDFParams{Version: KDFArgon2id, Time: 1, MemoryKiB: 64 * 1024, Threads: 4}
+
+// DefaultKDFParams are used for new installations (RFC 9106 recommendation
+// for memory-constrained environments)
+var DefaultKDFParams = KDFParams{Version: KDFArgon2id, Time: 3, MemoryKiB: 64 * 1024, Threads: 4}
+
+const (
+	// minKDFMemoryKiB is the least memory calibration will settle for
+	minKDFMemoryKiB = 19 * 1024
+	// maxKDFTime bounds the passes calibration will try
+	maxKDFTime = 64
+)
+
+// IsZero reports whether no parameters were recorded
+func (p KDFParams) IsZero() bool {
+	return p == KDFParams{}
+}
+
+// Validate checks that the parameters are usable
+func (p KDFParams) Validate() error {
+	if p.Version != KDFArgon2id {
+		return fmt.Errorf("unsupported kdf version: %d", p.Version)
+	}
+	if p.Time < 1 || p.Threads < 1 || p.MemoryKiB < 8*uint32(p.Threads) {
+		return fmt.Errorf("invalid argon2id parameters: time=%d memory=%dKiB threads=%d", p.Time, p.MemoryKiB, p.Threads)
+	}
+	return nil
+}
+
+// String describes the parameters for display
+func (p KDFParams) String() string {
+	return fmt.Sprintf("argon2id v%d (time=%d, memory=%dMiB, threads=%d)", p.Version, p.Time, p.MemoryKiB/1024, p.Threads)
+}
+
+// DeriveKeyWithParams derives an encryption key from a password using
+// Argon2id with the given parameters
+func DeriveKeyWithParams(password string, salt []byte, params KDFParams) ([]byte, error) {
+	pw := []byte(password)
+	defer Wipe(pw)
+	return deriveArgon2id(pw, salt, params)
+}
+
+// deriveArgon2id is DeriveKeyWithParams for a password that is already held
+// as bytes, so callers can wipe it afterwards
+func deriveArgon2id(password, salt []byte, params KDFParams) ([]byte, error) {
+	if len(salt) != SaltSize {
+		return nil, fmt.Errorf("invalid salt size: expected %d bytes, got %d", SaltSize, len(salt))
+	}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey(password, salt, params.Time, params.MemoryKiB, params.Threads, KeySize)
+	return key, nil
+}
+
+// CalibrateKDF picks Argon2id parameters that take roughly target to derive a
+// key on this machine. It uses up to maxMemoryKiB of memory, adding passes
+// until the target is reached, and reduces memory only if a single pass is
+// already too slow. It returns the parameters and the measured duration.
+func CalibrateKDF(target time.Duration, maxMemoryKiB uint32) (KDFParams, time.Duration, error) {
+	if target <= 0 {
+		return KDFParams{}, 0, fmt.Errorf("target must be positive")
+	}
+	if maxMemoryKiB < minKDFMemoryKiB {
+		return KDFParams{}, 0, fmt.Errorf("memory must be at least %dMiB", minKDFMemoryKiB/1024)
+	}
+
+	threads := runtime.NumCPU()
+	if threads > 4 {
+		threads = 4
+	}
+	params := KDFParams{Version: KDFArgon2id, Time: 1, MemoryKiB: maxMemoryKiB, Threads: uint8(threads)}
+	salt := make([]byte, SaltSize)
+
+	measure := func(p KDFParams) (time.Duration, error) {
+		start := time.Now()
+		if _, err := DeriveKeyWithParams("calibration", salt, p); err != nil {
+			return 0, err
+		}
+		return time.Since(start), nil
+	}
+
+	elapsed, err := measure(params)
+	if err != nil {
+		return KDFParams{}, 0, err
+	}
+
+	// A single pass is too slow: trade memory for time
+	for elapsed > target && params.MemoryKiB/2 >= minKDFMemoryKiB {
+		params.MemoryKiB /= 2
+		if elapsed, err = measure(params); err != nil {
+			return KDFParams{}, 0, err
+		}
+	}
+
+	// Each pass costs about the same, so estimate instead of trying every count
+	for elapsed < target && params.Time < maxKDFTime {
+		perPass := elapsed / time.Duration(params.Time)
+		next := uint32(target / perPass)
+		if next <= params.Time {
+			next = params.Time + 1
+		}
+		if next > maxKDFTime {
+			next = maxKDFTime
+		}
+		candidate := params
+		candidate.Time = next
+		d, err := measure(candidate)
+		if err != nil {
+			return KDFParams{}, 0, err
+		}
+		if d > target+target/4 && candidate.Time > params.Time+1 {
+			// Overshot noticeably - settle one pass short of the estimate
+			candidate.Time--
+			if d, err = measure(candidate); err != nil {
+				return KDFParams{}, 0, err
+			}
+		}
+		params, elapsed = candidate, d
+		if elapsed >= target-target/10 {
+			break
+		}
+	}
+
+	return params, elapsed, nil
+}
@@ -0,0 +1,80 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// keyfileInfo separates keyfile mixing from other HKDF uses
+const keyfileInfo = "ark keyfile v1"
+
+// keyfileSize is the size of generated keyfiles
+const keyfileSize = 64
+
+// HashKeyfile returns the SHA-256 digest of a keyfile's contents. Any file
+// can serve as a keyfile, so it is streamed rather than read into memory.
+func HashKeyfile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open keyfile: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyfile: %w", err)
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("keyfile %s is empty", path)
+	}
+	return h.Sum(nil), nil
+}
+
+// MixKeyfile combines a password-derived key with a keyfile digest using
+// HKDF, so both are needed to produce the result
+func MixKeyfile(key, keyfileDigest []byte) ([]byte, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("invalid key size: expected %d bytes, got %d", KeySize, len(key))
+	}
+
+	mixed := make([]byte, KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, keyfileDigest, []byte(keyfileInfo)), mixed); err != nil {
+		return nil, fmt.Errorf("failed to mix keyfile: %w", err)
+	}
+	return mixed, nil
+}
+
+// DeriveKeyWithKeyfile derives a key from a password with DeriveKeyWithParams
+// and, when keyfileDigest is not nil, mixes in the keyfile
+func DeriveKeyWithKeyfile(password, salt []byte, params KDFParams, keyfileDigest []byte) ([]byte, error) {
+	key, err := deriveArgon2id(password, salt, params)
+	if err != nil || keyfileDigest == nil {
+		return key, err
+	}
+	defer Wipe(key)
+	return MixKeyfile(key, keyfileDigest)
+}
+
+// GenerateKeyfile writes a new random keyfile, refusing to overwrite one
+func GenerateKeyfile(path string) error {
+	data := make([]byte, keyfileSize)
+	if _, err := io.ReadFull(rand.Reader, data); err != nil {
+		return fmt.Errorf("failed to generate keyfile: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0400)
+	if err != nil {
+		return fmt.Errorf("failed to create keyfile: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write keyfile: %w", err)
+	}
+	return f.Close()
+}
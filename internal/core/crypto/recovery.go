@@ -0,0 +1,83 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// RecoverySecretSize is the size of a recovery secret in bytes
+const RecoverySecretSize = 32
+
+// recoveryEncoding is base32 without padding, which avoids easily confused
+// characters such as 0/O and 1/l
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// recoveryKeyInfo separates recovery key derivation from other HKDF uses
+const recoveryKeyInfo = "ark recovery key v1"
+
+// GenerateRecoverySecret returns a random recovery secret
+func GenerateRecoverySecret() ([]byte, error) {
+	secret := make([]byte, RecoverySecretSize)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		return nil, fmt.Errorf("failed to generate recovery secret: %w", err)
+	}
+	return secret, nil
+}
+
+// DeriveRecoveryKey derives a key-encryption key from a recovery secret.
+// The secret is random rather than chosen by a person, so HKDF suffices.
+func DeriveRecoveryKey(secret, salt []byte) ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(recoveryKeyInfo)), key); err != nil {
+		return nil, fmt.Errorf("failed to derive recovery key: %w", err)
+	}
+	return key, nil
+}
+
+// EncodeRecoveryCode formats data for writing down: base32 with a 2-byte
+// checksum, in dash-separated groups of four characters
+func EncodeRecoveryCode(data []byte) string {
+	sum := sha256.Sum256(data)
+	encoded := recoveryEncoding.EncodeToString(append(append([]byte(nil), data...), sum[:2]...))
+
+	var groups []string
+	for len(encoded) > 4 {
+		groups = append(groups, encoded[:4])
+		encoded = encoded[4:]
+	}
+	groups = append(groups, encoded)
+	return strings.Join(groups, "-")
+}
+
+// DecodeRecoveryCode parses a code written by EncodeRecoveryCode, tolerating
+// lower case and missing or extra separators, and verifies its checksum
+func DecodeRecoveryCode(code string) ([]byte, error) {
+	cleaned := strings.Map(func(r rune) rune {
+		switch {
+		case r == '-' || r == ' ' || r == '\t':
+			return -1
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return r
+	}, code)
+
+	raw, err := recoveryEncoding.DecodeString(cleaned)
+	if err != nil || len(raw) < 3 {
+		return nil, fmt.Errorf("malformed recovery code")
+	}
+
+	data, checksum := raw[:len(raw)-2], raw[len(raw)-2:]
+	sum := sha256.Sum256(data)
+	if !hmac.Equal(sum[:2], checksum) {
+		return nil, fmt.Errorf("recovery code checksum mismatch - check for typos")
+	}
+	return data, nil
+}
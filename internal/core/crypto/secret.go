@@ -0,0 +1,90 @@
+package crypto
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Secret holds key material in memory that is kept out of swap where the
+// platform allows it, and is zeroed when the Secret is closed. The zero
+// value is not usable; create one with NewSecret, and Close it when done.
+type Secret struct {
+	mu     sync.Mutex
+	buf    []byte
+	locked bool
+}
+
+// NewSecret copies b into protected memory. Locking is best effort: if the
+// memory cannot be locked, for example because RLIMIT_MEMLOCK is exhausted,
+// the secret is kept on the heap and is still zeroed on Close. The caller
+// remains responsible for wiping b.
+func NewSecret(b []byte) *Secret {
+	s := &Secret{}
+	if len(b) > 0 {
+		s.buf, s.locked = allocLocked(len(b))
+		if s.buf == nil {
+			s.buf = make([]byte, len(b))
+		}
+		copy(s.buf, b)
+	}
+	return s
+}
+
+// Bytes returns the secret. The slice aliases the protected memory, which is
+// unmapped on Close, so it must not be used after that.
+func (s *Secret) Bytes() []byte {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf
+}
+
+// Len returns the size of the secret, or zero once it is closed
+func (s *Secret) Len() int {
+	return len(s.Bytes())
+}
+
+// Locked reports whether the secret is held in locked memory
+func (s *Secret) Locked() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.locked
+}
+
+// Close zeroes the secret and releases its memory. It is safe to call more
+// than once.
+func (s *Secret) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buf == nil {
+		return nil
+	}
+	Wipe(s.buf)
+	if s.locked {
+		freeLocked(s.buf)
+	}
+	s.buf = nil
+	s.locked = false
+	return nil
+}
+
+// String keeps secrets out of logs and error messages
+func (s *Secret) String() string {
+	return "[REDACTED]"
+}
+
+// Wipe overwrites b with zeros
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+	runtime.KeepAlive(b)
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package crypto
+
+// MemoryLockSupported reports whether NewSecret can lock memory here
+const MemoryLockSupported = false
+
+// allocLocked is unavailable without mlock; secrets stay on the heap
+func allocLocked(n int) ([]byte, bool) {
+	return nil, false
+}
+
+// freeLocked is a no-op where allocLocked never succeeds
+func freeLocked(buf []byte) {}
@@ -0,0 +1,29 @@
+//go:build unix
+
+package crypto
+
+import "golang.org/x/sys/unix"
+
+// MemoryLockSupported reports whether NewSecret can lock memory here
+const MemoryLockSupported = true
+
+// allocLocked maps n bytes of anonymous memory of its own and locks it, so
+// unlocking it later cannot unlock pages shared with other allocations. It
+// returns nil if the memory cannot be mapped or locked.
+func allocLocked(n int) ([]byte, bool) {
+	buf, err := unix.Mmap(-1, 0, n, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, false
+	}
+	if err := unix.Mlock(buf); err != nil {
+		_ = unix.Munmap(buf)
+		return nil, false
+	}
+	return buf, true
+}
+
+// freeLocked unlocks and unmaps memory from allocLocked
+func freeLocked(buf []byte) {
+	_ = unix.Munlock(buf)
+	_ = unix.Munmap(buf)
+}
@@ -0,0 +1,138 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// Shamir secret sharing over GF(2^8). Each share is the secret's bytes,
+// each the value of a random polynomial of degree threshold-1 whose constant
+// term is that secret byte, evaluated at the share's x coordinate. The x
+// coordinate is appended as the share's last byte.
+
+// gfExp and gfLog are exponent and logarithm tables for GF(2^8) with the
+// AES polynomial x^8+x^4+x^3+x+1 and generator 3
+var gfExp, gfLog = buildGFTables()
+
+func buildGFTables() (exp [510]byte, log [256]byte) {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i] = x
+		exp[i+255] = x
+		log[x] = byte(i)
+		// multiply by the generator 3 = x*2 ^ x
+		hi := x & 0x80
+		x2 := x << 1
+		if hi != 0 {
+			x2 ^= 0x1b
+		}
+		x ^= x2
+	}
+	return exp, log
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// evalPolynomial evaluates coefficients (constant term first) at x
+func evalPolynomial(coefficients []byte, x byte) byte {
+	result := byte(0)
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result = gfMul(result, x) ^ coefficients[i]
+	}
+	return result
+}
+
+// SplitSecret splits secret into shares, any threshold of which recover it
+func SplitSecret(secret []byte, shares, threshold int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("secret must not be empty")
+	}
+	if threshold < 2 || threshold > shares || shares > 255 {
+		return nil, fmt.Errorf("invalid sharing scheme: need 2 <= threshold (%d) <= shares (%d) <= 255", threshold, shares)
+	}
+
+	out := make([][]byte, shares)
+	for i := range out {
+		out[i] = make([]byte, len(secret)+1)
+		out[i][len(secret)] = byte(i + 1)
+	}
+
+	coefficients := make([]byte, threshold)
+	for b, s := range secret {
+		coefficients[0] = s
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, fmt.Errorf("failed to generate polynomial: %w", err)
+		}
+		for i := range out {
+			out[i][b] = evalPolynomial(coefficients, byte(i+1))
+		}
+	}
+	zeroBytes(coefficients)
+
+	return out, nil
+}
+
+// CombineShares recovers a secret from threshold or more shares. With fewer
+// shares than the threshold the result is wrong rather than an error, so
+// callers should verify it.
+func CombineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, fmt.Errorf("at least 2 shares are required")
+	}
+	size := len(shares[0])
+	if size < 2 {
+		return nil, fmt.Errorf("invalid share")
+	}
+
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]bool)
+	for i, share := range shares {
+		if len(share) != size {
+			return nil, fmt.Errorf("shares have different lengths")
+		}
+		x := share[size-1]
+		if x == 0 || seen[x] {
+			return nil, fmt.Errorf("duplicate or invalid share")
+		}
+		seen[x] = true
+		xs[i] = x
+	}
+
+	// Lagrange interpolation at x = 0
+	secret := make([]byte, size-1)
+	for b := range secret {
+		var value byte
+		for i, share := range shares {
+			basis := byte(1)
+			for j := range shares {
+				if i == j {
+					continue
+				}
+				// xj / (xj - xi); subtraction is XOR in GF(2^8)
+				basis = gfMul(basis, gfDiv(xs[j], xs[j]^xs[i]))
+			}
+			value ^= gfMul(share[b], basis)
+		}
+		secret[b] = value
+	}
+	return secret, nil
+}
+
+// zeroBytes overwrites b with zeros
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,359 @@
+package crypto
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// StreamMagic starts every encrypted stream
+const StreamMagic = "ARKS"
+
+const (
+	// streamV1 headers are magic, version, chunk size and an AES-256-GCM nonce
+	streamV1 = 1
+	// streamV2 headers are magic, version, cipher suite, chunk size and a
+	// nonce for that suite
+	streamV2 = 2
+	// streamPrefixSize is the magic and version common to all versions
+	streamPrefixSize = len(StreamMagic) + 1
+	// streamTagSize is the AEAD tag appended to every chunk
+	streamTagSize = 16
+	// maxStreamChunkSize bounds the chunk size a reader will accept
+	maxStreamChunkSize = 16 << 20
+)
+
+// DefaultStreamChunkSize is the plaintext size of each chunk
+const DefaultStreamChunkSize = 64 * 1024
+
+// ErrStreamTruncated is returned when an encrypted stream ends before its
+// final chunk
+var ErrStreamTruncated = errors.New("encrypted stream is truncated")
+
+// Chunk flags, authenticated with every chunk so the last one cannot be
+// dropped or moved
+const (
+	chunkMore  = 0
+	chunkFinal = 1
+)
+
+// IsStream reports whether data starts with an encrypted stream header
+func IsStream(data []byte) bool {
+	return len(data) >= streamPrefixSize && string(data[:len(StreamMagic)]) == StreamMagic &&
+		(data[len(StreamMagic)] == streamV1 || data[len(StreamMagic)] == streamV2)
+}
+
+// StreamSize returns the size of the encrypted stream for plaintextSize bytes
+// written with the given cipher suite and DefaultStreamChunkSize
+func StreamSize(suiteID byte, plaintextSize int64) (int64, error) {
+	suite, err := CipherByID(suiteID)
+	if err != nil {
+		return 0, err
+	}
+	chunks := (plaintextSize + DefaultStreamChunkSize - 1) / DefaultStreamChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	header := int64(streamPrefixSize + 1 + 4 + suite.NonceSize)
+	return header + plaintextSize + chunks*streamTagSize, nil
+}
+
+// streamCipher seals and opens the chunks of one stream
+type streamCipher struct {
+	aead    cipher.AEAD
+	header  []byte
+	nonce   []byte
+	counter uint64
+}
+
+// newStreamCipher prepares to seal or open chunks under the given header,
+// which ends with the stream nonce
+func newStreamCipher(suite *CipherSuite, key, header []byte) (*streamCipher, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("invalid key size: expected %d bytes, got %d", KeySize, len(key))
+	}
+	aead, err := suite.New(key)
+	if err != nil {
+		return nil, err
+	}
+	if aead.Overhead() != streamTagSize {
+		return nil, fmt.Errorf("cipher %s cannot be used for streams", suite.Name)
+	}
+	return &streamCipher{aead: aead, header: header, nonce: make([]byte, suite.NonceSize)}, nil
+}
+
+// next returns the nonce and additional data for the next chunk. The nonce is
+// the header nonce with the chunk counter XORed into its last 8 bytes.
+func (s *streamCipher) next(flag byte) ([]byte, []byte, error) {
+	if s.counter == ^uint64(0) {
+		return nil, nil, fmt.Errorf("encrypted stream too long")
+	}
+	copy(s.nonce, s.header[len(s.header)-len(s.nonce):])
+	var ctr [8]byte
+	binary.BigEndian.PutUint64(ctr[:], s.counter)
+	for i := range ctr {
+		s.nonce[len(s.nonce)-8+i] ^= ctr[i]
+	}
+	s.counter++
+	return s.nonce, append(append([]byte(nil), s.header...), flag), nil
+}
+
+// StreamWriter encrypts everything written to it as a chunked stream
+type StreamWriter struct {
+	w      io.Writer
+	cipher *streamCipher
+	buf    []byte
+	out    []byte
+	closed bool
+}
+
+// NewStreamWriter writes a stream header to w and returns a writer that
+// encrypts into it with the default cipher suite. Close must be called to
+// write the final chunk; it does not close w.
+func NewStreamWriter(w io.Writer, key []byte) (*StreamWriter, error) {
+	return NewStreamWriterWithCipher(w, key, DefaultCipher)
+}
+
+// NewStreamWriterWithCipher is NewStreamWriter with a chosen cipher suite
+func NewStreamWriterWithCipher(w io.Writer, key []byte, suiteID byte) (*StreamWriter, error) {
+	suite, err := CipherByID(suiteID)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, streamPrefixSize+1+4+suite.NonceSize)
+	copy(header, StreamMagic)
+	header[len(StreamMagic)] = streamV2
+	header[streamPrefixSize] = suite.ID
+	binary.BigEndian.PutUint32(header[streamPrefixSize+1:], DefaultStreamChunkSize)
+	if _, err := io.ReadFull(rand.Reader, header[len(header)-suite.NonceSize:]); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sc, err := newStreamCipher(suite, key, header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, fmt.Errorf("failed to write stream header: %w", err)
+	}
+	return &StreamWriter{
+		w:      w,
+		cipher: sc,
+		buf:    make([]byte, 0, DefaultStreamChunkSize),
+		out:    make([]byte, 0, DefaultStreamChunkSize+streamTagSize),
+	}, nil
+}
+
+// Write encrypts p. A full chunk is only sealed once more data follows it,
+// so the last chunk can always be marked final by Close.
+func (s *StreamWriter) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, fmt.Errorf("write to closed stream")
+	}
+	n := 0
+	for len(p) > 0 {
+		if len(s.buf) == cap(s.buf) {
+			if err := s.seal(chunkMore); err != nil {
+				return n, err
+			}
+		}
+		k := copy(s.buf[len(s.buf):cap(s.buf)], p)
+		s.buf = s.buf[:len(s.buf)+k]
+		p = p[k:]
+		n += k
+	}
+	return n, nil
+}
+
+// Close seals the final chunk
+func (s *StreamWriter) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.seal(chunkFinal)
+}
+
+func (s *StreamWriter) seal(flag byte) error {
+	nonce, aad, err := s.cipher.next(flag)
+	if err != nil {
+		return err
+	}
+	s.out = s.cipher.aead.Seal(s.out[:0], nonce, s.buf, aad)
+	s.buf = s.buf[:0]
+	if _, err := s.w.Write(s.out); err != nil {
+		return fmt.Errorf("failed to write encrypted chunk: %w", err)
+	}
+	return nil
+}
+
+// StreamReader decrypts a stream written by StreamWriter. It never returns
+// unauthenticated data, and reports ErrStreamTruncated if the stream ends
+// before its final chunk.
+type StreamReader struct {
+	r       *bufio.Reader
+	cipher  *streamCipher
+	in      []byte
+	plain   []byte
+	pending []byte
+	done    bool
+}
+
+// ErrStreamKey is returned when none of the keys tried opens a stream
+var ErrStreamKey = errors.New("no key decrypts the encrypted stream")
+
+// NewStreamReader reads the stream header from r and returns a reader that
+// decrypts the rest of it, with whichever cipher suite the header names
+func NewStreamReader(r io.Reader, key []byte) (*StreamReader, error) {
+	s, suite, header, err := readStreamHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	s.cipher, err = newStreamCipher(suite, key, header)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewStreamReaderAnyKey is NewStreamReader for a stream encrypted with one of
+// keys. The first chunk is authenticated with each key in turn, and the
+// reader continues with the one that opens it; ErrStreamKey is returned if
+// none does.
+func NewStreamReaderAnyKey(r io.Reader, keys [][]byte) (*StreamReader, error) {
+	s, suite, header, err := readStreamHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	n, flag, err := s.readChunk()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		s.cipher, err = newStreamCipher(suite, key, header)
+		if err != nil {
+			return nil, err
+		}
+		err = s.openChunk(n, flag)
+		if err == nil {
+			return s, nil
+		}
+		if errors.Is(err, ErrStreamTruncated) {
+			return nil, err
+		}
+	}
+	return nil, ErrStreamKey
+}
+
+// readStreamHeader reads the stream header from r and returns a reader for
+// the chunks after it, still without a cipher
+func readStreamHeader(r io.Reader) (*StreamReader, *CipherSuite, []byte, error) {
+	prefix := make([]byte, streamPrefixSize)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read stream header: %w", err)
+	}
+	if !IsStream(prefix) {
+		return nil, nil, nil, fmt.Errorf("not an encrypted stream")
+	}
+
+	// Version 1 streams are always AES-256-GCM and do not name a suite
+	suiteID := CipherAESGCM
+	header := prefix
+	if prefix[len(StreamMagic)] == streamV2 {
+		id := make([]byte, 1)
+		if _, err := io.ReadFull(r, id); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to read stream header: %w", err)
+		}
+		suiteID = id[0]
+		header = append(header, id[0])
+	}
+	suite, err := CipherByID(suiteID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	rest := make([]byte, 4+suite.NonceSize)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read stream header: %w", err)
+	}
+	header = append(header, rest...)
+	chunkSize := int(binary.BigEndian.Uint32(rest))
+	if chunkSize == 0 || chunkSize > maxStreamChunkSize {
+		return nil, nil, nil, fmt.Errorf("invalid stream chunk size %d", chunkSize)
+	}
+
+	return &StreamReader{
+		r:  bufio.NewReaderSize(r, chunkSize+streamTagSize+1),
+		in: make([]byte, chunkSize+streamTagSize),
+	}, suite, header, nil
+}
+
+// Read returns decrypted data
+func (s *StreamReader) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// open reads and authenticates the next chunk
+func (s *StreamReader) open() error {
+	n, flag, err := s.readChunk()
+	if err != nil {
+		return err
+	}
+	return s.openChunk(n, flag)
+}
+
+// readChunk reads the next chunk into s.in, returning its length and whether
+// it is the last one
+func (s *StreamReader) readChunk() (int, byte, error) {
+	n, err := io.ReadFull(s.r, s.in)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return 0, 0, fmt.Errorf("failed to read encrypted chunk: %w", err)
+	}
+	if n < streamTagSize {
+		return 0, 0, ErrStreamTruncated
+	}
+
+	// A short chunk, or a full one with nothing after it, must be the last
+	flag := byte(chunkMore)
+	if n < len(s.in) {
+		flag = chunkFinal
+	} else if _, err := s.r.Peek(1); err == io.EOF {
+		flag = chunkFinal
+	}
+	return n, flag, nil
+}
+
+// openChunk authenticates the n bytes read into s.in
+func (s *StreamReader) openChunk(n int, flag byte) error {
+	nonce, aad, err := s.cipher.next(flag)
+	if err != nil {
+		return err
+	}
+	s.plain, err = s.cipher.aead.Open(s.plain[:0], nonce, s.in[:n], aad)
+	if err != nil {
+		// A non-final chunk at the end of the input means the rest was cut off
+		aad[len(aad)-1] = chunkMore
+		if _, moreErr := s.cipher.aead.Open(nil, nonce, s.in[:n], aad); flag == chunkFinal && moreErr == nil {
+			return ErrStreamTruncated
+		}
+		return fmt.Errorf("failed to decrypt chunk: %w", err)
+	}
+	s.pending = s.plain
+	s.done = flag == chunkFinal
+	return nil
+}
@@ -0,0 +1,162 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Cipher suite IDs, recorded in the header of tagged ciphertexts. IDs are
+// part of the on-disk format and must never be reused.
+const (
+	CipherAESGCM    byte = 1
+	CipherXChaCha20 byte = 2
+)
+
+// DefaultCipher is the suite used when none is configured
+const DefaultCipher = CipherAESGCM
+
+// CipherSuite is an AEAD that ciphertexts can be encrypted with
+type CipherSuite struct {
+	ID        byte
+	Name      string
+	NonceSize int
+	New       func(key []byte) (cipher.AEAD, error)
+}
+
+var (
+	suitesMu sync.RWMutex
+	suites   = map[byte]*CipherSuite{}
+)
+
+// RegisterCipher makes a cipher suite available by ID and name
+func RegisterCipher(suite *CipherSuite) {
+	suitesMu.Lock()
+	defer suitesMu.Unlock()
+	if _, dup := suites[suite.ID]; dup {
+		panic(fmt.Sprintf("crypto: cipher suite %d registered twice", suite.ID))
+	}
+	suites[suite.ID] = suite
+}
+
+// CipherByID returns the suite with the given ID
+func CipherByID(id byte) (*CipherSuite, error) {
+	suitesMu.RLock()
+	defer suitesMu.RUnlock()
+	suite, ok := suites[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown cipher suite %d", id)
+	}
+	return suite, nil
+}
+
+// CipherByName returns the suite with the given name
+func CipherByName(name string) (*CipherSuite, error) {
+	suitesMu.RLock()
+	defer suitesMu.RUnlock()
+	for _, suite := range suites {
+		if suite.Name == name {
+			return suite, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown cipher %q (available: %v)", name, cipherNamesLocked())
+}
+
+// CipherNames lists the registered suites by name
+func CipherNames() []string {
+	suitesMu.RLock()
+	defer suitesMu.RUnlock()
+	return cipherNamesLocked()
+}
+
+func cipherNamesLocked() []string {
+	names := make([]string, 0, len(suites))
+	for _, suite := range suites {
+		names = append(names, suite.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterCipher(&CipherSuite{
+		ID:        CipherAESGCM,
+		Name:      "aes-256-gcm",
+		NonceSize: NonceSize,
+		New: func(key []byte) (cipher.AEAD, error) {
+			block, err := aes.NewCipher(key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create cipher: %w", err)
+			}
+			return cipher.NewGCM(block)
+		},
+	})
+	// XChaCha20's 192-bit nonces can be picked at random without a practical
+	// limit on how many messages one key encrypts
+	RegisterCipher(&CipherSuite{
+		ID:        CipherXChaCha20,
+		Name:      "xchacha20",
+		NonceSize: chacha20poly1305.NonceSizeX,
+		New:       chacha20poly1305.NewX,
+	})
+}
+
+// SealTagged encrypts plaintext with the given suite. The output starts with
+// the suite ID, so OpenTagged can pick the suite without being told.
+func SealTagged(suiteID byte, key, plaintext, additionalData []byte) ([]byte, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("invalid key size: expected %d bytes, got %d", KeySize, len(key))
+	}
+	suite, err := CipherByID(suiteID)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := suite.New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 1+suite.NonceSize, 1+suite.NonceSize+len(plaintext)+aead.Overhead())
+	out[0] = suite.ID
+	if _, err := io.ReadFull(rand.Reader, out[1:]); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(out, out[1:], plaintext, additionalData), nil
+}
+
+// OpenTagged decrypts a ciphertext produced by SealTagged
+func OpenTagged(key, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) == 0 {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	suite, err := CipherByID(ciphertext[0])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := suite.New(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < 1+suite.NonceSize {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	plaintext, err := aead.Open(nil, ciphertext[1:1+suite.NonceSize], ciphertext[1+suite.NonceSize:], additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return plaintext, nil
+}
+
+// TaggedCipher returns the suite ID a tagged ciphertext was sealed with
+func TaggedCipher(ciphertext []byte) (byte, error) {
+	if len(ciphertext) == 0 {
+		return 0, fmt.Errorf("ciphertext too short")
+	}
+	return ciphertext[0], nil
+}
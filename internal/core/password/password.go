@@ -1,139 +1,233 @@
 package password
 
 import (
-	"bufio"
+	"crypto/subtle"
 	"fmt"
+	"io"
 	"os"
-	"strings"
 	"syscall"
 
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+	"github.com/mbeniwal-imwe/ark/internal/core/strength"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
-// SetupMasterPassword prompts the user to set up a master password
-func SetupMasterPassword() (string, error) {
+// maxPasswordLength bounds a password read from non-terminal input
+const maxPasswordLength = 4096
+
+// SetupMasterPassword prompts the user to set up a master password reaching
+// minScore. The password is returned in locked memory; the caller must Close
+// it.
+func SetupMasterPassword(minScore int) (*crypto.Secret, error) {
 	fmt.Println("Setting up master password for Ark CLI...")
 	fmt.Println("This password will be used to encrypt all your sensitive data.")
 	fmt.Println()
 
 	// Get password
-	password, err := getPassword("Enter master password: ")
+	password, err := readSecret("Enter master password: ")
 	if err != nil {
-		return "", fmt.Errorf("failed to read password: %w", err)
+		return nil, fmt.Errorf("failed to read password: %w", err)
 	}
 
-	if len(password) < 8 {
-		return "", fmt.Errorf("password must be at least 8 characters long")
+	if err := CheckStrength(password.Bytes(), minScore); err != nil {
+		password.Close()
+		return nil, err
 	}
 
 	// Confirm password
-	confirmPassword, err := getPassword("Confirm master password: ")
+	confirmPassword, err := readSecret("Confirm master password: ")
 	if err != nil {
-		return "", fmt.Errorf("failed to read confirmation password: %w", err)
+		password.Close()
+		return nil, fmt.Errorf("failed to read confirmation password: %w", err)
 	}
+	defer confirmPassword.Close()
 
-	if password != confirmPassword {
-		return "", fmt.Errorf("passwords do not match")
+	if !secretsEqual(password, confirmPassword) {
+		password.Close()
+		return nil, fmt.Errorf("passwords do not match")
 	}
 
 	fmt.Println("✅ Master password set successfully!")
 	return password, nil
 }
 
-// GetMasterPassword prompts the user for their master password
-func GetMasterPassword() (string, error) {
-	password, err := getPassword("Enter master password: ")
+// GetMasterPassword prompts for the master password and returns it in
+// locked memory. The caller must Close it.
+func GetMasterPassword() (*crypto.Secret, error) {
+	password, err := readSecret("Enter master password: ")
 	if err != nil {
-		return "", fmt.Errorf("failed to read password: %w", err)
+		return nil, fmt.Errorf("failed to read password: %w", err)
 	}
 
-	if len(password) == 0 {
-		return "", fmt.Errorf("password cannot be empty")
+	if password.Len() == 0 {
+		password.Close()
+		return nil, fmt.Errorf("password cannot be empty")
 	}
 
 	return password, nil
 }
 
-// getPassword securely reads a password from stdin
-func getPassword(prompt string) (string, error) {
-	fmt.Print(prompt)
+// GetNewMasterPassword prompts for a replacement master password reaching
+// minScore, with confirmation. The caller must Close it.
+func GetNewMasterPassword(minScore int) (*crypto.Secret, error) {
+	password, err := readSecret("Enter new master password: ")
+	if err != nil {
+		return nil, err
+	}
+
+	// Reject weak passwords before asking for confirmation
+	if err := CheckStrength(password.Bytes(), minScore); err != nil {
+		password.Close()
+		return nil, err
+	}
+
+	confirmPassword, err := readSecret("Confirm new master password: ")
+	if err != nil {
+		password.Close()
+		return nil, err
+	}
+	defer confirmPassword.Close()
+
+	if !secretsEqual(password, confirmPassword) {
+		password.Close()
+		return nil, fmt.Errorf("passwords do not match")
+	}
+
+	return password, nil
+}
+
+// readSecret securely reads a password from stdin into locked memory
+func readSecret(prompt string) (*crypto.Secret, error) {
+	// Prompt on stderr so stdout stays clean for piped output and helper protocols
+	fmt.Fprint(os.Stderr, prompt)
 
 	// Check if stdin is a terminal
 	if terminal.IsTerminal(int(syscall.Stdin)) {
-		// Read password without echoing
-		password, err := terminal.ReadPassword(int(syscall.Stdin))
-		if err != nil {
-			return "", err
+		return readTerminalPassword(int(syscall.Stdin))
+	}
+
+	// Credential helpers run with stdin wired to the calling tool, so prefer
+	// the controlling terminal when there is one
+	if tty, err := os.Open("/dev/tty"); err == nil {
+		defer tty.Close()
+		if terminal.IsTerminal(int(tty.Fd())) {
+			return readTerminalPassword(int(tty.Fd()))
 		}
-		fmt.Println() // Add newline after password input
-		return string(password), nil
 	}
 
 	// Fallback for non-terminal input (e.g., pipes)
-	reader := bufio.NewReader(os.Stdin)
-	password, err := reader.ReadString('\n')
+	return readLine(os.Stdin)
+}
+
+// readTerminalPassword reads a password from a terminal without echoing
+func readTerminalPassword(fd int) (*crypto.Secret, error) {
+	password, err := terminal.ReadPassword(fd)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	defer crypto.Wipe(password)
+	fmt.Fprintln(os.Stderr) // Add newline after password input
+	return crypto.NewSecret(password), nil
+}
 
-	return strings.TrimSpace(password), nil
+// readLine reads one line from r a byte at a time, so nothing past the line
+// is consumed and no copy of the password is left in a read buffer. Leading
+// and trailing whitespace is trimmed.
+func readLine(r io.Reader) (*crypto.Secret, error) {
+	buf := make([]byte, 0, 256)
+	defer func() { crypto.Wipe(buf[:cap(buf)]) }()
+
+	var b [1]byte
+	for {
+		n, err := r.Read(b[:])
+		if n == 1 {
+			if b[0] == '\n' {
+				break
+			}
+			if len(buf) == maxPasswordLength {
+				return nil, fmt.Errorf("password is longer than %d bytes", maxPasswordLength)
+			}
+			if len(buf) == cap(buf) {
+				grown := make([]byte, len(buf), 2*cap(buf))
+				copy(grown, buf)
+				crypto.Wipe(buf)
+				buf = grown
+			}
+			buf = append(buf, b[0])
+		}
+		if err == io.EOF && len(buf) > 0 {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	b[0] = 0
+
+	start, end := 0, len(buf)
+	for start < end && isSpace(buf[start]) {
+		start++
+	}
+	for end > start && isSpace(buf[end-1]) {
+		end--
+	}
+	return crypto.NewSecret(buf[start:end]), nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\v' || c == '\f'
 }
 
-// GetPasswordWithConfirmation prompts for a password with confirmation
-func GetPasswordWithConfirmation(prompt, confirmPrompt string) (string, error) {
-	password, err := getPassword(prompt)
+// secretsEqual compares two passwords in constant time
+func secretsEqual(a, b *crypto.Secret) bool {
+	return subtle.ConstantTimeCompare(a.Bytes(), b.Bytes()) == 1
+}
+
+// GetPasswordWithConfirmation prompts for a password with confirmation. The
+// caller must Close it.
+func GetPasswordWithConfirmation(prompt, confirmPrompt string) (*crypto.Secret, error) {
+	password, err := readSecret(prompt)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	confirmPassword, err := getPassword(confirmPrompt)
+	confirmPassword, err := readSecret(confirmPrompt)
 	if err != nil {
-		return "", err
+		password.Close()
+		return nil, err
 	}
+	defer confirmPassword.Close()
 
-	if password != confirmPassword {
-		return "", fmt.Errorf("passwords do not match")
+	if !secretsEqual(password, confirmPassword) {
+		password.Close()
+		return nil, fmt.Errorf("passwords do not match")
 	}
 
 	return password, nil
 }
 
-// ValidatePasswordStrength checks if a password meets security requirements
-func ValidatePasswordStrength(password string) error {
+// ValidatePasswordStrength checks that a password reaches the default
+// strength score
+func ValidatePasswordStrength(password []byte) error {
+	return CheckStrength(password, strength.DefaultMinScore)
+}
+
+// CheckStrength rejects passwords shorter than 8 characters or scoring below
+// minScore, explaining what makes them weak. userInputs are words specific
+// to the user that should not appear in the password.
+func CheckStrength(password []byte, minScore int, userInputs ...string) error {
 	if len(password) < 8 {
 		return fmt.Errorf("password must be at least 8 characters long")
 	}
 
-	hasUpper := false
-	hasLower := false
-	hasDigit := false
-	hasSpecial := false
-
-	for _, char := range password {
-		switch {
-		case char >= 'A' && char <= 'Z':
-			hasUpper = true
-		case char >= 'a' && char <= 'z':
-			hasLower = true
-		case char >= '0' && char <= '9':
-			hasDigit = true
-		case char >= 33 && char <= 126:
-			hasSpecial = true
-		}
-	}
-
-	if !hasUpper {
-		return fmt.Errorf("password must contain at least one uppercase letter")
-	}
-	if !hasLower {
-		return fmt.Errorf("password must contain at least one lowercase letter")
+	result := strength.EstimateBytes(password, userInputs...)
+	if result.Score >= minScore {
+		return nil
 	}
-	if !hasDigit {
-		return fmt.Errorf("password must contain at least one digit")
+	msg := fmt.Sprintf("password is too weak (strength %d of %d, at least %d required, could be cracked in %s)",
+		result.Score, strength.MaxScore, minScore, result.CrackTime)
+	if fb := result.Feedback(); fb != "" {
+		msg += ": " + fb
 	}
-	if !hasSpecial {
-		return fmt.Errorf("password must contain at least one special character")
-	}
-
-	return nil
+	return fmt.Errorf("%s", msg)
 }
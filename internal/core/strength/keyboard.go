@@ -0,0 +1,85 @@
+package strength
+
+import "strings"
+
+// qwertyLayout is a US keyboard, each key listed unshifted then shifted.
+// Rows are slanted: a key touches the two keys above it to its right.
+const qwertyLayout = "" +
+	"`~ 1! 2@ 3# 4$ 5% 6^ 7& 8* 9( 0) -_ =+\n" +
+	"    qQ wW eE rR tT yY uU iI oO pP [{ ]} \\|\n" +
+	"     aA sS dD fF gG hH jJ kK lL ;: '\"\n" +
+	"      zZ xX cC vV bB nN mM ,< .> /?"
+
+// keypadLayout is a numeric keypad, whose keys are aligned in columns
+const keypadLayout = "" +
+	"  / * -\n" +
+	"7 8 9 +\n" +
+	"4 5 6\n" +
+	"1 2 3\n" +
+	"  0 ."
+
+// graph maps each key character to its neighbours, in a fixed direction
+// order so that a change of direction can be counted as a turn. Missing
+// neighbours are empty strings.
+type graph struct {
+	name      string
+	adjacent  map[rune][]string
+	starts    float64
+	avgDegree float64
+}
+
+var (
+	qwertyGraph = buildGraph("qwerty", qwertyLayout, true)
+	keypadGraph = buildGraph("keypad", keypadLayout, false)
+	graphs      = []*graph{qwertyGraph, keypadGraph}
+)
+
+// buildGraph works out key adjacency from a layout drawing
+func buildGraph(name, layout string, slanted bool) *graph {
+	type point struct{ x, y int }
+	tokenSize := len(strings.Fields(layout)[0])
+	positions := map[point]string{}
+	for y, line := range strings.Split(layout, "\n") {
+		slant := 0
+		if slanted {
+			slant = y
+		}
+		for i := 0; i < len(line); {
+			if line[i] == ' ' {
+				i++
+				continue
+			}
+			positions[point{(i - slant) / (tokenSize + 1), y}] = line[i : i+tokenSize]
+			i += tokenSize
+		}
+	}
+
+	g := &graph{name: name, adjacent: map[rune][]string{}}
+	degree := 0
+	for p, token := range positions {
+		var dirs []point
+		if slanted {
+			dirs = []point{{-1, 0}, {0, -1}, {1, -1}, {1, 0}, {0, 1}, {-1, 1}}
+		} else {
+			dirs = []point{{-1, 0}, {-1, -1}, {0, -1}, {1, -1}, {1, 0}, {1, 1}, {0, 1}, {-1, 1}}
+		}
+		neighbours := make([]string, len(dirs))
+		for i, d := range dirs {
+			neighbours[i] = positions[point{p.x + d.x, p.y + d.y}]
+			if neighbours[i] != "" {
+				degree++
+			}
+		}
+		for _, c := range token {
+			g.adjacent[c] = neighbours
+		}
+	}
+	g.starts = float64(len(positions))
+	g.avgDegree = float64(degree) / float64(len(positions))
+	return g
+}
+
+// shifted reports whether c is typed with shift on the qwerty graph
+func shifted(c rune) bool {
+	return strings.ContainsRune(`~!@#$%^&*()_+QWERTYUIOP{}|ASDFGHJKL:"ZXCVBNM<>?`, c)
+}
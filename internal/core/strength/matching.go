@@ -0,0 +1,470 @@
+package strength
+
+import (
+	_ "embed"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Match patterns
+const (
+	PatternDictionary = "dictionary"
+	PatternSpatial    = "spatial"
+	PatternRepeat     = "repeat"
+	PatternSequence   = "sequence"
+	PatternYear       = "year"
+	PatternBruteforce = "bruteforce"
+)
+
+// Dictionary names
+const (
+	DictPasswords  = "passwords"
+	DictWords      = "words"
+	DictUserInputs = "user_inputs"
+)
+
+//go:embed data/passwords.txt
+var passwordList string
+
+//go:embed data/words.txt
+var wordList string
+
+var (
+	rankedOnce sync.Once
+	ranked     map[string]map[string]int
+)
+
+// rankedDictionaries returns the bundled dictionaries, mapping each word to
+// its rank by frequency
+func rankedDictionaries() map[string]map[string]int {
+	rankedOnce.Do(func() {
+		ranked = map[string]map[string]int{
+			DictPasswords: rankList(strings.Fields(passwordList)),
+			DictWords:     rankList(strings.Fields(wordList)),
+		}
+	})
+	return ranked
+}
+
+func rankList(words []string) map[string]int {
+	ranks := make(map[string]int, len(words))
+	for i, w := range words {
+		w = strings.ToLower(w)
+		if _, ok := ranks[w]; !ok {
+			ranks[w] = i + 1
+		}
+	}
+	return ranks
+}
+
+// Match is one part of a password that follows a guessable pattern
+type Match struct {
+	Pattern string
+	Token   string
+	Guesses float64
+	// i and j are the rune offsets of the first and last character
+	i, j int
+
+	// dictionary matches
+	dictionary string
+	rank       int
+	reversed   bool
+	l33t       bool
+	sub        map[rune]rune
+
+	// spatial matches
+	graph        *graph
+	turns        int
+	shiftedCount int
+
+	// repeat matches
+	baseToken   string
+	baseGuesses float64
+	repeatCount int
+
+	// sequence matches
+	ascending bool
+	space     int
+
+	// year matches
+	year int
+}
+
+// l33tTable lists the characters commonly substituted for each letter
+var l33tTable = map[rune][]rune{
+	'a': {'4', '@'},
+	'b': {'8'},
+	'c': {'(', '{', '[', '<'},
+	'e': {'3'},
+	'g': {'6', '9'},
+	'i': {'1', '!', '|'},
+	'l': {'1', '|', '7'},
+	'o': {'0'},
+	's': {'$', '5'},
+	't': {'+', '7'},
+	'x': {'%'},
+	'z': {'2'},
+}
+
+// maxL33tSubs bounds how many substitution tables are tried
+const maxL33tSubs = 64
+
+// omnimatch finds every pattern match in password
+func omnimatch(password []rune, userInputs map[string]int) []*Match {
+	dicts := map[string]map[string]int{}
+	for name, d := range rankedDictionaries() {
+		dicts[name] = d
+	}
+	if len(userInputs) > 0 {
+		dicts[DictUserInputs] = userInputs
+	}
+
+	var matches []*Match
+	matches = append(matches, dictionaryMatch(password, dicts)...)
+	matches = append(matches, reverseDictionaryMatch(password, dicts)...)
+	matches = append(matches, l33tMatch(password, dicts)...)
+	matches = append(matches, spatialMatch(password)...)
+	matches = append(matches, repeatMatch(password, userInputs)...)
+	matches = append(matches, sequenceMatch(password)...)
+	matches = append(matches, yearMatch(password)...)
+	sortMatches(matches)
+	return matches
+}
+
+func sortMatches(matches []*Match) {
+	sort.SliceStable(matches, func(a, b int) bool {
+		if matches[a].i != matches[b].i {
+			return matches[a].i < matches[b].i
+		}
+		return matches[a].j < matches[b].j
+	})
+}
+
+// dictionaryMatch finds every substring that is a dictionary word
+func dictionaryMatch(password []rune, dicts map[string]map[string]int) []*Match {
+	lower := make([]rune, len(password))
+	for i, c := range password {
+		lower[i] = unicode.ToLower(c)
+	}
+
+	var matches []*Match
+	for name, dict := range dicts {
+		for i := range password {
+			for j := i; j < len(password); j++ {
+				if rank, ok := dict[string(lower[i:j+1])]; ok {
+					matches = append(matches, &Match{
+						Pattern:    PatternDictionary,
+						Token:      string(password[i : j+1]),
+						i:          i,
+						j:          j,
+						dictionary: name,
+						rank:       rank,
+					})
+				}
+			}
+		}
+	}
+	return matches
+}
+
+// reverseDictionaryMatch finds dictionary words written backwards
+func reverseDictionaryMatch(password []rune, dicts map[string]map[string]int) []*Match {
+	n := len(password)
+	reversed := make([]rune, n)
+	for i, c := range password {
+		reversed[n-1-i] = c
+	}
+
+	var matches []*Match
+	for _, m := range dictionaryMatch(reversed, dicts) {
+		// Palindromes were already found forwards
+		if len([]rune(m.Token)) < 2 {
+			continue
+		}
+		m.Token = string(password[n-1-m.j : n-m.i])
+		m.i, m.j = n-1-m.j, n-1-m.i
+		m.reversed = true
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// l33tMatch finds dictionary words with predictable substitutions, such as
+// "p@ssw0rd"
+func l33tMatch(password []rune, dicts map[string]map[string]int) []*Match {
+	var matches []*Match
+	for _, sub := range l33tSubs(password) {
+		subbed := make([]rune, len(password))
+		for i, c := range password {
+			if letter, ok := sub[c]; ok {
+				subbed[i] = letter
+			} else {
+				subbed[i] = c
+			}
+		}
+
+		for _, m := range dictionaryMatch(subbed, dicts) {
+			token := password[m.i : m.j+1]
+			used := map[rune]rune{}
+			for _, c := range token {
+				if letter, ok := sub[c]; ok {
+					used[c] = letter
+				}
+			}
+			// Skip plain words and single substituted characters
+			if len(used) == 0 || len(token) <= 1 {
+				continue
+			}
+			m.Token = string(token)
+			m.l33t = true
+			m.sub = used
+			matches = append(matches, m)
+		}
+	}
+	return dedupe(matches)
+}
+
+// l33tSubs lists the ways the substitutable characters in password can be
+// read as letters. A character such as '1' can stand for more than one.
+func l33tSubs(password []rune) []map[rune]rune {
+	candidates := map[rune][]rune{}
+	for letter, subs := range l33tTable {
+		for _, s := range subs {
+			for _, c := range password {
+				if c == s {
+					candidates[s] = append(candidates[s], letter)
+					break
+				}
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	chars := make([]rune, 0, len(candidates))
+	for c := range candidates {
+		chars = append(chars, c)
+		sort.Slice(candidates[c], func(a, b int) bool { return candidates[c][a] < candidates[c][b] })
+	}
+	sort.Slice(chars, func(a, b int) bool { return chars[a] < chars[b] })
+
+	subs := []map[rune]rune{{}}
+	for _, c := range chars {
+		var next []map[rune]rune
+		for _, sub := range subs {
+			for _, letter := range candidates[c] {
+				if len(next) == maxL33tSubs {
+					break
+				}
+				extended := make(map[rune]rune, len(sub)+1)
+				for k, v := range sub {
+					extended[k] = v
+				}
+				extended[c] = letter
+				next = append(next, extended)
+			}
+		}
+		subs = next
+	}
+	return subs
+}
+
+// dedupe drops matches covering the same span of the same word, which
+// different substitution tables can produce
+func dedupe(matches []*Match) []*Match {
+	seen := map[string]bool{}
+	out := matches[:0]
+	for _, m := range matches {
+		key := strconv.Itoa(m.i) + ":" + strconv.Itoa(m.j) + ":" + m.dictionary + ":" + strconv.Itoa(m.rank)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, m)
+	}
+	return out
+}
+
+// spatialMatch finds runs of adjacent keys, such as "qwerty" or "zxcvb"
+func spatialMatch(password []rune) []*Match {
+	var matches []*Match
+	for _, g := range graphs {
+		for i := 0; i < len(password)-1; {
+			j := i + 1
+			lastDirection := -1
+			turns := 0
+			shiftedCount := 0
+			if g == qwertyGraph && shifted(password[i]) {
+				shiftedCount = 1
+			}
+
+			for {
+				found := false
+				if j < len(password) {
+					cur := password[j]
+					for dir, adj := range g.adjacent[password[j-1]] {
+						pos := strings.IndexRune(adj, cur)
+						if adj == "" || pos < 0 {
+							continue
+						}
+						found = true
+						if pos > 0 {
+							shiftedCount++
+						}
+						if lastDirection != dir {
+							turns++
+							lastDirection = dir
+						}
+						break
+					}
+				}
+				if found {
+					j++
+					continue
+				}
+				// Runs of three or more keys count as a pattern
+				if j-i > 2 {
+					matches = append(matches, &Match{
+						Pattern:      PatternSpatial,
+						Token:        string(password[i:j]),
+						i:            i,
+						j:            j - 1,
+						graph:        g,
+						turns:        turns,
+						shiftedCount: shiftedCount,
+					})
+				}
+				i = j
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// repeatMatch finds repeated characters and blocks, such as "aaa" or
+// "abcabc", preferring the longest run and then the shortest block
+func repeatMatch(password []rune, userInputs map[string]int) []*Match {
+	var matches []*Match
+	n := len(password)
+	for i := 0; i < n; {
+		bestSpan, bestBase, bestCount := 0, 0, 0
+		for base := 1; base <= (n-i)/2; base++ {
+			count := 1
+			for i+(count+1)*base <= n && string(password[i:i+base]) == string(password[i+count*base:i+(count+1)*base]) {
+				count++
+			}
+			if count >= 2 && count*base > bestSpan {
+				bestSpan, bestBase, bestCount = count*base, base, count
+			}
+		}
+		if bestSpan == 0 {
+			i++
+			continue
+		}
+
+		base := password[i : i+bestBase]
+		analysis := mostGuessableMatchSequence(base, omnimatch(base, userInputs), false)
+		matches = append(matches, &Match{
+			Pattern:     PatternRepeat,
+			Token:       string(password[i : i+bestSpan]),
+			i:           i,
+			j:           i + bestSpan - 1,
+			baseToken:   string(base),
+			baseGuesses: analysis.guesses,
+			repeatCount: bestCount,
+		})
+		i += bestSpan
+	}
+	return matches
+}
+
+// maxSequenceDelta is the largest step between characters of a sequence
+const maxSequenceDelta = 5
+
+// sequenceMatch finds runs with a constant step, such as "abcd", "2468" or
+// "9876"
+func sequenceMatch(password []rune) []*Match {
+	var matches []*Match
+	if len(password) <= 1 {
+		return matches
+	}
+
+	update := func(i, j, delta int) {
+		if j-i > 1 || abs(delta) == 1 {
+			if delta != 0 && abs(delta) <= maxSequenceDelta {
+				token := password[i : j+1]
+				space := 26
+				if allIn(token, unicode.IsDigit) {
+					space = 10
+				}
+				matches = append(matches, &Match{
+					Pattern:   PatternSequence,
+					Token:     string(token),
+					i:         i,
+					j:         j,
+					ascending: delta > 0,
+					space:     space,
+				})
+			}
+		}
+	}
+
+	i := 0
+	lastDelta := 0
+	for k := 1; k < len(password); k++ {
+		delta := int(password[k]) - int(password[k-1])
+		if k == 1 {
+			lastDelta = delta
+		}
+		if delta == lastDelta {
+			continue
+		}
+		j := k - 1
+		update(i, j, lastDelta)
+		i = j
+		lastDelta = delta
+	}
+	update(i, len(password)-1, lastDelta)
+	return matches
+}
+
+// yearMatch finds years from 1900 to 2029
+func yearMatch(password []rune) []*Match {
+	var matches []*Match
+	for i := 0; i+4 <= len(password); i++ {
+		token := string(password[i : i+4])
+		year, err := strconv.Atoi(token)
+		if err != nil || !allIn(password[i:i+4], unicode.IsDigit) || year < 1900 || year > 2029 {
+			continue
+		}
+		matches = append(matches, &Match{
+			Pattern: PatternYear,
+			Token:   token,
+			i:       i,
+			j:       i + 3,
+			year:    year,
+		})
+	}
+	return matches
+}
+
+func allIn(s []rune, f func(rune) bool) bool {
+	for _, c := range s {
+		if !f(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,296 @@
+package strength
+
+import (
+	"math"
+	"time"
+	"unicode"
+)
+
+const (
+	// bruteforceCardinality is the guesses per character of unmatched text
+	bruteforceCardinality = 10
+	// minGuessesBeforeGrowingSequence penalises splitting a password into
+	// more parts than needed
+	minGuessesBeforeGrowingSequence = 10000
+	minSubmatchGuessesSingleChar    = 10
+	minSubmatchGuessesMultiChar     = 50
+	// minYearSpace is the smallest range of years an attacker would try
+	minYearSpace = 20
+)
+
+// analysis is the cheapest way found to guess a password
+type analysis struct {
+	guesses  float64
+	sequence []*Match
+}
+
+// mostGuessableMatchSequence finds the split of password into matches and
+// unmatched runs that needs the fewest guesses. An attacker guessing a
+// sequence of l parts has to try them in every order, hence the l! factor,
+// and pays a fixed cost for each extra part.
+func mostGuessableMatchSequence(password []rune, matches []*Match, excludeAdditive bool) analysis {
+	n := len(password)
+	if n == 0 {
+		return analysis{guesses: 1}
+	}
+
+	byEnd := make([][]*Match, n)
+	for _, m := range matches {
+		byEnd[m.j] = append(byEnd[m.j], m)
+	}
+
+	// For each end position k and sequence length l, the best last match,
+	// the product of guesses along the sequence and the overall guesses
+	optM := make([]map[int]*Match, n)
+	optPi := make([]map[int]float64, n)
+	optG := make([]map[int]float64, n)
+	for k := range optM {
+		optM[k], optPi[k], optG[k] = map[int]*Match{}, map[int]float64{}, map[int]float64{}
+	}
+
+	update := func(m *Match, l int) {
+		k := m.j
+		pi := estimateGuesses(m, n)
+		if l > 1 {
+			pi *= optPi[m.i-1][l-1]
+		}
+		g := factorial(l) * pi
+		if !excludeAdditive {
+			g += math.Pow(minGuessesBeforeGrowingSequence, float64(l-1))
+		}
+		// Keep the candidate only if no shorter sequence is already as good
+		for otherL, otherG := range optG[k] {
+			if otherL <= l && otherG <= g {
+				return
+			}
+		}
+		optM[k][l], optPi[k][l], optG[k][l] = m, pi, g
+	}
+
+	bruteforce := func(i, j int) *Match {
+		return &Match{Pattern: PatternBruteforce, Token: string(password[i : j+1]), i: i, j: j}
+	}
+
+	for k := 0; k < n; k++ {
+		for _, m := range byEnd[k] {
+			if m.i > 0 {
+				for l := range optM[m.i-1] {
+					update(m, l+1)
+				}
+			} else {
+				update(m, 1)
+			}
+		}
+
+		update(bruteforce(0, k), 1)
+		for i := 1; i <= k; i++ {
+			m := bruteforce(i, k)
+			for l, last := range optM[i-1] {
+				// Two unmatched runs in a row are one longer run
+				if last.Pattern == PatternBruteforce {
+					continue
+				}
+				update(m, l+1)
+			}
+		}
+	}
+
+	// Walk back from the best sequence ending at the last character
+	bestL, bestG := 0, math.Inf(1)
+	for l, g := range optG[n-1] {
+		if g < bestG || (g == bestG && l < bestL) {
+			bestL, bestG = l, g
+		}
+	}
+	sequence := make([]*Match, bestL)
+	for k, l := n-1, bestL; k >= 0 && l > 0; l-- {
+		m := optM[k][l]
+		sequence[l-1] = m
+		k = m.i - 1
+	}
+	return analysis{guesses: bestG, sequence: sequence}
+}
+
+// estimateGuesses returns how many guesses an attacker needs for m, also
+// recording it on the match
+func estimateGuesses(m *Match, passwordLen int) float64 {
+	if m.Guesses > 0 {
+		return m.Guesses
+	}
+
+	minGuesses := 1.0
+	if tokenLen := m.j - m.i + 1; tokenLen < passwordLen {
+		minGuesses = minSubmatchGuessesMultiChar
+		if tokenLen == 1 {
+			minGuesses = minSubmatchGuessesSingleChar
+		}
+	}
+
+	var guesses float64
+	switch m.Pattern {
+	case PatternBruteforce:
+		guesses = bruteforceGuesses(m)
+	case PatternDictionary:
+		guesses = dictionaryGuesses(m)
+	case PatternSpatial:
+		guesses = spatialGuesses(m)
+	case PatternRepeat:
+		guesses = m.baseGuesses * float64(m.repeatCount)
+	case PatternSequence:
+		guesses = sequenceGuesses(m)
+	case PatternYear:
+		guesses = math.Max(math.Abs(float64(m.year-time.Now().Year())), minYearSpace)
+	}
+	m.Guesses = math.Max(guesses, minGuesses)
+	return m.Guesses
+}
+
+func bruteforceGuesses(m *Match) float64 {
+	length := float64(m.j - m.i + 1)
+	guesses := math.Pow(bruteforceCardinality, length)
+	if math.IsInf(guesses, 1) {
+		guesses = math.MaxFloat64
+	}
+	// Unmatched runs must cost more than any match of the same span
+	minGuesses := float64(minSubmatchGuessesMultiChar + 1)
+	if length == 1 {
+		minGuesses = minSubmatchGuessesSingleChar + 1
+	}
+	return math.Max(guesses, minGuesses)
+}
+
+func dictionaryGuesses(m *Match) float64 {
+	guesses := float64(m.rank) * uppercaseVariations(m.Token) * l33tVariations(m)
+	if m.reversed {
+		guesses *= 2
+	}
+	return guesses
+}
+
+// uppercaseVariations counts the capitalisations an attacker would try
+// before reaching the one used
+func uppercaseVariations(token string) float64 {
+	runes := []rune(token)
+	upper, lower := 0, 0
+	for _, c := range runes {
+		switch {
+		case unicode.IsUpper(c):
+			upper++
+		case unicode.IsLower(c):
+			lower++
+		}
+	}
+	if upper == 0 {
+		return 1
+	}
+	// Capitalised first or last letter, or all capitals, are tried first
+	firstUpper := unicode.IsUpper(runes[0]) && upper == 1
+	lastUpper := unicode.IsUpper(runes[len(runes)-1]) && upper == 1
+	if firstUpper || lastUpper || lower == 0 {
+		return 2
+	}
+
+	variations := 0.0
+	for i := 1; i <= min(upper, lower); i++ {
+		variations += nCk(upper+lower, i)
+	}
+	return variations
+}
+
+// l33tVariations counts the substitution choices an attacker would try
+func l33tVariations(m *Match) float64 {
+	if !m.l33t {
+		return 1
+	}
+	variations := 1.0
+	for subbed, letter := range m.sub {
+		s, u := 0, 0
+		for _, c := range []rune(m.Token) {
+			switch unicode.ToLower(c) {
+			case subbed:
+				s++
+			case letter:
+				u++
+			}
+		}
+		if s == 0 || u == 0 {
+			// Everything or nothing substituted: one extra guess each way
+			variations *= 2
+			continue
+		}
+		possibilities := 0.0
+		for i := 1; i <= min(s, u); i++ {
+			possibilities += nCk(s+u, i)
+		}
+		variations *= possibilities
+	}
+	return variations
+}
+
+func spatialGuesses(m *Match) float64 {
+	s, d := m.graph.starts, m.graph.avgDegree
+	length := m.j - m.i + 1
+	guesses := 0.0
+	// Sum over shorter patterns with up to the same number of turns
+	for i := 2; i <= length; i++ {
+		for j := 1; j <= min(m.turns, i-1); j++ {
+			guesses += nCk(i-1, j-1) * s * math.Pow(d, float64(j))
+		}
+	}
+
+	if m.shiftedCount > 0 {
+		shiftedCount, unshifted := m.shiftedCount, length-m.shiftedCount
+		if unshifted == 0 {
+			guesses *= 2
+		} else {
+			variations := 0.0
+			for i := 1; i <= min(shiftedCount, unshifted); i++ {
+				variations += nCk(shiftedCount+unshifted, i)
+			}
+			guesses *= variations
+		}
+	}
+	return guesses
+}
+
+func sequenceGuesses(m *Match) float64 {
+	first := []rune(m.Token)[0]
+	var base float64
+	switch {
+	case first == 'a' || first == 'A' || first == 'z' || first == 'Z' || first == '0' || first == '1' || first == '9':
+		// Obvious starting points are tried first
+		base = 4
+	case unicode.IsDigit(first):
+		base = 10
+	default:
+		base = float64(m.space)
+	}
+	if !m.ascending {
+		base *= 2
+	}
+	return base * float64(m.j-m.i+1)
+}
+
+func nCk(n, k int) float64 {
+	if k > n {
+		return 0
+	}
+	if k == 0 {
+		return 1
+	}
+	r := 1.0
+	for d := 1; d <= k; d++ {
+		r *= float64(n)
+		r /= float64(d)
+		n--
+	}
+	return r
+}
+
+func factorial(n int) float64 {
+	f := 1.0
+	for i := 2; i <= n; i++ {
+		f *= float64(i)
+	}
+	return f
+}
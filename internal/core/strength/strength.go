@@ -0,0 +1,242 @@
+// Package strength estimates how hard a password is to guess. It follows
+// the approach of zxcvbn: the password is split into the cheapest sequence
+// of guessable patterns - dictionary words, keyboard runs, repeats,
+// sequences and years - and the guesses needed for each are multiplied.
+package strength
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// MaxScore is the score of the strongest passwords
+const MaxScore = 4
+
+// DefaultMinScore is the score a master password must reach unless
+// configured otherwise
+const DefaultMinScore = 3
+
+// maxLength bounds the part of a password that is analysed, as matching is
+// quadratic in its length. Anything longer is strong anyway.
+const maxLength = 100
+
+// offlineGuessesPerSecond is an attacker with the vault file guessing
+// against a slow hash such as Argon2id
+const offlineGuessesPerSecond = 1e4
+
+// Result is the strength estimate for a password
+type Result struct {
+	// Score is from 0 (too guessable) to 4 (very unguessable)
+	Score int
+	// Guesses is the estimated number of guesses needed
+	Guesses float64
+	// CrackTime describes how long an offline attack would take
+	CrackTime string
+	// Warning explains what makes the password weak, if anything
+	Warning string
+	// Suggestions are ways to make the password stronger
+	Suggestions []string
+	// Sequence is the split of the password the estimate is based on
+	Sequence []*Match
+}
+
+// Estimate rates password. userInputs are words specific to the user, such
+// as their name or email address, which make a password easier to guess.
+func Estimate(password string, userInputs ...string) Result {
+	return estimate([]rune(password), userInputs)
+}
+
+// EstimateBytes is Estimate for a password held as UTF-8 bytes, so it never
+// has to become a string that cannot be wiped
+func EstimateBytes(password []byte, userInputs ...string) Result {
+	runes := bytes.Runes(password)
+	defer func() {
+		for i := range runes {
+			runes[i] = 0
+		}
+	}()
+	return estimate(runes, userInputs)
+}
+
+func estimate(runes []rune, userInputs []string) Result {
+	if len(runes) > maxLength {
+		runes = runes[:maxLength]
+	}
+
+	inputs := map[string]int{}
+	for i, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if _, ok := inputs[input]; input != "" && !ok {
+			inputs[input] = i + 1
+		}
+	}
+
+	a := mostGuessableMatchSequence(runes, omnimatch(runes, inputs), false)
+	score := guessesToScore(a.guesses)
+	warning, suggestions := feedback(score, a.sequence)
+	return Result{
+		Score:       score,
+		Guesses:     a.guesses,
+		CrackTime:   displayTime(a.guesses / offlineGuessesPerSecond),
+		Warning:     warning,
+		Suggestions: suggestions,
+		Sequence:    a.sequence,
+	}
+}
+
+// Feedback joins the warning and suggestions into one message
+func (r Result) Feedback() string {
+	parts := make([]string, 0, len(r.Suggestions)+1)
+	if r.Warning != "" {
+		parts = append(parts, r.Warning+".")
+	}
+	for _, s := range r.Suggestions {
+		parts = append(parts, s+".")
+	}
+	return strings.Join(parts, " ")
+}
+
+// guessesToScore buckets guesses into a score. The small margin keeps
+// passwords just over a threshold from rounding down.
+func guessesToScore(guesses float64) int {
+	const delta = 5
+	switch {
+	case guesses < 1e3+delta:
+		return 0
+	case guesses < 1e6+delta:
+		return 1
+	case guesses < 1e8+delta:
+		return 2
+	case guesses < 1e10+delta:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// feedback explains a score, based on the longest pattern found
+func feedback(score int, sequence []*Match) (string, []string) {
+	if len(sequence) == 0 {
+		return "", []string{
+			"Use a few words, avoid common phrases",
+			"No need for symbols, digits, or uppercase letters",
+		}
+	}
+	if score > 2 {
+		return "", nil
+	}
+
+	longest := sequence[0]
+	for _, m := range sequence[1:] {
+		if len([]rune(m.Token)) > len([]rune(longest.Token)) {
+			longest = m
+		}
+	}
+
+	warning, suggestions := matchFeedback(longest, len(sequence) == 1)
+	return warning, append([]string{"Add another word or two. Uncommon words are better"}, suggestions...)
+}
+
+func matchFeedback(m *Match, soleMatch bool) (string, []string) {
+	switch m.Pattern {
+	case PatternDictionary:
+		return dictionaryFeedback(m, soleMatch)
+	case PatternSpatial:
+		warning := "Short keyboard patterns are easy to guess"
+		if m.turns == 1 {
+			warning = "Straight rows of keys are easy to guess"
+		}
+		return warning, []string{"Use a longer keyboard pattern with more turns"}
+	case PatternRepeat:
+		warning := `Repeats like "abcabcabc" are only slightly harder to guess than "abc"`
+		if len([]rune(m.baseToken)) == 1 {
+			warning = `Repeats like "aaa" are easy to guess`
+		}
+		return warning, []string{"Avoid repeated words and characters"}
+	case PatternSequence:
+		return "Sequences like abc or 6543 are easy to guess", []string{"Avoid sequences"}
+	case PatternYear:
+		return "Recent years are easy to guess", []string{"Avoid recent years", "Avoid years that are associated with you"}
+	}
+	return "", nil
+}
+
+func dictionaryFeedback(m *Match, soleMatch bool) (string, []string) {
+	var warning string
+	switch m.dictionary {
+	case DictPasswords:
+		switch {
+		case soleMatch && !m.l33t && !m.reversed && m.rank <= 10:
+			warning = "This is a top-10 common password"
+		case soleMatch && !m.l33t && !m.reversed && m.rank <= 100:
+			warning = "This is a top-100 common password"
+		case soleMatch && !m.l33t && !m.reversed:
+			warning = "This is a very common password"
+		case math.Log10(m.Guesses) <= 4:
+			warning = "This is similar to a commonly used password"
+		}
+	case DictWords:
+		if soleMatch {
+			warning = "A word by itself is easy to guess"
+		}
+	case DictUserInputs:
+		warning = "Avoid names, usernames and other personal details"
+	}
+
+	var suggestions []string
+	runes := []rune(m.Token)
+	lower := strings.ToLower(m.Token)
+	switch {
+	case unicode.IsUpper(runes[0]) && m.Token != strings.ToUpper(m.Token):
+		suggestions = append(suggestions, "Capitalization doesn't help very much")
+	case m.Token == strings.ToUpper(m.Token) && m.Token != lower:
+		suggestions = append(suggestions, "All-uppercase is almost as easy to guess as all-lowercase")
+	}
+	if m.reversed && len(runes) >= 4 {
+		suggestions = append(suggestions, "Reversed words aren't much harder to guess")
+	}
+	if m.l33t {
+		suggestions = append(suggestions, "Predictable substitutions like '@' instead of 'a' don't help very much")
+	}
+	return warning, suggestions
+}
+
+// displayTime describes a duration in seconds for people
+func displayTime(seconds float64) string {
+	const (
+		minute  = 60.0
+		hour    = minute * 60
+		day     = hour * 24
+		month   = day * 31
+		year    = month * 12
+		century = year * 100
+	)
+	unit := func(n float64, name string) string {
+		v := int(math.Round(n))
+		if v != 1 {
+			name += "s"
+		}
+		return fmt.Sprintf("%d %s", v, name)
+	}
+	switch {
+	case seconds < 1:
+		return "less than a second"
+	case seconds < minute:
+		return unit(seconds, "second")
+	case seconds < hour:
+		return unit(seconds/minute, "minute")
+	case seconds < day:
+		return unit(seconds/hour, "hour")
+	case seconds < month:
+		return unit(seconds/day, "day")
+	case seconds < year:
+		return unit(seconds/month, "month")
+	case seconds < century:
+		return unit(seconds/year, "year")
+	default:
+		return "centuries"
+	}
+}
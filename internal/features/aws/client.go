@@ -18,7 +18,7 @@ type Client struct {
 }
 
 // NewClient creates an AWS client from a stored profile
-func NewClient(ctx context.Context, db *storage.Database, profileName string) (*Client, error) {
+func NewClient(ctx context.Context, db storage.Store, profileName string) (*Client, error) {
 	// Load profile from database
 	var prof models.AWSProfile
 	if err := db.Get("aws_profiles", profileName, &prof); err != nil {
@@ -0,0 +1,292 @@
+package awsfeat
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/mbeniwal-imwe/ark/internal/storage/models"
+)
+
+// MetadataExpiration is the profile metadata key holding the credential expiry (RFC3339)
+const MetadataExpiration = "expiration"
+
+// CredentialProcessOutput is the document a credential_process command prints
+type CredentialProcessOutput struct {
+	Version         int    `json:"Version"`
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"SessionToken,omitempty"`
+	Expiration      string `json:"Expiration,omitempty"`
+}
+
+// GetProfile loads a stored profile by name
+func (s *Service) GetProfile(name string) (*models.AWSProfile, error) {
+	var prof models.AWSProfile
+	if err := s.DB.Get("aws_profiles", name, &prof); err != nil {
+		return nil, fmt.Errorf("profile not found: %s", name)
+	}
+	return &prof, nil
+}
+
+// CredentialProcess returns the credential_process document for a stored profile
+func (s *Service) CredentialProcess(name string) (*CredentialProcessOutput, error) {
+	prof, err := s.GetProfile(name)
+	if err != nil {
+		return nil, err
+	}
+	if prof.AccessKeyID == "" || prof.SecretKey == "" {
+		return nil, fmt.Errorf("profile %s has no stored access keys", name)
+	}
+
+	out := &CredentialProcessOutput{
+		Version:         1,
+		AccessKeyID:     prof.AccessKeyID,
+		SecretAccessKey: prof.SecretKey,
+		SessionToken:    prof.SessionToken,
+	}
+
+	// Long-term keys have no expiry; temporary ones carry it in metadata
+	if exp := prof.Metadata[MetadataExpiration]; exp != "" {
+		t, err := time.Parse(time.RFC3339, exp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiration for profile %s: %w", name, err)
+		}
+		if time.Now().After(t) {
+			return nil, fmt.Errorf("stored credentials for profile %s expired at %s", name, exp)
+		}
+		out.Expiration = t.UTC().Format(time.RFC3339)
+	}
+
+	return out, nil
+}
+
+// WireOptions controls how credential_process stanzas are written
+type WireOptions struct {
+	// Command is the ark invocation prefix, e.g. "/usr/local/bin/ark"
+	Command string
+	// RemovePlaintext strips static keys for wired profiles from ~/.aws/credentials
+	RemovePlaintext bool
+}
+
+// WireCredentialProcess points the named profiles in ~/.aws/config at
+// `ark aws credential-process`. It returns the number of profiles wired.
+func WireCredentialProcess(home string, names []string, opts WireOptions) (int, error) {
+	awsDir := filepath.Join(home, ".aws")
+	if err := os.MkdirAll(awsDir, 0700); err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", awsDir, err)
+	}
+
+	configPath := filepath.Join(awsDir, "config")
+	content, err := readIniFile(configPath)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, name := range names {
+		if strings.ContainsAny(name, "\r\n") {
+			return 0, fmt.Errorf("invalid profile name %q", name)
+		}
+	}
+	for _, name := range names {
+		value := fmt.Sprintf("%s aws credential-process %s", opts.Command, ShellQuote(name))
+		content = setIniValue(content, configSection(name), "credential_process", value)
+	}
+	if err := writeIniFile(configPath, content); err != nil {
+		return 0, err
+	}
+
+	if opts.RemovePlaintext {
+		credsPath := filepath.Join(awsDir, "credentials")
+		creds, err := readIniFile(credsPath)
+		if err != nil {
+			return 0, err
+		}
+		if creds != "" {
+			// Keep a copy in case the stored profiles turn out to be stale
+			if err := os.WriteFile(credsPath+".ark-backup", []byte(creds), 0600); err != nil {
+				return 0, fmt.Errorf("failed to back up credentials file: %w", err)
+			}
+			for _, name := range names {
+				creds = removeIniKeys(creds, name, "aws_access_key_id", "aws_secret_access_key", "aws_session_token")
+			}
+			if err := writeIniFile(credsPath, creds); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return len(names), nil
+}
+
+// ShellQuote quotes s as a single word for the shell the SDKs run
+// credential_process with. Words of plain characters are left as they are;
+// anything else is single-quoted, which disables every expansion. Windows
+// runs the command with cmd.exe, which only understands double quotes.
+func ShellQuote(s string) string {
+	plain := s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("@%+=:,./_-", r))
+	}) < 0
+	if plain {
+		return s
+	}
+	if runtime.GOOS == "windows" {
+		return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// configSection returns the ~/.aws/config section name for a profile
+func configSection(name string) string {
+	if name == "default" {
+		return name
+	}
+	return "profile " + name
+}
+
+func readIniFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return string(data), nil
+}
+
+func writeIniFile(path, content string) error {
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// iniSectionName returns the section name if line is a section header
+func iniSectionName(line string) (string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+		return strings.TrimSpace(trimmed[1 : len(trimmed)-1]), true
+	}
+	return "", false
+}
+
+// iniKey returns the lower-cased key of a key = value line
+func iniKey(line string) string {
+	if eq := strings.IndexByte(line, '='); eq != -1 {
+		return strings.ToLower(strings.TrimSpace(line[:eq]))
+	}
+	return ""
+}
+
+// setIniValue sets key in section, replacing an existing value or appending
+// the key (and the section when missing) while leaving other lines untouched
+func setIniValue(content, section, key, value string) string {
+	lines := splitLines(content)
+	entry := fmt.Sprintf("%s = %s", key, value)
+
+	start, end := -1, len(lines)
+	for i, line := range lines {
+		if name, ok := iniSectionName(line); ok {
+			if start != -1 {
+				end = i
+				break
+			}
+			if name == section {
+				start = i
+			}
+		}
+	}
+
+	if start == -1 {
+		if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "["+section+"]", entry)
+		return joinLines(lines)
+	}
+
+	for i := start + 1; i < end; i++ {
+		if iniKey(lines[i]) == key {
+			lines[i] = entry
+			return joinLines(lines)
+		}
+	}
+
+	// Insert after the last non-blank line of the section
+	insert := end
+	for insert > start+1 && strings.TrimSpace(lines[insert-1]) == "" {
+		insert--
+	}
+	lines = append(lines[:insert], append([]string{entry}, lines[insert:]...)...)
+	return joinLines(lines)
+}
+
+// removeIniKeys drops the given keys from section, and the section header
+// itself when nothing else remains in it
+func removeIniKeys(content, section string, keys ...string) string {
+	drop := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		drop[k] = true
+	}
+
+	var out []string
+	var sectionLines []string
+	inSection := false
+	flush := func() {
+		remaining := false
+		for _, l := range sectionLines[1:] {
+			t := strings.TrimSpace(l)
+			if t != "" && !strings.HasPrefix(t, "#") && !strings.HasPrefix(t, ";") {
+				remaining = true
+				break
+			}
+		}
+		if remaining {
+			out = append(out, sectionLines...)
+		}
+		sectionLines = nil
+	}
+
+	for _, line := range splitLines(content) {
+		if name, ok := iniSectionName(line); ok {
+			if inSection {
+				flush()
+			}
+			inSection = name == section
+			if inSection {
+				sectionLines = []string{line}
+				continue
+			}
+		}
+		if inSection {
+			if !drop[iniKey(line)] {
+				sectionLines = append(sectionLines, line)
+			}
+			continue
+		}
+		out = append(out, line)
+	}
+	if inSection {
+		flush()
+	}
+
+	return joinLines(out)
+}
+
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimRight(content, "\n"), "\n")
+}
+
+func joinLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
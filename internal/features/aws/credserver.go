@@ -0,0 +1,285 @@
+package awsfeat
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/mbeniwal-imwe/ark/internal/storage/models"
+)
+
+const (
+	// imdsTokenHeader carries an IMDSv2 session token on metadata requests
+	imdsTokenHeader = "X-aws-ec2-metadata-token"
+	// imdsTokenTTLHeader carries the requested token lifetime on token requests
+	imdsTokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+	// maxIMDSTokenTTL is the longest token lifetime IMDS accepts (6 hours)
+	maxIMDSTokenTTL = 21600
+	// staticCredentialLifetime is the expiry advertised for long-term keys so
+	// clients come back periodically instead of caching them forever
+	staticCredentialLifetime = time.Hour
+	// refreshWindow is how long before expiry served credentials are renewed
+	refreshWindow = 5 * time.Minute
+)
+
+// ServedCredentials are the credentials handed out by the local server
+type ServedCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+}
+
+// CredentialSource produces credentials for the server to serve
+type CredentialSource func(ctx context.Context) (*ServedCredentials, error)
+
+// ProfileSource serves the keys of a stored profile as they are
+func ProfileSource(prof *models.AWSProfile) CredentialSource {
+	return func(ctx context.Context) (*ServedCredentials, error) {
+		creds := &ServedCredentials{
+			AccessKeyID:     prof.AccessKeyID,
+			SecretAccessKey: prof.SecretKey,
+			SessionToken:    prof.SessionToken,
+			Expiration:      time.Now().Add(staticCredentialLifetime),
+		}
+		if exp := prof.Metadata[MetadataExpiration]; exp != "" {
+			t, err := time.Parse(time.RFC3339, exp)
+			if err != nil {
+				return nil, fmt.Errorf("invalid expiration for profile %s: %w", prof.Name, err)
+			}
+			if time.Now().After(t) {
+				return nil, fmt.Errorf("stored credentials for profile %s expired at %s", prof.Name, exp)
+			}
+			creds.Expiration = t
+		}
+		return creds, nil
+	}
+}
+
+// SessionSource serves short-lived credentials obtained from STS
+// GetSessionToken using the stored profile's long-term keys
+func SessionSource(client *Client, duration time.Duration) CredentialSource {
+	stsClient := sts.NewFromConfig(client.Config)
+	return func(ctx context.Context) (*ServedCredentials, error) {
+		out, err := stsClient.GetSessionToken(ctx, &sts.GetSessionTokenInput{
+			DurationSeconds: aws.Int32(int32(duration.Seconds())),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get session token: %w", err)
+		}
+		return &ServedCredentials{
+			AccessKeyID:     aws.ToString(out.Credentials.AccessKeyId),
+			SecretAccessKey: aws.ToString(out.Credentials.SecretAccessKey),
+			SessionToken:    aws.ToString(out.Credentials.SessionToken),
+			Expiration:      aws.ToTime(out.Credentials.Expiration),
+		}, nil
+	}
+}
+
+// CredentialServer emulates the EC2 instance metadata (IMDSv2) and ECS
+// container credential endpoints on top of a CredentialSource
+type CredentialServer struct {
+	Source CredentialSource
+	// RoleName is reported by the IMDS security-credentials listing
+	RoleName string
+	// Region is reported by the IMDS placement endpoint
+	Region string
+	// AuthToken, when set, must be sent as the Authorization header on the
+	// ECS endpoint (AWS_CONTAINER_AUTHORIZATION_TOKEN)
+	AuthToken string
+
+	mu     sync.Mutex
+	cached *ServedCredentials
+	tokens map[string]time.Time
+}
+
+// Handler returns the HTTP handler serving both endpoint families
+func (s *CredentialServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/latest/api/token", s.handleIMDSToken)
+	mux.HandleFunc("/latest/meta-data/iam/security-credentials/", s.handleIMDSCredentials)
+	mux.HandleFunc("/latest/meta-data/placement/region", s.handleIMDSRegion)
+	mux.HandleFunc("/latest/dynamic/instance-identity/document", s.handleIMDSIdentity)
+	mux.HandleFunc("/creds", s.handleContainerCredentials)
+	return mux
+}
+
+// credentials returns cached credentials, refreshing them near expiry
+func (s *CredentialServer) credentials(ctx context.Context) (*ServedCredentials, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cached != nil && time.Until(s.cached.Expiration) > refreshWindow {
+		return s.cached, nil
+	}
+
+	creds, err := s.Source(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.cached = creds
+	return creds, nil
+}
+
+func (s *CredentialServer) handleIMDSToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Like IMDS, refuse requests that came through a proxy
+	if r.Header.Get("X-Forwarded-For") != "" {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	ttl, err := strconv.Atoi(r.Header.Get(imdsTokenTTLHeader))
+	if err != nil || ttl < 1 || ttl > maxIMDSTokenTTL {
+		http.Error(w, "invalid token ttl", http.StatusBadRequest)
+		return
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		http.Error(w, "failed to issue token", http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	if s.tokens == nil {
+		s.tokens = make(map[string]time.Time)
+	}
+	now := time.Now()
+	for t, exp := range s.tokens {
+		if now.After(exp) {
+			delete(s.tokens, t)
+		}
+	}
+	s.tokens[token] = now.Add(time.Duration(ttl) * time.Second)
+	s.mu.Unlock()
+
+	w.Header().Set(imdsTokenTTLHeader, strconv.Itoa(ttl))
+	w.Write([]byte(token))
+}
+
+// validIMDSToken reports whether the request carries a live IMDSv2 token
+func (s *CredentialServer) validIMDSToken(r *http.Request) bool {
+	token := r.Header.Get(imdsTokenHeader)
+	if token == "" {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	exp, ok := s.tokens[token]
+	return ok && time.Now().Before(exp)
+}
+
+func (s *CredentialServer) handleIMDSCredentials(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.validIMDSToken(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	role := strings.TrimPrefix(r.URL.Path, "/latest/meta-data/iam/security-credentials/")
+	if role == "" {
+		w.Write([]byte(s.RoleName))
+		return
+	}
+	if role != s.RoleName {
+		http.NotFound(w, r)
+		return
+	}
+
+	creds, err := s.credentials(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]string{
+		"Code":            "Success",
+		"LastUpdated":     time.Now().UTC().Format(time.RFC3339),
+		"Type":            "AWS-HMAC",
+		"AccessKeyId":     creds.AccessKeyID,
+		"SecretAccessKey": creds.SecretAccessKey,
+		"Token":           creds.SessionToken,
+		"Expiration":      creds.Expiration.UTC().Format(time.RFC3339),
+	})
+}
+
+func (s *CredentialServer) handleIMDSRegion(w http.ResponseWriter, r *http.Request) {
+	if !s.validIMDSToken(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.Write([]byte(s.Region))
+}
+
+// handleIMDSIdentity serves a minimal identity document, which is where the
+// SDKs read the region from
+func (s *CredentialServer) handleIMDSIdentity(w http.ResponseWriter, r *http.Request) {
+	if !s.validIMDSToken(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, map[string]string{
+		"region":     s.Region,
+		"instanceId": "i-ark-local",
+	})
+}
+
+func (s *CredentialServer) handleContainerCredentials(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.AuthToken != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(s.AuthToken)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	creds, err := s.credentials(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]string{
+		"AccessKeyId":     creds.AccessKeyID,
+		"SecretAccessKey": creds.SecretAccessKey,
+		"Token":           creds.SessionToken,
+		"Expiration":      creds.Expiration.UTC().Format(time.RFC3339),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// randomToken returns a random hex token
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// NewAuthToken returns a random token for the container endpoint
+func NewAuthToken() (string, error) {
+	return randomToken()
+}
@@ -10,24 +10,36 @@ import (
 	"github.com/mbeniwal-imwe/ark/internal/storage/models"
 )
 
+// registeredInstances is the collection of registered instances, indexed by
+// instance ID
+func registeredInstances(db storage.Store) *storage.Collection[models.EC2Instance] {
+	return storage.NewCollection(db, "ec2_instances", storage.Index[models.EC2Instance]{
+		Name:   "instance_id",
+		Values: func(i *models.EC2Instance) []string { return []string{i.InstanceID} },
+	})
+}
+
 // EC2Service handles EC2 operations
 type EC2Service struct {
 	Client *Client
 	EC2    *ec2.Client
-	DB     *storage.Database
+	DB     storage.Store
+	// Profile is the stored AWS profile the service was created with
+	Profile string
 }
 
 // NewEC2Service creates a new EC2 service
-func NewEC2Service(ctx context.Context, db *storage.Database, profileName string) (*EC2Service, error) {
+func NewEC2Service(ctx context.Context, db storage.Store, profileName string) (*EC2Service, error) {
 	client, err := NewClient(ctx, db, profileName)
 	if err != nil {
 		return nil, err
 	}
 
 	return &EC2Service{
-		Client: client,
-		EC2:    ec2.NewFromConfig(client.Config),
-		DB:     db,
+		Client:  client,
+		EC2:     ec2.NewFromConfig(client.Config),
+		DB:      db,
+		Profile: profileName,
 	}, nil
 }
 
@@ -94,6 +106,7 @@ func (s *EC2Service) RegisterInstance(ctx context.Context, name, instanceID, ssh
 	// Create EC2 instance record
 	rec := models.NewEC2Instance(name, instanceID, string(instance.InstanceType))
 	rec.SetState(string(instance.State.Name))
+	rec.Profile = s.Profile
 
 	// Set IP addresses
 	var publicIP, privateIP string
@@ -114,34 +127,46 @@ func (s *EC2Service) RegisterInstance(ctx context.Context, name, instanceID, ssh
 		rec.SetSSHConfig(sshKeyPath, user)
 	}
 
-	// Store in database
-	return s.DB.Set("ec2_instances", name, rec)
+	// Store in database, making sure the profile was not removed meanwhile
+	return s.DB.Update(func(tx *storage.Tx) error {
+		if s.Profile != "" {
+			exists, err := tx.Exists("aws_profiles", s.Profile)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return fmt.Errorf("AWS profile %s not found", s.Profile)
+			}
+		}
+		return registeredInstances(s.DB).In(tx).Put(name, rec)
+	})
 }
 
-// GetRegisteredInstance retrieves a registered instance by name
+// GetRegisteredInstance retrieves a registered instance by name, or else by
+// its instance ID
 func (s *EC2Service) GetRegisteredInstance(name string) (*models.EC2Instance, error) {
-	var rec models.EC2Instance
-	if err := s.DB.Get("ec2_instances", name, &rec); err != nil {
+	instances := registeredInstances(s.DB)
+	if rec, err := instances.Get(name); err == nil {
+		return rec, nil
+	}
+	page, err := instances.Scan(storage.Query{Index: "instance_id", Value: name, Limit: 1})
+	if err != nil || len(page.Items) == 0 {
 		return nil, fmt.Errorf("registered instance not found: %s", name)
 	}
-	return &rec, nil
+	return page.Items[0].Value, nil
 }
 
 // ListRegisteredInstances lists all registered instances
 func (s *EC2Service) ListRegisteredInstances() ([]models.EC2Instance, error) {
-	keys, err := s.DB.List("ec2_instances")
+	registered, err := registeredInstances(s.DB).List()
 	if err != nil {
 		return nil, err
 	}
 
 	var instances []models.EC2Instance
-	for _, key := range keys {
-		var rec models.EC2Instance
-		if err := s.DB.Get("ec2_instances", key, &rec); err == nil {
-			instances = append(instances, rec)
-		}
+	for _, rec := range registered {
+		instances = append(instances, *rec)
 	}
-
 	return instances, nil
 }
 
@@ -10,6 +10,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
 	"github.com/mbeniwal-imwe/ark/internal/storage"
 )
 
@@ -20,7 +21,7 @@ type S3Service struct {
 }
 
 // NewS3Service creates a new S3 service for a profile
-func NewS3Service(ctx context.Context, db *storage.Database, profileName string) (*S3Service, error) {
+func NewS3Service(ctx context.Context, db storage.Store, profileName string) (*S3Service, error) {
 	client, err := NewClient(ctx, db, profileName)
 	if err != nil {
 		return nil, err
@@ -91,3 +92,102 @@ func (s *S3Service) DownloadFile(ctx context.Context, bucket, key, localPath str
 	_, err = io.Copy(f, out.Body)
 	return err
 }
+
+// UploadEncrypted encrypts whatever write produces into s3://bucket/key as
+// a chunked stream with the given cipher suite. The ciphertext is staged in a temporary file, so memory
+// use does not grow with the payload and the upload can be retried.
+func (s *S3Service) UploadEncrypted(ctx context.Context, bucket, key string, encKey []byte, suiteID byte, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp("", "ark-upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	sw, err := crypto.NewStreamWriterWithCipher(tmp, encKey, suiteID)
+	if err != nil {
+		return err
+	}
+	if err := write(sw); err != nil {
+		return err
+	}
+	if err := sw.Close(); err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	_, err = s.S3.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   tmp,
+	})
+	if err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+	return nil
+}
+
+// UploadFileEncrypted encrypts a local file client-side and uploads it to
+// s3://bucket/key
+func (s *S3Service) UploadFileEncrypted(ctx context.Context, localPath, bucket, key string, encKey []byte, suiteID byte) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return s.UploadEncrypted(ctx, bucket, key, encKey, suiteID, func(w io.Writer) error {
+		_, err := io.Copy(w, f)
+		return err
+	})
+}
+
+// OpenObject returns the body of s3://bucket/key
+func (s *S3Service) OpenObject(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	out, err := s.S3.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("download failed: %w", err)
+	}
+	return out.Body, nil
+}
+
+// DownloadFileDecrypted downloads s3://bucket/key, which must have been
+// uploaded with UploadFileEncrypted under one of encKeys, and decrypts it to
+// localPath (directory or file). Nothing is left at localPath if the object
+// fails to decrypt.
+func (s *S3Service) DownloadFileDecrypted(ctx context.Context, bucket, key, localPath string, encKeys [][]byte) error {
+	body, err := s.OpenObject(ctx, bucket, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	sr, err := crypto.NewStreamReaderAnyKey(body, encKeys)
+	if err != nil {
+		return err
+	}
+
+	dstPath := localPath
+	if fi, err := os.Stat(localPath); err == nil && fi.IsDir() {
+		dstPath = filepath.Join(localPath, filepath.Base(key))
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dstPath), ".ark-download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, sr); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to decrypt s3://%s/%s: %w", bucket, key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dstPath)
+}
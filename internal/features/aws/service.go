@@ -15,7 +15,7 @@ import (
 )
 
 type Service struct {
-	DB *storage.Database
+	DB storage.Store
 }
 
 // ImportFromAWSDir parses ~/.aws/credentials and ~/.aws/config and stores profiles
@@ -71,24 +71,26 @@ func (s *Service) ImportFromAWSDir(home string) (int, error) {
 		if prof.AccessKeyID == "" || prof.SecretKey == "" {
 			continue
 		}
-		if err := s.DB.Set("aws_profiles", name, prof); err == nil {
+		if err := s.profiles().Put(name, prof); err == nil {
 			count++
 		}
 	}
 	return count, nil
 }
 
+// profiles is the collection of stored AWS profiles
+func (s *Service) profiles() *storage.Collection[models.AWSProfile] {
+	return storage.NewCollection[models.AWSProfile](s.DB, "aws_profiles")
+}
+
 func (s *Service) ListProfiles() ([]models.AWSProfile, error) {
-	keys, err := s.DB.List("aws_profiles")
+	profiles, err := s.profiles().List()
 	if err != nil {
 		return nil, err
 	}
 	var out []models.AWSProfile
-	for _, k := range keys {
-		var p models.AWSProfile
-		if err := s.DB.Get("aws_profiles", k, &p); err == nil {
-			out = append(out, p)
-		}
+	for _, p := range profiles {
+		out = append(out, *p)
 	}
 	return out, nil
 }
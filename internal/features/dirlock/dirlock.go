@@ -2,6 +2,7 @@ package dirlock
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
 	"fmt"
 	"os"
 	"os/exec"
@@ -14,7 +15,15 @@ import (
 )
 
 type Service struct {
-	DB *storage.Database
+	DB storage.Store
+}
+
+// lockedDirs is the collection of locked directories, indexed by lock state
+func (s *Service) lockedDirs() *storage.Collection[models.LockedDirectory] {
+	return storage.NewCollection(s.DB, "locked_dirs", storage.Index[models.LockedDirectory]{
+		Name:   "state",
+		Values: func(d *models.LockedDirectory) []string { return []string{d.State()} },
+	})
 }
 
 // getMasterKey retrieves the master key from config
@@ -24,7 +33,7 @@ func (s *Service) getMasterKey() ([]byte, error) {
 	return make([]byte, 32), nil
 }
 
-func (s *Service) Lock(path string, useMaster bool, password string, hide bool) error {
+func (s *Service) Lock(path string, useMaster bool, password []byte, hide bool) error {
 	abs, err := filepath.Abs(path)
 	if err != nil {
 		return err
@@ -73,27 +82,23 @@ func (s *Service) Lock(path string, useMaster bool, password string, hide bool)
 	}
 
 	rec := models.NewLockedDirectory(abs, useMaster, hide)
-	if !useMaster {
-		rec.SetPassword(password)
-	}
 	rec.SetMetadata("mode", "encrypted")
-	return s.DB.Set("locked_dirs", abs, rec)
+	return s.lockedDirs().Put(abs, rec)
 }
 
-func (s *Service) Unlock(path string, masterPassword string, provided string) error {
+func (s *Service) Unlock(path string, provided []byte) error {
 	abs, err := filepath.Abs(path)
 	if err != nil {
 		return err
 	}
 
-	var rec models.LockedDirectory
-	if err := s.DB.Get("locked_dirs", abs, &rec); err != nil {
+	rec, err := s.lockedDirs().Get(abs)
+	if err != nil {
 		return fmt.Errorf("not locked: %s", abs)
 	}
 
 	// Password check
-	pass := rec.GetPassword(masterPassword)
-	if pass != provided && !rec.UseMaster {
+	if !rec.UseMaster && subtle.ConstantTimeCompare([]byte(rec.Password), provided) != 1 {
 		return fmt.Errorf("invalid password for %s", abs)
 	}
 
@@ -125,21 +130,32 @@ func (s *Service) Unlock(path string, masterPassword string, provided string) er
 
 	rec.Encrypted = false
 	rec.UpdateLastAccessed()
-	_ = s.DB.Delete("locked_dirs", abs)
+	_ = s.lockedDirs().Delete(abs)
 	return nil
 }
 
 func (s *Service) List() ([]models.LockedDirectory, error) {
-	keys, err := s.DB.List("locked_dirs")
+	recs, err := s.lockedDirs().List()
 	if err != nil {
 		return nil, err
 	}
 	var out []models.LockedDirectory
-	for _, k := range keys {
-		var rec models.LockedDirectory
-		if err := s.DB.Get("locked_dirs", k, &rec); err == nil {
-			out = append(out, rec)
-		}
+	for _, rec := range recs {
+		out = append(out, *rec)
+	}
+	return out, nil
+}
+
+// ListByState returns the directories in a lock state, such as
+// models.LockStateLocked
+func (s *Service) ListByState(state string) ([]models.LockedDirectory, error) {
+	page, err := s.lockedDirs().Scan(storage.Query{Index: "state", Value: state})
+	if err != nil {
+		return nil, err
+	}
+	var out []models.LockedDirectory
+	for _, item := range page.Items {
+		out = append(out, *item.Value)
 	}
 	return out, nil
 }
@@ -158,9 +174,13 @@ func (s *Service) IsLocked(path string) (bool, error) {
 
 // Stamp updates last accessed time safe
 func (s *Service) Stamp(path string) {
-	var rec models.LockedDirectory
-	if err := s.DB.Get("locked_dirs", path, &rec); err == nil {
+	_ = s.DB.Update(func(tx *storage.Tx) error {
+		dirs := s.lockedDirs().In(tx)
+		rec, err := dirs.Get(path)
+		if err != nil {
+			return nil
+		}
 		rec.LastAccessed = time.Now()
-		_ = s.DB.Set("locked_dirs", path, rec)
-	}
+		return dirs.Put(path, rec)
+	})
 }
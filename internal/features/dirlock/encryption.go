@@ -2,9 +2,9 @@ package dirlock
 
 import (
 	"archive/zip"
+	"bufio"
 	"crypto/aes"
 	"crypto/cipher"
-	"crypto/rand"
 	"fmt"
 	"io"
 	"os"
@@ -21,10 +21,8 @@ func EncryptDirectory(dirPath string, key []byte) error {
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
 	zipWriter := zip.NewWriter(file)
-	defer zipWriter.Close()
 
 	// Walk directory and encrypt files
 	err = filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
@@ -37,30 +35,23 @@ func EncryptDirectory(dirPath string, key []byte) error {
 			return nil
 		}
 
-		// Read file content
-		content, err := os.ReadFile(path)
-		if err != nil {
-			return err
-		}
-
-		// Encrypt content
-		encrypted, err := encryptContent(content, key)
-		if err != nil {
-			return err
-		}
-
-		// Add to zip
+		// Add to zip, encrypting the content as it streams in
 		relPath, _ := filepath.Rel(dirPath, path)
 		zipFile, err := zipWriter.Create(relPath)
 		if err != nil {
 			return err
 		}
-
-		_, err = zipFile.Write(encrypted)
-		return err
+		return encryptFile(path, zipFile, key)
 	})
-
+	if err == nil {
+		// Writes the central directory - the archive is incomplete without it
+		err = zipWriter.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
+		os.Remove(archivePath)
 		return err
 	}
 
@@ -109,24 +100,6 @@ func DecryptDirectory(dirPath string, key []byte) error {
 
 	// Extract and decrypt files
 	for _, zipFile := range zipReader.File {
-		// Read encrypted content
-		rc, err := zipFile.Open()
-		if err != nil {
-			return err
-		}
-
-		encrypted, err := io.ReadAll(rc)
-		rc.Close()
-		if err != nil {
-			return err
-		}
-
-		// Decrypt content
-		decrypted, err := decryptContent(encrypted, key)
-		if err != nil {
-			return err
-		}
-
 		// Write decrypted file
 		filePath := filepath.Join(tempDir, zipFile.Name)
 		err = os.MkdirAll(filepath.Dir(filePath), 0700)
@@ -134,9 +107,8 @@ func DecryptDirectory(dirPath string, key []byte) error {
 			return err
 		}
 
-		err = os.WriteFile(filePath, decrypted, 0644)
-		if err != nil {
-			return err
+		if err := decryptFile(zipFile, filePath, key); err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", zipFile.Name, err)
 		}
 	}
 
@@ -150,28 +122,63 @@ func DecryptDirectory(dirPath string, key []byte) error {
 	return os.Rename(tempDir, dirPath)
 }
 
-// encryptContent encrypts file content using AES-256-GCM
-func encryptContent(content []byte, key []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
+// encryptFile streams the file at path into w as an encrypted stream
+func encryptFile(path string, w io.Writer, key []byte) error {
+	f, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer f.Close()
 
-	gcm, err := cipher.NewGCM(block)
+	sw, err := crypto.NewStreamWriter(w, key)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if _, err := io.Copy(sw, f); err != nil {
+		return err
 	}
+	return sw.Close()
+}
 
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, err
+// decryptFile writes the decrypted content of an archive entry to path.
+// Entries locked before streaming encryption are whole AES-GCM blobs.
+func decryptFile(zipFile *zip.File, path string, key []byte) error {
+	rc, err := zipFile.Open()
+	if err != nil {
+		return err
 	}
+	defer rc.Close()
 
-	ciphertext := gcm.Seal(nonce, nonce, content, nil)
-	return ciphertext, nil
+	r := bufio.NewReader(rc)
+	magic, _ := r.Peek(len(crypto.StreamMagic) + 1)
+	if !crypto.IsStream(magic) {
+		encrypted, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		decrypted, err := decryptContent(encrypted, key)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, decrypted, 0644)
+	}
+
+	sr, err := crypto.NewStreamReader(r, key)
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, sr); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
 }
 
-// decryptContent decrypts file content using AES-256-GCM
+// decryptContent decrypts file content locked as a single AES-256-GCM blob
 func decryptContent(encrypted []byte, key []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
@@ -213,6 +220,6 @@ func isEncryptedDirectory(dirPath string) bool {
 }
 
 // deriveKeyFromPassword derives encryption key from password
-func deriveKeyFromPassword(password string, salt []byte) ([]byte, error) {
-	return crypto.DeriveKey(password, salt)
+func deriveKeyFromPassword(password, salt []byte) ([]byte, error) {
+	return crypto.DeriveKeyWithKeyfile(password, salt, crypto.LegacyKDFParams, nil)
 }
@@ -0,0 +1,177 @@
+package dockercred
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mbeniwal-imwe/ark/internal/storage/vault"
+)
+
+// KeyPrefix is the vault key prefix used for registry credentials
+const KeyPrefix = "docker/"
+
+// ErrCredentialsNotFound is reported to docker when no credentials exist.
+// The message is part of the protocol and must not change.
+var ErrCredentialsNotFound = errors.New("credentials not found in native keychain")
+
+// Credentials is the payload exchanged with docker for a registry login
+type Credentials struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// storedCredentials is the JSON value kept in the vault entry
+type storedCredentials struct {
+	ServerURL string `json:"server_url"`
+	Username  string `json:"username"`
+	Secret    string `json:"secret"`
+}
+
+// Helper implements the docker-credential-helpers operations on top of the vault
+type Helper struct {
+	Vault *vault.VaultManager
+}
+
+// vaultKey returns the vault key a registry's credentials are stored under
+func vaultKey(serverURL string) string {
+	return KeyPrefix + serverURL
+}
+
+// Get returns the credentials stored for a registry
+func (h *Helper) Get(serverURL string) (*Credentials, error) {
+	if serverURL == "" {
+		return nil, fmt.Errorf("no credentials server URL")
+	}
+
+	key := vaultKey(serverURL)
+	exists, err := h.Vault.Exists(key)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrCredentialsNotFound
+	}
+
+	entry, err := h.Vault.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := entry.Fields()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credentials{
+		ServerURL: serverURL,
+		Username:  fields["username"],
+		Secret:    fields["secret"],
+	}, nil
+}
+
+// Store saves a registry login in the vault
+func (h *Helper) Store(creds *Credentials) error {
+	if creds.ServerURL == "" {
+		return fmt.Errorf("no credentials server URL")
+	}
+	if creds.Username == "" {
+		return fmt.Errorf("no credentials username")
+	}
+
+	data, err := json.Marshal(storedCredentials{
+		ServerURL: creds.ServerURL,
+		Username:  creds.Username,
+		Secret:    creds.Secret,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal credentials: %w", err)
+	}
+
+	description := fmt.Sprintf("Docker registry login for %s", creds.ServerURL)
+	return h.Vault.Set(vaultKey(creds.ServerURL), string(data), "json", description, []string{"docker"})
+}
+
+// Erase removes the credentials stored for a registry
+func (h *Helper) Erase(serverURL string) error {
+	if serverURL == "" {
+		return fmt.Errorf("no credentials server URL")
+	}
+
+	key := vaultKey(serverURL)
+	exists, err := h.Vault.Exists(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrCredentialsNotFound
+	}
+
+	return h.Vault.Delete(key)
+}
+
+// List returns the stored registries mapped to their usernames
+func (h *Helper) List() (map[string]string, error) {
+	entries, err := h.Vault.ListByPrefix(KeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		username, _ := entry.Field("username")
+		out[strings.TrimPrefix(entry.Key, KeyPrefix)] = username
+	}
+
+	return out, nil
+}
+
+// Serve runs a single protocol action, reading the request from in and
+// writing the response to out
+func Serve(h *Helper, action string, in io.Reader, out io.Writer) error {
+	switch action {
+	case "get":
+		serverURL, err := readServerURL(in)
+		if err != nil {
+			return err
+		}
+		creds, err := h.Get(serverURL)
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(out).Encode(creds)
+	case "store":
+		var creds Credentials
+		if err := json.NewDecoder(in).Decode(&creds); err != nil {
+			return fmt.Errorf("failed to decode credentials: %w", err)
+		}
+		return h.Store(&creds)
+	case "erase":
+		serverURL, err := readServerURL(in)
+		if err != nil {
+			return err
+		}
+		return h.Erase(serverURL)
+	case "list":
+		list, err := h.List()
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(out).Encode(list)
+	default:
+		return fmt.Errorf("unknown credential action: %s", action)
+	}
+}
+
+// readServerURL reads the registry server URL sent by docker
+func readServerURL(in io.Reader) (string, error) {
+	reader := bufio.NewReader(in)
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read server URL: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
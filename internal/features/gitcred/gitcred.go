@@ -0,0 +1,209 @@
+package gitcred
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/mbeniwal-imwe/ark/internal/storage/vault"
+)
+
+// KeyPrefix is the vault key prefix used for git credentials
+const KeyPrefix = "git/"
+
+// Credential represents a credential description exchanged with git
+// over the credential-helper protocol (see gitcredentials(7))
+type Credential struct {
+	Protocol string `json:"protocol,omitempty"`
+	Host     string `json:"host"`
+	Path     string `json:"path,omitempty"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Parse reads a credential description from r until a blank line or EOF
+func Parse(r io.Reader) (*Credential, error) {
+	cred := &Credential{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			break
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if eq == -1 {
+			return nil, fmt.Errorf("invalid credential line: %q", line)
+		}
+		key, value := line[:eq], line[eq+1:]
+
+		switch key {
+		case "protocol":
+			cred.Protocol = value
+		case "host":
+			cred.Host = value
+		case "path":
+			cred.Path = value
+		case "username":
+			cred.Username = value
+		case "password":
+			cred.Password = value
+		case "url":
+			if err := cred.applyURL(value); err != nil {
+				return nil, err
+			}
+		default:
+			// Unknown attributes (capabilities, expiry, oauth tokens) are ignored
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read credential: %w", err)
+	}
+
+	return cred, nil
+}
+
+// applyURL fills in the fields carried by a url= attribute
+func (c *Credential) applyURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid credential url: %w", err)
+	}
+	c.Protocol = u.Scheme
+	c.Host = u.Host
+	c.Path = strings.TrimPrefix(u.Path, "/")
+	if u.User != nil {
+		c.Username = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			c.Password = p
+		}
+	}
+	return nil
+}
+
+// Write writes the credential to w in the credential-helper format
+func (c *Credential) Write(w io.Writer) error {
+	attrs := []struct{ key, value string }{
+		{"protocol", c.Protocol},
+		{"host", c.Host},
+		{"username", c.Username},
+		{"password", c.Password},
+	}
+	for _, attr := range attrs {
+		if attr.value == "" {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s\n", attr.key, attr.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VaultKey returns the vault key the credential is stored under
+func (c *Credential) VaultKey() string {
+	if c.Path != "" {
+		return KeyPrefix + c.Host + "/" + strings.Trim(c.Path, "/")
+	}
+	return KeyPrefix + c.Host
+}
+
+// lookupKeys returns the vault keys to try for a lookup, most specific first
+func (c *Credential) lookupKeys() []string {
+	if c.Path != "" {
+		return []string{c.VaultKey(), KeyPrefix + c.Host}
+	}
+	return []string{c.VaultKey()}
+}
+
+// Helper implements the git credential-helper operations on top of the vault
+type Helper struct {
+	Vault *vault.VaultManager
+}
+
+// Get looks up a stored credential matching the request. It returns nil
+// when nothing matches so git can fall back to its other helpers.
+func (h *Helper) Get(req *Credential) (*Credential, error) {
+	if req.Host == "" {
+		return nil, nil
+	}
+
+	for _, key := range req.lookupKeys() {
+		exists, err := h.Vault.Exists(key)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+
+		entry, err := h.Vault.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		fields, err := entry.Fields()
+		if err != nil {
+			return nil, err
+		}
+
+		if req.Protocol != "" && fields["protocol"] != "" && fields["protocol"] != req.Protocol {
+			continue
+		}
+		if req.Username != "" && fields["username"] != req.Username {
+			continue
+		}
+
+		return &Credential{
+			Protocol: req.Protocol,
+			Host:     req.Host,
+			Username: fields["username"],
+			Password: fields["password"],
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// Store saves a credential approved by git in the vault
+func (h *Helper) Store(cred *Credential) error {
+	if cred.Host == "" || cred.Username == "" || cred.Password == "" {
+		// git only expects complete credentials to be stored
+		return nil
+	}
+
+	data, err := json.Marshal(cred)
+	if err != nil {
+		return fmt.Errorf("failed to marshal credential: %w", err)
+	}
+
+	description := fmt.Sprintf("Git credential for %s", cred.Host)
+	return h.Vault.Set(cred.VaultKey(), string(data), "json", description, []string{"git"})
+}
+
+// Erase removes a credential rejected by git from the vault
+func (h *Helper) Erase(cred *Credential) error {
+	if cred.Host == "" {
+		return nil
+	}
+
+	key := cred.VaultKey()
+	exists, err := h.Vault.Exists(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	if cred.Username != "" {
+		username, err := h.Vault.GetField(key, "username")
+		if err == nil && username != cred.Username {
+			return nil
+		}
+	}
+
+	return h.Vault.Delete(key)
+}
@@ -0,0 +1,155 @@
+package recovery
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+	"github.com/mbeniwal-imwe/ark/internal/storage"
+	"rsc.io/qr"
+)
+
+// CreateCode adds a recovery key slot and returns its one-time recovery code
+func CreateCode(db *storage.Database) (string, *storage.KeySlot, error) {
+	secret, err := crypto.GenerateRecoverySecret()
+	if err != nil {
+		return "", nil, err
+	}
+	slot, err := addSlot(db, secret)
+	if err != nil {
+		return "", nil, err
+	}
+	return crypto.EncodeRecoveryCode(secret), slot, nil
+}
+
+// CreateShares adds a recovery key slot whose secret is split into Shamir
+// shares, any threshold of which restore access
+func CreateShares(db *storage.Database, shares, threshold int) ([]string, *storage.KeySlot, error) {
+	secret, err := crypto.GenerateRecoverySecret()
+	if err != nil {
+		return nil, nil, err
+	}
+	parts, err := crypto.SplitSecret(secret, shares, threshold)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	slot, err := addSlot(db, secret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Each share carries the threshold so restore knows how many to ask for
+	encoded := make([]string, len(parts))
+	for i, part := range parts {
+		encoded[i] = crypto.EncodeRecoveryCode(append([]byte{byte(threshold)}, part...))
+	}
+	return encoded, slot, nil
+}
+
+// addSlot wraps the data key under a key derived from secret
+func addSlot(db *storage.Database, secret []byte) (*storage.KeySlot, error) {
+	salt, err := crypto.GenerateSalt()
+	if err != nil {
+		return nil, err
+	}
+	kek, err := crypto.DeriveRecoveryKey(secret, salt)
+	if err != nil {
+		return nil, err
+	}
+	return db.AddKeySlot(storage.SlotTypeRecovery, salt, kek)
+}
+
+// ParseCode returns the secret in a recovery code
+func ParseCode(code string) ([]byte, error) {
+	secret, err := crypto.DecodeRecoveryCode(code)
+	if err != nil {
+		return nil, err
+	}
+	if len(secret) != crypto.RecoverySecretSize {
+		return nil, fmt.Errorf("not a recovery code - did you enter a share?")
+	}
+	return secret, nil
+}
+
+// ParseShare returns a share and the number of shares needed to restore
+func ParseShare(share string) ([]byte, int, error) {
+	data, err := crypto.DecodeRecoveryCode(share)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(data) != crypto.RecoverySecretSize+2 {
+		return nil, 0, fmt.Errorf("not a recovery share")
+	}
+	return data[1:], int(data[0]), nil
+}
+
+// CombineShares recovers the recovery secret from parsed shares
+func CombineShares(shares [][]byte) ([]byte, error) {
+	return crypto.CombineShares(shares)
+}
+
+// Open unlocks the database with a recovery secret
+func Open(dbPath string, secret []byte) (*storage.Database, error) {
+	slots, err := storage.ReadKeySlots(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, slot := range slots {
+		if slot.Type != storage.SlotTypeRecovery {
+			continue
+		}
+		kek, err := crypto.DeriveRecoveryKey(secret, slot.Salt)
+		if err != nil {
+			return nil, err
+		}
+		db, err := storage.NewDatabase(dbPath, kek)
+		if errors.Is(err, storage.ErrInvalidKey) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	}
+	return nil, fmt.Errorf("recovery code does not match any recovery key slot")
+}
+
+// QR renders text as a QR code for a terminal, two modules per character
+// row. Light modules are drawn filled, which reads correctly on the usual
+// dark terminal background.
+func QR(text string) (string, error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode QR code: %w", err)
+	}
+
+	const quiet = 2
+	light := func(x, y int) bool {
+		if x < 0 || y < 0 || x >= code.Size || y >= code.Size {
+			return true
+		}
+		return !code.Black(x, y)
+	}
+
+	var b strings.Builder
+	for y := -quiet; y < code.Size+quiet; y += 2 {
+		for x := -quiet; x < code.Size+quiet; x++ {
+			top, bottom := light(x, y), light(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Storage backends
+const (
+	BackendBolt   = "bbolt"
+	BackendSQLite = "sqlite"
+	BackendMemory = "memory"
+)
+
+// DefaultBackend is used for new databases when no backend is configured
+const DefaultBackend = BackendBolt
+
+// ErrBucketNotFound is returned by DeleteBucket for a bucket that does not exist
+var ErrBucketNotFound = errors.New("bucket not found")
+
+// sqliteHeader starts every SQLite database file
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// Backend is the raw key/value store beneath a Database. It only ever sees
+// encrypted records and plaintext bookkeeping, so records can be copied
+// between backends as they are.
+type Backend interface {
+	// Kind returns the backend name, one of the Backend* constants
+	Kind() string
+	// View runs fn in a read-only transaction
+	View(fn func(tx BackendTx) error) error
+	// Update runs fn in a read-write transaction, which is rolled back if
+	// fn returns an error
+	Update(fn func(tx BackendTx) error) error
+	// Check verifies the store's own consistency
+	Check() []error
+	// Snapshot writes a consistent copy of the store in its file format
+	Snapshot(w io.Writer) error
+	// Space reports how the pages of the store's file are used
+	Space() (Space, error)
+	Close() error
+}
+
+// Space describes how the pages of a backend's file are used. Deleting
+// records frees pages, which are reused before the file grows but are never
+// given back until the file is compacted.
+type Space struct {
+	PageSize  int
+	Pages     int
+	FreePages int
+}
+
+// BackendTx is a transaction on a Backend. Buckets and the byte slices they
+// return are only valid until the transaction ends.
+type BackendTx interface {
+	// Bucket returns the named bucket, or nil if it does not exist
+	Bucket(name []byte) BackendBucket
+	CreateBucketIfNotExists(name []byte) (BackendBucket, error)
+	// DeleteBucket returns ErrBucketNotFound if the bucket does not exist
+	DeleteBucket(name []byte) error
+	// ForEach calls fn for every bucket in name order
+	ForEach(fn func(name []byte, b BackendBucket) error) error
+}
+
+// BackendBucket is a bucket of keys within a BackendTx
+type BackendBucket interface {
+	// Get returns the value of key, or nil if it does not exist
+	Get(key []byte) []byte
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	// ForEach calls fn for every key in byte order. fn may modify the
+	// bucket only once ForEach has returned.
+	ForEach(fn func(key, value []byte) error) error
+	// KeyN counts the keys in the bucket, including uncommitted ones
+	KeyN() int
+}
+
+// errStop ends a ForEach early without failing it
+var errStop = errors.New("stop")
+
+// firstRecord returns the first key and value in b, or nil if it is empty
+func firstRecord(b BackendBucket) ([]byte, []byte) {
+	var key, value []byte
+	b.ForEach(func(k, v []byte) error {
+		key, value = k, v
+		return errStop
+	})
+	return key, value
+}
+
+// openBackend opens the store at path, creating it with opts.Backend if it
+// does not exist. An existing file is opened with the backend it was written
+// by. The memory backend has no file and ignores path.
+func openBackend(path string, opts Options) (Backend, error) {
+	if opts.Backend == BackendMemory {
+		return newMemoryBackend(), nil
+	}
+	detected, err := DetectBackend(path)
+	if err != nil {
+		return nil, err
+	}
+	if detected == "" && opts.ReadOnly {
+		return nil, fmt.Errorf("%w: %s does not exist yet", errNeedsWrite, path)
+	}
+	kind := opts.Backend
+	if detected != "" {
+		kind = detected
+	}
+	if kind == "" {
+		kind = DefaultBackend
+	}
+
+	switch kind {
+	case BackendBolt:
+		return openBoltBackend(path, opts)
+	case BackendSQLite:
+		return openSQLiteBackend(path, opts.ReadOnly)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", kind)
+	}
+}
+
+// DetectBackend returns the backend that wrote the database file at path,
+// or "" if there is no database there yet
+func DetectBackend(path string) (string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to open database: %w", err)
+	}
+	defer f.Close()
+
+	header := make([]byte, len(sqliteHeader))
+	n, err := io.ReadFull(f, header)
+	switch {
+	case n == 0:
+		return "", nil
+	case err == nil && bytes.Equal(header, sqliteHeader):
+		return BackendSQLite, nil
+	default:
+		return BackendBolt, nil
+	}
+}
+
+// ValidBackend reports whether kind names a backend databases can be stored in
+func ValidBackend(kind string) bool {
+	return kind == BackendBolt || kind == BackendSQLite
+}
+
+// copyBuckets copies every bucket of src into dst as it is stored
+func copyBuckets(dst, src Backend) error {
+	return src.View(func(in BackendTx) error {
+		return dst.Update(func(out BackendTx) error {
+			return in.ForEach(func(name []byte, b BackendBucket) error {
+				copied, err := out.CreateBucketIfNotExists(name)
+				if err != nil {
+					return fmt.Errorf("failed to create bucket %s: %w", name, err)
+				}
+				return b.ForEach(func(key, value []byte) error {
+					return copied.Put(key, value)
+				})
+			})
+		})
+	})
+}
+
+// writeSnapshot writes a snapshot of b to a new file at path
+func writeSnapshot(b Backend, path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := b.Snapshot(f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// boltBackend stores the database in a bbolt file. bbolt locks the whole
+// file while it is open: shared for read-only opens, exclusive otherwise.
+type boltBackend struct {
+	db       *bbolt.DB
+	path     string
+	readOnly bool
+}
+
+// openBoltBackend opens a bbolt file, retrying with backoff while another
+// process holds it, and records this process as its holder
+func openBoltBackend(path string, opts Options) (*boltBackend, error) {
+	var db *bbolt.DB
+	err := retryLocked(path, opts.LockTimeout, opts.Waiting, bbolt.ErrTimeout, func() error {
+		var err error
+		// The shortest timeout makes bbolt try the lock exactly once
+		db, err = bbolt.Open(path, 0600, &bbolt.Options{
+			Timeout:  time.Nanosecond,
+			ReadOnly: opts.ReadOnly,
+			// Read-only opens skip the freelist otherwise, which Space needs
+			PreLoadFreelist: true,
+		})
+		return err
+	})
+	if errors.Is(err, ErrLocked) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	writeLockOwner(path, opts.ReadOnly)
+	return &boltBackend{db: db, path: path, readOnly: opts.ReadOnly}, nil
+}
+
+func (b *boltBackend) Kind() string { return BackendBolt }
+
+func (b *boltBackend) View(fn func(tx BackendTx) error) error {
+	return b.db.View(func(tx *bbolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+func (b *boltBackend) Update(fn func(tx BackendTx) error) error {
+	if b.readOnly {
+		return ErrReadOnly
+	}
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+func (b *boltBackend) Check() []error {
+	var errs []error
+	b.db.View(func(tx *bbolt.Tx) error {
+		for err := range tx.Check() {
+			errs = append(errs, err)
+		}
+		return nil
+	})
+	return errs
+}
+
+func (b *boltBackend) Snapshot(w io.Writer) error {
+	return b.db.View(func(tx *bbolt.Tx) error {
+		_, err := tx.WriteTo(w)
+		return err
+	})
+}
+
+func (b *boltBackend) Space() (Space, error) {
+	space := Space{PageSize: b.db.Info().PageSize}
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		space.Pages = int(tx.Size()) / space.PageSize
+		return nil
+	})
+	stats := b.db.Stats()
+	space.FreePages = stats.FreePageN + stats.PendingPageN
+	return space, err
+}
+
+// compactTxMaxSize bounds the transactions compactInto copies records in
+const compactTxMaxSize = 1 << 20
+
+// compactInto copies every bucket into the empty dst, which leaves out the
+// free pages of b
+func (b *boltBackend) compactInto(dst *boltBackend) error {
+	return bbolt.Compact(dst.db, b.db, compactTxMaxSize)
+}
+
+func (b *boltBackend) Close() error {
+	removeLockOwner(b.path)
+	return b.db.Close()
+}
+
+type boltTx struct {
+	tx *bbolt.Tx
+}
+
+func (t boltTx) Bucket(name []byte) BackendBucket {
+	b := t.tx.Bucket(name)
+	if b == nil {
+		return nil
+	}
+	return boltBucket{b}
+}
+
+func (t boltTx) CreateBucketIfNotExists(name []byte) (BackendBucket, error) {
+	b, err := t.tx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return nil, err
+	}
+	return boltBucket{b}, nil
+}
+
+func (t boltTx) DeleteBucket(name []byte) error {
+	if err := t.tx.DeleteBucket(name); err != nil {
+		if err == bbolt.ErrBucketNotFound {
+			return ErrBucketNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (t boltTx) ForEach(fn func(name []byte, b BackendBucket) error) error {
+	return t.tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+		return fn(name, boltBucket{b})
+	})
+}
+
+type boltBucket struct {
+	b *bbolt.Bucket
+}
+
+func (b boltBucket) Get(key []byte) []byte       { return b.b.Get(key) }
+func (b boltBucket) Put(key, value []byte) error { return b.b.Put(key, value) }
+func (b boltBucket) Delete(key []byte) error     { return b.b.Delete(key) }
+
+func (b boltBucket) ForEach(fn func(key, value []byte) error) error {
+	return b.b.ForEach(fn)
+}
+
+// KeyN walks a cursor, since bucket stats leave out uncommitted keys
+func (b boltBucket) KeyN() int {
+	n := 0
+	c := b.b.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// errReadOnlyTx is returned when a read-only transaction is written to
+var errReadOnlyTx = errors.New("transaction is read-only")
+
+// memoryBackend keeps the database in memory, for tests. Write transactions
+// work on a copy that replaces the data only if they succeed.
+type memoryBackend struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string][]byte
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{buckets: map[string]map[string][]byte{}}
+}
+
+func (m *memoryBackend) Kind() string { return BackendMemory }
+
+func (m *memoryBackend) View(fn func(tx BackendTx) error) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return fn(&memoryTx{buckets: m.buckets})
+}
+
+func (m *memoryBackend) Update(fn func(tx BackendTx) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	working := make(map[string]map[string][]byte, len(m.buckets))
+	for name, b := range m.buckets {
+		copied := make(map[string][]byte, len(b))
+		for k, v := range b {
+			copied[k] = v
+		}
+		working[name] = copied
+	}
+
+	if err := fn(&memoryTx{buckets: working, writable: true}); err != nil {
+		return err
+	}
+	m.buckets = working
+	return nil
+}
+
+func (m *memoryBackend) Check() []error { return nil }
+
+// Snapshot writes the data as a bbolt file, so a backup of an in-memory
+// database can be restored into a real one
+func (m *memoryBackend) Snapshot(w io.Writer) error {
+	dir, err := os.MkdirTemp("", "ark-snapshot")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	snapshot, err := openBoltBackend(filepath.Join(dir, "ark.db"), Options{})
+	if err != nil {
+		return err
+	}
+	defer snapshot.Close()
+	if err := copyBuckets(snapshot, m); err != nil {
+		return err
+	}
+	return snapshot.Snapshot(w)
+}
+
+// Space is empty: an in-memory database has no pages
+func (m *memoryBackend) Space() (Space, error) { return Space{}, nil }
+
+func (m *memoryBackend) Close() error { return nil }
+
+type memoryTx struct {
+	buckets  map[string]map[string][]byte
+	writable bool
+}
+
+func (t *memoryTx) Bucket(name []byte) BackendBucket {
+	b, ok := t.buckets[string(name)]
+	if !ok {
+		return nil
+	}
+	return &memoryBucket{tx: t, data: b}
+}
+
+func (t *memoryTx) CreateBucketIfNotExists(name []byte) (BackendBucket, error) {
+	if !t.writable {
+		return nil, errReadOnlyTx
+	}
+	if len(name) == 0 {
+		return nil, fmt.Errorf("bucket name required")
+	}
+	if _, ok := t.buckets[string(name)]; !ok {
+		t.buckets[string(name)] = map[string][]byte{}
+	}
+	return t.Bucket(name), nil
+}
+
+func (t *memoryTx) DeleteBucket(name []byte) error {
+	if !t.writable {
+		return errReadOnlyTx
+	}
+	if _, ok := t.buckets[string(name)]; !ok {
+		return ErrBucketNotFound
+	}
+	delete(t.buckets, string(name))
+	return nil
+}
+
+func (t *memoryTx) ForEach(fn func(name []byte, b BackendBucket) error) error {
+	for _, name := range sortedKeys(t.buckets) {
+		if err := fn([]byte(name), t.Bucket([]byte(name))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type memoryBucket struct {
+	tx   *memoryTx
+	data map[string][]byte
+}
+
+func (b *memoryBucket) Get(key []byte) []byte {
+	return b.data[string(key)]
+}
+
+func (b *memoryBucket) Put(key, value []byte) error {
+	if !b.tx.writable {
+		return errReadOnlyTx
+	}
+	if len(key) == 0 {
+		return fmt.Errorf("key required")
+	}
+	b.data[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (b *memoryBucket) Delete(key []byte) error {
+	if !b.tx.writable {
+		return errReadOnlyTx
+	}
+	delete(b.data, string(key))
+	return nil
+}
+
+func (b *memoryBucket) ForEach(fn func(key, value []byte) error) error {
+	for _, key := range sortedKeys(b.data) {
+		if err := fn([]byte(key), b.data[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *memoryBucket) KeyN() int {
+	return len(b.data)
+}
+
+// sortedKeys returns the keys of m in byte order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,337 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema stores every bucket's records in one table. Keys are BLOBs,
+// which SQLite orders bytewise like bbolt does.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS buckets (
+	name BLOB PRIMARY KEY
+) WITHOUT ROWID;
+CREATE TABLE IF NOT EXISTS records (
+	bucket BLOB NOT NULL,
+	key    BLOB NOT NULL,
+	value  BLOB NOT NULL,
+	PRIMARY KEY (bucket, key)
+) WITHOUT ROWID;
+`
+
+// sqliteBackend stores the database in a SQLite file
+type sqliteBackend struct {
+	db       *sql.DB
+	readOnly bool
+}
+
+func openSQLiteBackend(path string, readOnly bool) (*sqliteBackend, error) {
+	// Wait up to a second for other processes, as bbolt does
+	dsn := path + "?_pragma=busy_timeout(1000)"
+	if readOnly {
+		dsn += "&_pragma=query_only(1)"
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	// One connection keeps transactions serialized within the process
+	db.SetMaxOpenConns(1)
+
+	if !readOnly {
+		if _, err := db.Exec(sqliteSchema); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to open database: %w", err)
+		}
+		os.Chmod(path, 0600)
+	}
+	return &sqliteBackend{db: db, readOnly: readOnly}, nil
+}
+
+func (s *sqliteBackend) Kind() string { return BackendSQLite }
+
+func (s *sqliteBackend) View(fn func(tx BackendTx) error) error {
+	return s.run(false, fn)
+}
+
+func (s *sqliteBackend) Update(fn func(tx BackendTx) error) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	return s.run(true, fn)
+}
+
+// run calls fn in a transaction, committing it only if it is writable and
+// neither fn nor any statement in it failed
+func (s *sqliteBackend) run(writable bool, fn func(tx BackendTx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	t := &sqliteTx{tx: tx, writable: writable}
+	if err := fn(t); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if t.err != nil {
+		tx.Rollback()
+		return t.err
+	}
+	if !writable {
+		return tx.Rollback()
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteBackend) Check() []error {
+	rows, err := s.db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return []error{err}
+	}
+	defer rows.Close()
+
+	var errs []error
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return append(errs, err)
+		}
+		if result != "ok" {
+			errs = append(errs, fmt.Errorf("%s", result))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+func (s *sqliteBackend) Snapshot(w io.Writer) error {
+	dir, err := os.MkdirTemp("", "ark-snapshot")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "ark.db")
+	if _, err := s.db.Exec("VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func (s *sqliteBackend) Space() (Space, error) {
+	var space Space
+	for _, pragma := range []struct {
+		name string
+		dest *int
+	}{
+		{"page_size", &space.PageSize},
+		{"page_count", &space.Pages},
+		{"freelist_count", &space.FreePages},
+	} {
+		if err := s.db.QueryRow("PRAGMA " + pragma.name).Scan(pragma.dest); err != nil {
+			return Space{}, fmt.Errorf("failed to read %s: %w", pragma.name, err)
+		}
+	}
+	return space, nil
+}
+
+// vacuum rebuilds the database file without its free pages. SQLite swaps
+// the rebuilt file in within a transaction.
+func (s *sqliteBackend) vacuum() error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	if _, err := s.db.Exec("VACUUM"); err != nil {
+		return fmt.Errorf("failed to vacuum database: %w", err)
+	}
+	return nil
+}
+
+func (s *sqliteBackend) Close() error {
+	return s.db.Close()
+}
+
+// sqliteTx remembers the first failed statement, since bucket reads cannot
+// return errors, and fails the transaction with it
+type sqliteTx struct {
+	tx       *sql.Tx
+	writable bool
+	err      error
+}
+
+// fail records err unless an earlier error is already recorded
+func (t *sqliteTx) fail(err error) error {
+	if t.err == nil {
+		t.err = err
+	}
+	return err
+}
+
+func (t *sqliteTx) Bucket(name []byte) BackendBucket {
+	var found int
+	err := t.tx.QueryRow("SELECT 1 FROM buckets WHERE name = ?", name).Scan(&found)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		t.fail(err)
+		return nil
+	}
+	return &sqliteBucket{tx: t, name: append([]byte{}, name...)}
+}
+
+func (t *sqliteTx) CreateBucketIfNotExists(name []byte) (BackendBucket, error) {
+	if !t.writable {
+		return nil, errReadOnlyTx
+	}
+	if len(name) == 0 {
+		return nil, fmt.Errorf("bucket name required")
+	}
+	if _, err := t.tx.Exec("INSERT OR IGNORE INTO buckets (name) VALUES (?)", name); err != nil {
+		return nil, t.fail(err)
+	}
+	return &sqliteBucket{tx: t, name: append([]byte{}, name...)}, nil
+}
+
+func (t *sqliteTx) DeleteBucket(name []byte) error {
+	if !t.writable {
+		return errReadOnlyTx
+	}
+	res, err := t.tx.Exec("DELETE FROM buckets WHERE name = ?", name)
+	if err != nil {
+		return t.fail(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrBucketNotFound
+	}
+	if _, err := t.tx.Exec("DELETE FROM records WHERE bucket = ?", name); err != nil {
+		return t.fail(err)
+	}
+	return nil
+}
+
+func (t *sqliteTx) ForEach(fn func(name []byte, b BackendBucket) error) error {
+	rows, err := t.tx.Query("SELECT name FROM buckets ORDER BY name")
+	if err != nil {
+		return t.fail(err)
+	}
+	var names [][]byte
+	for rows.Next() {
+		var name []byte
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return t.fail(err)
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return t.fail(err)
+	}
+
+	for _, name := range names {
+		if err := fn(name, &sqliteBucket{tx: t, name: name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type sqliteBucket struct {
+	tx   *sqliteTx
+	name []byte
+}
+
+func (b *sqliteBucket) Get(key []byte) []byte {
+	var value []byte
+	err := b.tx.tx.QueryRow("SELECT value FROM records WHERE bucket = ? AND key = ?", b.name, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		b.tx.fail(err)
+		return nil
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	return value
+}
+
+func (b *sqliteBucket) Put(key, value []byte) error {
+	if !b.tx.writable {
+		return errReadOnlyTx
+	}
+	if len(key) == 0 {
+		return fmt.Errorf("key required")
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	if _, err := b.tx.tx.Exec("INSERT OR REPLACE INTO records (bucket, key, value) VALUES (?, ?, ?)", b.name, key, value); err != nil {
+		return b.tx.fail(err)
+	}
+	return nil
+}
+
+func (b *sqliteBucket) Delete(key []byte) error {
+	if !b.tx.writable {
+		return errReadOnlyTx
+	}
+	if _, err := b.tx.tx.Exec("DELETE FROM records WHERE bucket = ? AND key = ?", b.name, key); err != nil {
+		return b.tx.fail(err)
+	}
+	return nil
+}
+
+func (b *sqliteBucket) ForEach(fn func(key, value []byte) error) error {
+	rows, err := b.tx.tx.Query("SELECT key, value FROM records WHERE bucket = ? ORDER BY key", b.name)
+	if err != nil {
+		return b.tx.fail(err)
+	}
+	type record struct{ key, value []byte }
+	var records []record
+	for rows.Next() {
+		var r record
+		if err := rows.Scan(&r.key, &r.value); err != nil {
+			rows.Close()
+			return b.tx.fail(err)
+		}
+		if r.value == nil {
+			r.value = []byte{}
+		}
+		records = append(records, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return b.tx.fail(err)
+	}
+
+	for _, r := range records {
+		if err := fn(r.key, r.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *sqliteBucket) KeyN() int {
+	var n int
+	if err := b.tx.tx.QueryRow("SELECT COUNT(*) FROM records WHERE bucket = ?", b.name).Scan(&n); err != nil {
+		b.tx.fail(err)
+	}
+	return n
+}
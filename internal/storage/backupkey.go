@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+)
+
+// backupKeysKey holds the backup keys, sealed with the data key
+const backupKeysKey = "backup_keys"
+
+// backupKeys are the keys backups are encrypted with. They are kept apart
+// from the master key, so backups still open after a password change, a KDF
+// upgrade or a recovery restore.
+type backupKeys struct {
+	// Current encrypts new backups
+	Current []byte `json:"current"`
+	// Retired are earlier backup keys and the master keys that were replaced
+	// since, newest first. Backups made before backup keys existed are
+	// encrypted with one of these master keys.
+	Retired [][]byte `json:"retired,omitempty"`
+}
+
+// all returns every key a backup may be encrypted with, current first
+func (k *backupKeys) all() [][]byte {
+	return append([][]byte{k.Current}, k.Retired...)
+}
+
+// retire adds key to the retired keys unless it is already known
+func (k *backupKeys) retire(key []byte) {
+	for _, known := range k.all() {
+		if hmac.Equal(known, key) {
+			return
+		}
+	}
+	k.Retired = append([][]byte{append([]byte(nil), key...)}, k.Retired...)
+}
+
+// wipe clears the keys from memory
+func (k *backupKeys) wipe() {
+	for _, key := range k.all() {
+		crypto.Wipe(key)
+	}
+}
+
+// readBackupKeys reads the backup keys inside tx, opening them with enc. It
+// returns nil if the database has none yet.
+func readBackupKeys(tx BackendTx, enc *crypto.Encryptor) (*backupKeys, error) {
+	b := tx.Bucket([]byte(metaBucket))
+	if b == nil {
+		return nil, nil
+	}
+	sealed := b.Get([]byte(backupKeysKey))
+	if sealed == nil {
+		return nil, nil
+	}
+	if len(sealed) == 0 || sealed[0] != recordV2 {
+		return nil, fmt.Errorf("%w: backup keys", ErrRecordTampered)
+	}
+	data, err := enc.Open(sealed[1:], recordAAD(recordV2, []byte(metaBucket), []byte(backupKeysKey)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: backup keys", ErrRecordTampered)
+	}
+	defer crypto.Wipe(data)
+
+	var keys backupKeys
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal backup keys: %w", err)
+	}
+	return &keys, nil
+}
+
+// putBackupKeys seals the backup keys with enc and writes them inside tx
+func putBackupKeys(tx BackendTx, enc *crypto.Encryptor, keys *backupKeys) error {
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup keys: %w", err)
+	}
+	defer crypto.Wipe(data)
+	sealed, err := sealRecord(enc, []byte(metaBucket), []byte(backupKeysKey), data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt backup keys: %w", err)
+	}
+	b, err := tx.CreateBucketIfNotExists([]byte(metaBucket))
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(backupKeysKey), sealed)
+}
+
+// loadBackupKeys reads the backup keys
+func (d *Database) loadBackupKeys() (*backupKeys, error) {
+	var keys *backupKeys
+	err := d.db.View(func(tx BackendTx) error {
+		var err error
+		keys, err = readBackupKeys(tx, d.enc)
+		return err
+	})
+	return keys, err
+}
+
+// initBackupKey gives a database without a backup key a random one
+func (d *Database) initBackupKey() error {
+	keys, err := d.loadBackupKeys()
+	if err != nil {
+		return err
+	}
+	if keys != nil {
+		keys.wipe()
+		return nil
+	}
+	if d.opts.ReadOnly {
+		return errNeedsWrite
+	}
+
+	current := make([]byte, crypto.KeySize)
+	if _, err := rand.Read(current); err != nil {
+		return fmt.Errorf("failed to generate backup key: %w", err)
+	}
+	keys = &backupKeys{Current: current}
+	defer keys.wipe()
+	return d.db.Update(func(tx BackendTx) error {
+		return putBackupKeys(tx, d.enc, keys)
+	})
+}
+
+// BackupKey returns the key new backups are encrypted with. It is stored
+// under the data key, so it survives master password changes. The caller
+// should wipe it after use.
+func (d *Database) BackupKey() ([]byte, error) {
+	keys, err := d.loadBackupKeys()
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		return nil, fmt.Errorf("database has no backup key")
+	}
+	for _, key := range keys.Retired {
+		crypto.Wipe(key)
+	}
+	return keys.Current, nil
+}
+
+// BackupKeys returns every key a backup of this database may be encrypted
+// with: the current backup key, then the retired ones. The caller should
+// wipe them after use.
+func (d *Database) BackupKeys() ([][]byte, error) {
+	keys, err := d.loadBackupKeys()
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		return nil, nil
+	}
+	return keys.all(), nil
+}
+
+// RetireKey records a master key that is about to be replaced, so backups
+// encrypted with it, and key slots wrapped under it in restored backups, can
+// still be opened. It must be called while the old key still unlocks the
+// database.
+func (d *Database) RetireKey(masterKey []byte) error {
+	if d.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	return d.db.Update(func(tx BackendTx) error {
+		keys, err := readBackupKeys(tx, d.enc)
+		if err != nil {
+			return err
+		}
+		if keys == nil {
+			return fmt.Errorf("database has no backup key")
+		}
+		defer keys.wipe()
+		keys.retire(masterKey)
+		return putBackupKeys(tx, d.enc, keys)
+	})
+}
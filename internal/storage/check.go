@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// QuarantineBucket holds records moved aside by Quarantine
+const QuarantineBucket = "corrupt"
+
+// Kinds of problem found by Check
+const (
+	// ProblemCorrupt records do not decrypt or were not written where they are
+	ProblemCorrupt = "corrupt"
+	// ProblemInvalid records decrypt but do not unmarshal into their model
+	ProblemInvalid = "invalid"
+	// ProblemOrphaned records are readable but refer to something that is gone
+	ProblemOrphaned = "orphaned"
+	// ProblemStructure is damage to the database file itself
+	ProblemStructure = "structure"
+)
+
+// Problem is something wrong found by Check
+type Problem struct {
+	Kind   string
+	Bucket string
+	// Key is the record's name, or its stored digest in hex when key names
+	// are hidden and the record is too damaged to reveal its name
+	Key    string
+	Detail string
+
+	storedKey []byte
+}
+
+// CheckOptions tells Check what the records of each bucket should hold
+type CheckOptions struct {
+	// Models returns a new value of the type records in a bucket unmarshal
+	// into. Buckets without a model only have to hold valid JSON.
+	Models map[string]func() interface{}
+	// Orphaned returns why a readable record is orphaned, or "" if it is not.
+	// value is the record unmarshalled into its model.
+	Orphaned func(bucket, key string, value interface{}) string
+}
+
+// CheckReport is the result of Check
+type CheckReport struct {
+	Buckets  int
+	Records  int
+	Problems []Problem
+}
+
+// QuarantinedRecord is a record moved into QuarantineBucket. Value is the
+// record exactly as it was stored, so it can be inspected or put back.
+type QuarantinedRecord struct {
+	Bucket        string    `json:"bucket"`
+	Key           string    `json:"key"`
+	StoredKey     []byte    `json:"stored_key"`
+	Kind          string    `json:"kind"`
+	Detail        string    `json:"detail"`
+	Value         []byte    `json:"value"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+}
+
+// checkedRecord is a readable record waiting for the orphan check
+type checkedRecord struct {
+	bucket    string
+	key       string
+	value     interface{}
+	storedKey []byte
+}
+
+// Check runs the backend's consistency check, then verifies that every record
+// decrypts, was written under its bucket and key, and unmarshals into its
+// model, and finally asks opts.Orphaned about every readable record
+func (d *Database) Check(opts CheckOptions) (*CheckReport, error) {
+	report := &CheckReport{}
+	var readable []checkedRecord
+
+	for _, err := range d.db.Check() {
+		report.Problems = append(report.Problems, Problem{Kind: ProblemStructure, Detail: err.Error()})
+	}
+
+	err := d.db.View(func(tx BackendTx) error {
+		return tx.ForEach(func(name []byte, b BackendBucket) error {
+			if isInternalBucket(name) {
+				return nil
+			}
+			report.Buckets++
+			bucket := string(name)
+			return b.ForEach(func(k, v []byte) error {
+				report.Records++
+				storedKey := append([]byte(nil), k...)
+				key, value, problem := d.checkRecord(bucket, storedKey, v, opts.Models[bucket])
+				if problem != nil {
+					report.Problems = append(report.Problems, *problem)
+					return nil
+				}
+				readable = append(readable, checkedRecord{bucket: bucket, key: key, value: value, storedKey: storedKey})
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check database: %w", err)
+	}
+
+	if opts.Orphaned != nil {
+		for _, rec := range readable {
+			if reason := opts.Orphaned(rec.bucket, rec.key, rec.value); reason != "" {
+				report.Problems = append(report.Problems, Problem{
+					Kind:      ProblemOrphaned,
+					Bucket:    rec.bucket,
+					Key:       rec.key,
+					Detail:    reason,
+					storedKey: rec.storedKey,
+				})
+			}
+		}
+	}
+	return report, nil
+}
+
+// checkRecord decrypts and unmarshals one record, returning its name and
+// value, or the problem with it
+func (d *Database) checkRecord(bucket string, storedKey, value []byte, model func() interface{}) (string, interface{}, *Problem) {
+	key := string(storedKey)
+	if d.hiddenKeys {
+		key = hex.EncodeToString(storedKey)
+	}
+	problem := func(kind, format string, args ...interface{}) *Problem {
+		return &Problem{Kind: kind, Bucket: bucket, Key: key, Detail: fmt.Sprintf(format, args...), storedKey: storedKey}
+	}
+
+	plaintext, err := d.openRecord([]byte(bucket), storedKey, value)
+	if err != nil {
+		return key, nil, problem(ProblemCorrupt, "does not decrypt: %v", err)
+	}
+	if d.hiddenKeys {
+		name, data, err := decodeNamed(plaintext)
+		if err != nil {
+			return key, nil, problem(ProblemCorrupt, "does not hold its name: %v", err)
+		}
+		if !bytes.Equal(nameDigest(d.nameKey.Bytes(), bucket, name), storedKey) {
+			return key, nil, problem(ProblemCorrupt, "is named %q but stored under another name", name)
+		}
+		key, plaintext = name, data
+	}
+
+	var dest interface{} = new(json.RawMessage)
+	switch {
+	case model != nil:
+		dest = model()
+	case bucket == QuarantineBucket:
+		dest = new(QuarantinedRecord)
+	}
+	if err := json.Unmarshal(plaintext, dest); err != nil {
+		return key, nil, problem(ProblemInvalid, "does not unmarshal: %v", err)
+	}
+	return key, dest, nil
+}
+
+// Quarantine moves the records named by problems into QuarantineBucket,
+// re-encrypted as QuarantinedRecord values, and returns how many it moved.
+// Structural problems have no record and are skipped.
+func (d *Database) Quarantine(problems []Problem) (int, error) {
+	moved := 0
+	err := d.update(func(tx *Tx) error {
+		if err := tx.CreateBucket(QuarantineBucket); err != nil {
+			return err
+		}
+		for _, p := range problems {
+			if p.storedKey == nil || p.Bucket == QuarantineBucket {
+				continue
+			}
+			b := tx.tx.Bucket([]byte(p.Bucket))
+			if b == nil {
+				continue
+			}
+			value := b.Get(p.storedKey)
+			if value == nil {
+				continue
+			}
+			rec := QuarantinedRecord{
+				Bucket:        p.Bucket,
+				Key:           p.Key,
+				StoredKey:     p.storedKey,
+				Kind:          p.Kind,
+				Detail:        p.Detail,
+				Value:         append([]byte(nil), value...),
+				QuarantinedAt: time.Now(),
+			}
+			if err := tx.Set(QuarantineBucket, p.Bucket+"/"+p.Key, rec); err != nil {
+				return fmt.Errorf("failed to quarantine %s/%s: %w", p.Bucket, p.Key, err)
+			}
+			if err := b.Delete(p.storedKey); err != nil {
+				return fmt.Errorf("failed to remove %s/%s: %w", p.Bucket, p.Key, err)
+			}
+			moved++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return moved, nil
+}
@@ -0,0 +1,496 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// indexBucket holds the secondary indexes of collections. Each index is one
+// encrypted record, so index values are no more visible than the records.
+const indexBucket = "indexes"
+
+// Index is a secondary index of a Collection. Values returns the values a
+// record is found under in the index; a record without any is left out.
+type Index[T any] struct {
+	Name   string
+	Values func(value *T) []string
+}
+
+// Collection is a bucket of records of type T with secondary indexes. Writes
+// through the collection update its indexes in the same transaction as the
+// records. Indexes are rebuilt when they are missing, or when records were
+// added or removed without going through the collection.
+type Collection[T any] struct {
+	db      Store
+	bucket  string
+	indexes []Index[T]
+}
+
+// NewCollection returns the collection of the records in bucket
+func NewCollection[T any](db Store, bucket string, indexes ...Index[T]) *Collection[T] {
+	return &Collection[T]{db: db, bucket: bucket, indexes: indexes}
+}
+
+// Item is a record of a Collection and its key
+type Item[T any] struct {
+	Key   string
+	Value *T
+}
+
+// Query selects the records Scan returns
+type Query struct {
+	// Index is the index to scan, or "" to scan records by key
+	Index string
+	// Value, Prefix, Start and End restrict the index values, or keys, that
+	// are scanned: equal to Value, starting with Prefix, and within
+	// [Start, End). Empty fields do not restrict.
+	Value  string
+	Prefix string
+	Start  string
+	End    string
+	// After continues a scan from the Next of a previous page
+	After string
+	// Limit is the most items a page holds, or 0 for no limit
+	Limit int
+}
+
+// Page is one page of the records a Query selects
+type Page[T any] struct {
+	Items []Item[T]
+	// Next is the Query.After of the following page, or "" if this is the
+	// last page
+	Next string
+}
+
+// storedIndex is an index as stored in indexBucket. Sum is the keySum of the
+// bucket when the index was last updated, which shows whether records were
+// added or removed around the collection since.
+type storedIndex struct {
+	Sum     []byte       `json:"sum"`
+	Entries []indexEntry `json:"entries"`
+}
+
+// indexEntry finds the record Key under Value. Entries are sorted by value,
+// then key.
+type indexEntry struct {
+	Value string `json:"v"`
+	Key   string `json:"k"`
+}
+
+func (e indexEntry) less(o indexEntry) bool {
+	if e.Value != o.Value {
+		return e.Value < o.Value
+	}
+	return e.Key < o.Key
+}
+
+// cursor encodes the entry as a Query.After
+func (e indexEntry) cursor() string {
+	return e.Value + "\x00" + e.Key
+}
+
+// matches reports whether the entry is selected by q
+func (e indexEntry) matches(q Query) bool {
+	switch {
+	case q.Value != "" && e.Value != q.Value:
+		return false
+	case q.Prefix != "" && !strings.HasPrefix(e.Value, q.Prefix):
+		return false
+	case q.Start != "" && e.Value < q.Start:
+		return false
+	case q.End != "" && e.Value >= q.End:
+		return false
+	}
+	return true
+}
+
+// past reports whether the entry, and so every later one, sorts after the
+// values q selects
+func (e indexEntry) past(q Query) bool {
+	switch {
+	case q.Value != "" && e.Value > q.Value:
+		return true
+	case q.Prefix != "" && e.Value > q.Prefix && !strings.HasPrefix(e.Value, q.Prefix):
+		return true
+	case q.End != "" && e.Value >= q.End:
+		return true
+	}
+	return false
+}
+
+// CollectionTx is a Collection within a transaction
+type CollectionTx[T any] struct {
+	c  *Collection[T]
+	tx *Tx
+	// loaded caches the indexes read in this transaction
+	loaded map[string]*storedIndex
+}
+
+// In returns the collection within tx, so its operations join the caller's
+// transaction
+func (c *Collection[T]) In(tx *Tx) *CollectionTx[T] {
+	return &CollectionTx[T]{c: c, tx: tx, loaded: map[string]*storedIndex{}}
+}
+
+// Get returns the record stored under key
+func (c *Collection[T]) Get(key string) (*T, error) {
+	var value *T
+	err := c.db.View(func(tx *Tx) error {
+		var err error
+		value, err = c.In(tx).Get(key)
+		return err
+	})
+	return value, err
+}
+
+// Put stores value under key
+func (c *Collection[T]) Put(key string, value *T) error {
+	return c.db.Update(func(tx *Tx) error {
+		return c.In(tx).Put(key, value)
+	})
+}
+
+// Delete removes the record stored under key
+func (c *Collection[T]) Delete(key string) error {
+	return c.db.Update(func(tx *Tx) error {
+		return c.In(tx).Delete(key)
+	})
+}
+
+// List returns every readable record, in stored key order
+func (c *Collection[T]) List() ([]*T, error) {
+	var values []*T
+	err := c.db.View(func(tx *Tx) error {
+		values = nil
+		return c.In(tx).ForEach(func(_ string, value *T, err error) error {
+			if err == nil {
+				values = append(values, value)
+			}
+			return nil
+		})
+	})
+	return values, err
+}
+
+// Scan returns a page of the records q selects
+func (c *Collection[T]) Scan(q Query) (*Page[T], error) {
+	var page *Page[T]
+	err := c.db.View(func(tx *Tx) error {
+		var err error
+		page, err = c.In(tx).Scan(q)
+		return err
+	})
+	return page, err
+}
+
+// Get returns the record stored under key
+func (ct *CollectionTx[T]) Get(key string) (*T, error) {
+	value := new(T)
+	if err := ct.tx.Get(ct.c.bucket, key, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Writable reports whether the transaction can write records
+func (ct *CollectionTx[T]) Writable() bool {
+	return ct.tx.Writable()
+}
+
+// Exists reports whether a record is stored under key
+func (ct *CollectionTx[T]) Exists(key string) (bool, error) {
+	return ct.tx.Exists(ct.c.bucket, key)
+}
+
+// Put stores value under key and updates the indexes
+func (ct *CollectionTx[T]) Put(key string, value *T) error {
+	// Load the indexes first, so they are not seen as stale once the record
+	// count has changed
+	if err := ct.loadAll(); err != nil {
+		return err
+	}
+	exists, err := ct.Exists(key)
+	if err != nil {
+		return err
+	}
+	if err := ct.tx.Set(ct.c.bucket, key, value); err != nil {
+		return err
+	}
+
+	for _, index := range ct.c.indexes {
+		if err := ct.reindex(index.Name, key, index.Values(value), !exists); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes the record stored under key from the bucket and the indexes
+func (ct *CollectionTx[T]) Delete(key string) error {
+	if err := ct.loadAll(); err != nil {
+		return err
+	}
+	exists, err := ct.Exists(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+	if err := ct.tx.Delete(ct.c.bucket, key); err != nil {
+		return err
+	}
+	for _, index := range ct.c.indexes {
+		if err := ct.reindex(index.Name, key, nil, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Clear removes every record and empties the indexes
+func (ct *CollectionTx[T]) Clear() error {
+	if err := ct.tx.clear(ct.c.bucket); err != nil {
+		return err
+	}
+	for _, index := range ct.c.indexes {
+		if err := ct.save(index.Name, &storedIndex{Sum: make([]byte, sha256.Size)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEach calls fn for every record in stored key order. err is set instead
+// of value for a record that cannot be read, so fn can skip it. fn may write
+// to the collection.
+func (ct *CollectionTx[T]) ForEach(fn func(key string, value *T, err error) error) error {
+	return ct.tx.ForEach(ct.c.bucket, func(key string, decode func(interface{}) error) error {
+		value := new(T)
+		if err := decode(value); err != nil {
+			return fn(key, nil, err)
+		}
+		return fn(key, value, nil)
+	})
+}
+
+// Scan returns a page of the records q selects, in index value order and
+// then key order. A record is returned once for every matching value it is
+// indexed under. Index entries whose record cannot be read are skipped.
+func (ct *CollectionTx[T]) Scan(q Query) (*Page[T], error) {
+	var entries []indexEntry
+	if q.Index == "" {
+		err := ct.tx.ForEach(ct.c.bucket, func(key string, _ func(interface{}) error) error {
+			entries = append(entries, indexEntry{Value: key, Key: key})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(entries, func(a, b int) bool { return entries[a].less(entries[b]) })
+	} else {
+		if ct.c.index(q.Index) == nil {
+			return nil, fmt.Errorf("collection %s has no index %s", ct.c.bucket, q.Index)
+		}
+		index, err := ct.load(q.Index)
+		if err != nil {
+			return nil, err
+		}
+		entries = index.Entries
+	}
+
+	// Entries are sorted, so the scan can start at the first one selected
+	// and stop at the first one past the selection
+	start := sort.Search(len(entries), func(i int) bool {
+		e := entries[i]
+		if q.After != "" && e.cursor() <= q.After {
+			return false
+		}
+		return e.Value >= max(q.Value, q.Prefix, q.Start)
+	})
+
+	page := &Page[T]{}
+	for i := start; i < len(entries); i++ {
+		e := entries[i]
+		if e.past(q) {
+			break
+		}
+		if !e.matches(q) {
+			continue
+		}
+		if q.Limit > 0 && len(page.Items) == q.Limit {
+			page.Next = entries[i-1].cursor()
+			break
+		}
+		value, err := ct.Get(e.Key)
+		if err != nil {
+			continue
+		}
+		page.Items = append(page.Items, Item[T]{Key: e.Key, Value: value})
+	}
+	return page, nil
+}
+
+// index returns the definition of the named index, or nil
+func (c *Collection[T]) index(name string) *Index[T] {
+	for i := range c.indexes {
+		if c.indexes[i].Name == name {
+			return &c.indexes[i]
+		}
+	}
+	return nil
+}
+
+// indexKey is where the named index is stored in indexBucket
+func (c *Collection[T]) indexKey(name string) string {
+	return c.bucket + "/" + name
+}
+
+// loadAll loads every index of the collection
+func (ct *CollectionTx[T]) loadAll() error {
+	for _, index := range ct.c.indexes {
+		if _, err := ct.load(index.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load returns the named index, rebuilding it if it is missing or stale
+func (ct *CollectionTx[T]) load(name string) (*storedIndex, error) {
+	if index, ok := ct.loaded[name]; ok {
+		return index, nil
+	}
+
+	b, err := ct.tx.bucket(ct.c.bucket)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := keySum(b)
+	if err != nil {
+		return nil, err
+	}
+	var index storedIndex
+	if err := ct.tx.Get(indexBucket, ct.c.indexKey(name), &index); err != nil || !bytes.Equal(index.Sum, sum) {
+		rebuilt, err := ct.rebuild(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to rebuild index %s: %w", name, err)
+		}
+		index = *rebuilt
+		index.Sum = sum
+		if ct.tx.Writable() {
+			if err := ct.save(name, &index); err != nil {
+				return nil, err
+			}
+		}
+	}
+	ct.loaded[name] = &index
+	return &index, nil
+}
+
+// rebuild indexes every readable record of the collection
+func (ct *CollectionTx[T]) rebuild(name string) (*storedIndex, error) {
+	values := ct.c.index(name).Values
+	index := &storedIndex{}
+	err := ct.ForEach(func(key string, value *T, err error) error {
+		if err == nil {
+			index.Entries = append(index.Entries, entriesFor(key, values(value))...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(index.Entries, func(a, b int) bool { return index.Entries[a].less(index.Entries[b]) })
+	return index, nil
+}
+
+// reindex replaces the entries of key in the named index with values. added
+// is set when key was added to or removed from the bucket.
+func (ct *CollectionTx[T]) reindex(name, key string, values []string, added bool) error {
+	index, err := ct.load(name)
+	if err != nil {
+		return err
+	}
+
+	var old, kept []indexEntry
+	for _, e := range index.Entries {
+		if e.Key == key {
+			old = append(old, e)
+		} else {
+			kept = append(kept, e)
+		}
+	}
+	updated := entriesFor(key, values)
+	sort.Slice(updated, func(a, b int) bool { return updated[a].less(updated[b]) })
+	if !added && equalEntries(old, updated) {
+		return nil
+	}
+
+	entries := append(kept, updated...)
+	sort.Slice(entries, func(a, b int) bool { return entries[a].less(entries[b]) })
+	index.Entries = entries
+	if added {
+		toggleKey(index.Sum, ct.tx.d.storageKey(ct.c.bucket, key))
+	}
+	return ct.save(name, index)
+}
+
+// keySum returns the XOR of the SHA-256 digests of the stored keys in b. It
+// does not depend on the order keys were added in, and removing a key undoes
+// adding it, so it can be kept up to date with toggleKey.
+func keySum(b BackendBucket) ([]byte, error) {
+	sum := make([]byte, sha256.Size)
+	err := b.ForEach(func(key, _ []byte) error {
+		toggleKey(sum, key)
+		return nil
+	})
+	return sum, err
+}
+
+// toggleKey adds storedKey to, or removes it from, a keySum
+func toggleKey(sum, storedKey []byte) {
+	digest := sha256.Sum256(storedKey)
+	for i := range sum {
+		sum[i] ^= digest[i]
+	}
+}
+
+// save stores the named index
+func (ct *CollectionTx[T]) save(name string, index *storedIndex) error {
+	if err := ct.tx.Set(indexBucket, ct.c.indexKey(name), index); err != nil {
+		return fmt.Errorf("failed to save index %s: %w", name, err)
+	}
+	ct.loaded[name] = index
+	return nil
+}
+
+// entriesFor returns the index entries of key under values, without
+// duplicates or empty values
+func entriesFor(key string, values []string) []indexEntry {
+	var entries []indexEntry
+	seen := map[string]bool{}
+	for _, v := range values {
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		entries = append(entries, indexEntry{Value: v, Key: key})
+	}
+	return entries
+}
+
+func equalEntries(a, b []indexEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
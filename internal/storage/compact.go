@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+)
+
+// Stats describes what a database holds and how much of its file is free
+type Stats struct {
+	Backend string
+	// FileSize is the size of the database file, 0 for an in-memory database
+	FileSize int64
+	Buckets  []BucketStats
+	Space
+}
+
+// BucketStats describes the records stored in one bucket
+type BucketStats struct {
+	Name string
+	Keys int
+	// Bytes is the stored size of the keys and values, which includes the
+	// encryption overhead of each record
+	Bytes int64
+}
+
+// Fragmentation returns the share of the file's pages that are free
+func (s *Stats) Fragmentation() float64 {
+	if s.Pages == 0 {
+		return 0
+	}
+	return float64(s.FreePages) / float64(s.Pages)
+}
+
+// Stats returns per-bucket record counts and sizes, and how much of the
+// database file deletions have left free
+func (d *Database) Stats() (*Stats, error) {
+	stats := &Stats{Backend: d.db.Kind()}
+	if !d.inMemory() {
+		info, err := os.Stat(d.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat database: %w", err)
+		}
+		stats.FileSize = info.Size()
+	}
+
+	err := d.db.View(func(tx BackendTx) error {
+		return tx.ForEach(func(name []byte, b BackendBucket) error {
+			bucket := BucketStats{Name: string(name)}
+			err := b.ForEach(func(key, value []byte) error {
+				bucket.Keys++
+				bucket.Bytes += int64(len(key) + len(value))
+				return nil
+			})
+			stats.Buckets = append(stats.Buckets, bucket)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read buckets: %w", err)
+	}
+
+	space, err := d.db.Space()
+	if err != nil {
+		return nil, err
+	}
+	stats.Space = space
+	return stats, nil
+}
+
+// Compact rewrites the database file without its free pages, so it shrinks
+// after deletions. A bbolt file is compacted into a new file which then
+// atomically replaces it; SQLite does the same itself with VACUUM. There is
+// nothing to compact in an in-memory database.
+func (d *Database) Compact() error {
+	if d.opts.ReadOnly {
+		return ErrReadOnly
+	}
+
+	switch b := d.db.(type) {
+	case *sqliteBackend:
+		return b.vacuum()
+	case *boltBackend:
+		tmpPath := d.path + ".compact"
+		dst, err := d.createReplacement(tmpPath, BackendBolt)
+		if err != nil {
+			return err
+		}
+		if err := b.compactInto(dst.(*boltBackend)); err != nil {
+			dst.Close()
+			os.Remove(tmpPath)
+			return fmt.Errorf("failed to compact database: %w", err)
+		}
+		return d.replaceBackend(dst, tmpPath, "")
+	default:
+		return nil
+	}
+}
+
+// compactIfFragmented compacts the database if records were deleted since it
+// was opened and Options.AutoCompact of its pages are now free. Failures are
+// ignored: the database is intact either way.
+func (d *Database) compactIfFragmented() {
+	if d.opts.AutoCompact <= 0 || d.opts.ReadOnly || !d.deleted.Load() {
+		return
+	}
+	stats, err := d.Stats()
+	if err != nil || stats.Fragmentation() < d.opts.AutoCompact {
+		return
+	}
+	d.Compact()
+}
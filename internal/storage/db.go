@@ -2,43 +2,123 @@ package storage
 
 import (
 	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
-	"go.etcd.io/bbolt"
 )
 
-// Database represents an encrypted BoltDB database
+// Store is what features need from a database: encrypted records addressed
+// by bucket and key, and transactions over them
+type Store interface {
+	Set(bucket, key string, value interface{}) error
+	Get(bucket, key string, dest interface{}) error
+	Delete(bucket, key string) error
+	List(bucket string) ([]string, error)
+	Search(bucket, pattern string) ([]string, error)
+	Exists(bucket, key string) (bool, error)
+	Update(fn func(tx *Tx) error) error
+	View(fn func(tx *Tx) error) error
+	ReadOnly() bool
+}
+
+var _ Store = (*Database)(nil)
+
+// Database represents an encrypted database on one of the storage backends.
+// Records are encrypted with a random data key, which is stored wrapped in
+// one or more key slots.
 type Database struct {
-	db   *bbolt.DB
-	enc  *crypto.Encryptor
-	path string
+	db     Backend
+	enc    *crypto.Encryptor
+	dek    *crypto.Secret
+	slotID string
+	path   string
+	// recordFormat is the envelope format of the stored records, and cipher
+	// the suite new records are sealed with
+	recordFormat byte
+	cipher       byte
+	// hiddenKeys stores key names as HMAC digests under nameKey
+	hiddenKeys bool
+	nameKey    *crypto.Secret
+	// opts are the options the database was opened with
+	opts Options
+	// deleted is set once records are deleted, for Options.AutoCompact
+	deleted atomic.Bool
+	// closed is set by Close, so closing again is a no-op
+	closed bool
+}
+
+// Options adjust how a database is opened
+type Options struct {
+	// SkipMigrations opens an older database without migrating it, for
+	// inspecting its schema version
+	SkipMigrations bool
+	// Backend is the backend a new database is created with. Existing
+	// databases are opened with the backend that wrote them.
+	Backend string
+	// ReadOnly opens the database without taking the write lock, so other
+	// readers can open it at the same time. A database that has to be
+	// created, upgraded or migrated first is opened for writing instead.
+	ReadOnly bool
+	// LockTimeout is how long to wait for another process to release the
+	// database. Zero means DefaultLockTimeout.
+	LockTimeout time.Duration
+	// Waiting, if not nil, is called once when the database is held by
+	// another process, before waiting for it
+	Waiting func(owner *LockOwner)
+	// AutoCompact compacts the database when it is closed after deleting
+	// records if at least this share of its pages is free. Zero disables it.
+	AutoCompact float64
+	// dataKey opens the database with its data key rather than a key that
+	// unlocks one of its slots, for restoring backups
+	dataKey bool
 }
 
-// NewDatabase creates a new encrypted database
+// errNeedsWrite stops a read-only open of a database that has to be written
+// to first
+var errNeedsWrite = errors.New("database has to be written before it can be opened read-only")
+
+// NewDatabase opens or creates an encrypted database, unlocking it with
+// masterKey. It returns ErrInvalidKey if masterKey opens none of its key slots.
+// Older databases are migrated to the latest schema.
 func NewDatabase(path string, masterKey []byte) (*Database, error) {
-	// Open BoltDB
-	db, err := bbolt.Open(path, 0600, &bbolt.Options{
-		Timeout: 1 * time.Second,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+	return Open(path, masterKey, Options{})
+}
+
+// NewMemoryDatabase creates an empty encrypted database that lives only in
+// memory, for tests
+func NewMemoryDatabase(masterKey []byte) (*Database, error) {
+	return Open("", masterKey, Options{Backend: BackendMemory})
+}
+
+// Open is NewDatabase with options
+func Open(path string, masterKey []byte, opts Options) (*Database, error) {
+	database, err := open(path, masterKey, opts)
+	if opts.ReadOnly && errors.Is(err, errNeedsWrite) {
+		opts.ReadOnly = false
+		return open(path, masterKey, opts)
+	}
+	return database, err
+}
+
+func open(path string, masterKey []byte, opts Options) (*Database, error) {
+	if len(masterKey) != crypto.KeySize {
+		return nil, fmt.Errorf("invalid key size: expected %d bytes, got %d", crypto.KeySize, len(masterKey))
 	}
 
-	// Create encryptor
-	enc, err := crypto.NewEncryptor(masterKey)
+	db, err := openBackend(path, opts)
 	if err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to create encryptor: %w", err)
+		return nil, err
 	}
 
 	database := &Database{
 		db:   db,
-		enc:  enc,
 		path: path,
+		opts: opts,
 	}
 
 	// Initialize buckets
@@ -46,22 +126,66 @@ func NewDatabase(path string, masterKey []byte) (*Database, error) {
 		db.Close()
 		return nil, fmt.Errorf("failed to initialize buckets: %w", err)
 	}
+	if err := database.loadMeta(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// Recover the data key from the key slots
+	unlock := database.unlock
+	if opts.dataKey {
+		unlock = database.unlockWithDataKey
+	}
+	if err := unlock(masterKey); err != nil {
+		database.db.Close()
+		return nil, err
+	}
+
+	// Bind records written by older versions to their bucket and key
+	if err := database.migrateRecords(); err != nil {
+		database.db.Close()
+		return nil, err
+	}
+	if err := database.initBackupKey(); err != nil {
+		database.db.Close()
+		return nil, err
+	}
+
+	if err := database.checkSchema(opts); err != nil {
+		database.Close()
+		return nil, err
+	}
 
 	return database, nil
 }
 
-// initBuckets initializes the database buckets
+// initBuckets initializes the database buckets. A read-only database must
+// already have them.
 func (d *Database) initBuckets() error {
-	return d.db.Update(func(tx *bbolt.Tx) error {
-		buckets := []string{
-			"vault",
-			"aws_profiles",
-			"ec2_instances",
-			"locked_dirs",
-			"backup_metadata",
-			"config",
-		}
+	buckets := []string{
+		"vault",
+		"aws_profiles",
+		"ec2_instances",
+		"locked_dirs",
+		"backup_metadata",
+		"config",
+		indexBucket,
+		keySlotBucket,
+		metaBucket,
+	}
+
+	if d.opts.ReadOnly {
+		return d.db.View(func(tx BackendTx) error {
+			for _, bucket := range buckets {
+				if tx.Bucket([]byte(bucket)) == nil {
+					return errNeedsWrite
+				}
+			}
+			return nil
+		})
+	}
 
+	return d.db.Update(func(tx BackendTx) error {
 		for _, bucket := range buckets {
 			if _, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
 				return fmt.Errorf("failed to create bucket %s: %w", bucket, err)
@@ -74,181 +198,318 @@ func (d *Database) initBuckets() error {
 
 // Set stores an encrypted value in the specified bucket
 func (d *Database) Set(bucket, key string, value interface{}) error {
-	// Serialize value to JSON
-	data, err := json.Marshal(value)
-	if err != nil {
-		return fmt.Errorf("failed to marshal value: %w", err)
-	}
-
-	// Encrypt data
-	encryptedData, err := d.enc.Encrypt(data)
-	if err != nil {
-		return fmt.Errorf("failed to encrypt data: %w", err)
-	}
-
-	return d.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(bucket))
-		if b == nil {
-			return fmt.Errorf("bucket %s not found", bucket)
-		}
-
-		return b.Put([]byte(key), encryptedData)
+	return d.update(func(tx *Tx) error {
+		return tx.Set(bucket, key, value)
 	})
 }
 
-// Get retrieves and decrypts a value from the specified bucket
+// Get retrieves and decrypts a value from the specified bucket. It returns
+// ErrRecordTampered if the record was not written under this bucket and key.
 func (d *Database) Get(bucket, key string, dest interface{}) error {
-	var encryptedData []byte
-
-	err := d.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(bucket))
-		if b == nil {
-			return fmt.Errorf("bucket %s not found", bucket)
-		}
-
-		data := b.Get([]byte(key))
-		if data == nil {
-			return fmt.Errorf("key %s not found in bucket %s", key, bucket)
-		}
-
-		encryptedData = make([]byte, len(data))
-		copy(encryptedData, data)
-		return nil
+	return d.view(func(tx *Tx) error {
+		return tx.Get(bucket, key, dest)
 	})
-
-	if err != nil {
-		return err
-	}
-
-	// Decrypt data
-	decryptedData, err := d.enc.Decrypt(encryptedData)
-	if err != nil {
-		return fmt.Errorf("failed to decrypt data: %w", err)
-	}
-
-	// Unmarshal to destination
-	if err := json.Unmarshal(decryptedData, dest); err != nil {
-		return fmt.Errorf("failed to unmarshal data: %w", err)
-	}
-
-	return nil
 }
 
 // Delete removes a key from the specified bucket
 func (d *Database) Delete(bucket, key string) error {
-	return d.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(bucket))
-		if b == nil {
-			return fmt.Errorf("bucket %s not found", bucket)
-		}
-
-		return b.Delete([]byte(key))
+	return d.update(func(tx *Tx) error {
+		return tx.Delete(bucket, key)
 	})
 }
 
 // List returns all keys in the specified bucket
 func (d *Database) List(bucket string) ([]string, error) {
 	var keys []string
-
-	err := d.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(bucket))
-		if b == nil {
-			return fmt.Errorf("bucket %s not found", bucket)
-		}
-
-		return b.ForEach(func(key, _ []byte) error {
-			keys = append(keys, string(key))
-			return nil
-		})
+	err := d.view(func(tx *Tx) error {
+		var err error
+		keys, err = tx.List(bucket)
+		return err
 	})
-
 	return keys, err
 }
 
 // Search searches for keys matching a pattern in the specified bucket
 func (d *Database) Search(bucket, pattern string) ([]string, error) {
-	var keys []string
+	all, err := d.List(bucket)
+	if err != nil {
+		return nil, err
+	}
 
-	err := d.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(bucket))
-		if b == nil {
-			return fmt.Errorf("bucket %s not found", bucket)
+	var keys []string
+	for _, key := range all {
+		if contains(key, pattern) {
+			keys = append(keys, key)
 		}
-
-		return b.ForEach(func(key, _ []byte) error {
-			keyStr := string(key)
-			if contains(keyStr, pattern) {
-				keys = append(keys, keyStr)
-			}
-			return nil
-		})
-	})
-
-	return keys, err
+	}
+	return keys, nil
 }
 
 // Exists checks if a key exists in the specified bucket
 func (d *Database) Exists(bucket, key string) (bool, error) {
 	var exists bool
+	err := d.view(func(tx *Tx) error {
+		var err error
+		exists, err = tx.Exists(bucket, key)
+		return err
+	})
+	return exists, err
+}
 
-	err := d.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(bucket))
-		if b == nil {
-			return fmt.Errorf("bucket %s not found", bucket)
-		}
+// Update runs fn in a read-write transaction, so several reads and writes
+// apply together. If fn returns an error, none of its changes are kept.
+func (d *Database) Update(fn func(tx *Tx) error) error {
+	return d.update(fn)
+}
 
-		data := b.Get([]byte(key))
-		exists = data != nil
-		return nil
+// View runs fn in a read-only transaction, which sees a consistent snapshot
+// of the database
+func (d *Database) View(fn func(tx *Tx) error) error {
+	return d.view(fn)
+}
+
+// update runs fn in a read-write transaction
+func (d *Database) update(fn func(tx *Tx) error) error {
+	return d.db.Update(func(tx BackendTx) error {
+		return fn(&Tx{d: d, tx: tx, writable: true})
+	})
+}
+
+// view runs fn in a read-only transaction
+func (d *Database) view(fn func(tx *Tx) error) error {
+	return d.db.View(func(tx BackendTx) error {
+		return fn(&Tx{d: d, tx: tx})
 	})
+}
 
-	return exists, err
+// Path returns the database file path
+func (d *Database) Path() string {
+	return d.path
+}
+
+// ReadOnly reports whether the database was opened read-only
+func (d *Database) ReadOnly() bool {
+	return d.opts.ReadOnly
+}
+
+// Backend returns the name of the backend the database is stored in
+func (d *Database) Backend() string {
+	return d.db.Kind()
+}
+
+// inMemory reports whether the database has no file
+func (d *Database) inMemory() bool {
+	return d.db.Kind() == BackendMemory
 }
 
-// Close closes the database
+// Close closes the database and wipes its keys from memory. Closing it again
+// does nothing.
 func (d *Database) Close() error {
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+	d.compactIfFragmented()
+	d.wipeKeys()
 	return d.db.Close()
 }
 
 // Backup creates a backup of the database
 func (d *Database) Backup() ([]byte, error) {
 	var backup bytes.Buffer
+	err := d.WriteBackup(&backup)
+	return backup.Bytes(), err
+}
 
-	err := d.db.View(func(tx *bbolt.Tx) error {
-		_, err := tx.WriteTo(&backup)
-		return err
-	})
+// WriteBackup streams a consistent copy of the database file to w. An
+// in-memory database is written as a bbolt file.
+func (d *Database) WriteBackup(w io.Writer) error {
+	return d.db.Snapshot(w)
+}
 
-	return backup.Bytes(), err
+// Restore restores the database from backup data, see RestoreFrom
+func (d *Database) Restore(data []byte, masterKey []byte) error {
+	return d.RestoreFrom(bytes.NewReader(data), masterKey)
 }
 
-// Restore restores the database from backup data
-func (d *Database) Restore(data []byte) error {
-	// Close current database
-	if err := d.db.Close(); err != nil {
-		return fmt.Errorf("failed to close database: %w", err)
+// RestoreFrom replaces the database with a backup read from r. The backup is
+// written to a temporary file and unlocked the way Open unlocks a database,
+// upgrading it if it predates key slots, before it replaces anything; a
+// backup that cannot be read or unlocked leaves the database untouched.
+//
+// A backup whose key slots were wrapped under an earlier master key is
+// unlocked with the keys retired since, or with this database's data key,
+// and its password slot is re-wrapped under masterKey. The database keeps
+// its backup key, so backups made before and after the restore still open.
+// It takes on the backend the backup was written by, except that an
+// in-memory database stays in memory.
+func (d *Database) RestoreFrom(r io.Reader, masterKey []byte) error {
+	if d.opts.ReadOnly {
+		return ErrReadOnly
 	}
-
-	// Write backup data to file
-	if err := os.WriteFile(d.path, data, 0600); err != nil {
+	var tmp *os.File
+	var err error
+	if d.inMemory() {
+		tmp, err = os.CreateTemp("", "ark-restore-*.db")
+	} else {
+		tmp, err = os.OpenFile(d.path+".restore", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create restore file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write backup data: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
 		return fmt.Errorf("failed to write backup data: %w", err)
 	}
 
-	// Reopen database
-	db, err := bbolt.Open(d.path, 0600, &bbolt.Options{
-		Timeout: 1 * time.Second,
-	})
+	live, err := d.loadBackupKeys()
+	if err != nil {
+		return err
+	}
+	if live != nil {
+		defer live.wipe()
+	}
+	restored, err := d.openRestored(tmpPath, masterKey, live)
 	if err != nil {
-		return fmt.Errorf("failed to open database for restore: %w", err)
+		return fmt.Errorf("failed to open backup: %w", err)
 	}
+	if err := restored.adoptKeys(masterKey, live); err != nil {
+		restored.Close()
+		return err
+	}
+	if err := d.replaceWithRestored(restored, tmpPath); err != nil {
+		restored.wipeKeys()
+		return err
+	}
+	return d.checkSchema(Options{})
+}
+
+// openRestored opens the backup at path with masterKey, then with each key
+// retired from this database, and finally with this database's data key.
+// Migrations are left until the backup is in place, so their backup copy
+// ends up next to the database rather than the temporary file.
+func (d *Database) openRestored(path string, masterKey []byte, live *backupKeys) (*Database, error) {
+	opts := Options{SkipMigrations: true, LockTimeout: d.opts.LockTimeout}
+	keks := [][]byte{masterKey}
+	if live != nil {
+		keks = append(keks, live.Retired...)
+	}
+	for _, kek := range keks {
+		restored, err := open(path, kek, opts)
+		if !errors.Is(err, ErrInvalidKey) {
+			return restored, err
+		}
+	}
+
+	opts.dataKey = true
+	return open(path, d.dek.Bytes(), opts)
+}
+
+// adoptKeys makes a restored backup open with masterKey, and gives it the
+// backup key of the database it replaces while remembering its own
+func (d *Database) adoptKeys(masterKey []byte, live *backupKeys) error {
+	if err := d.SetPasswordSlot(masterKey); err != nil {
+		return fmt.Errorf("failed to update password key slot: %w", err)
+	}
+	if live == nil {
+		return nil
+	}
+	return d.db.Update(func(tx BackendTx) error {
+		own, err := readBackupKeys(tx, d.enc)
+		if err != nil {
+			return err
+		}
+		merged := &backupKeys{Current: live.Current, Retired: live.Retired}
+		defer merged.wipe()
+		if own != nil {
+			defer own.wipe()
+			for _, key := range own.all() {
+				merged.retire(key)
+			}
+		}
+		return putBackupKeys(tx, d.enc, merged)
+	})
+}
 
-	d.db = db
+// replaceWithRestored swaps the backup opened as restored from tmpPath in for
+// the database, taking over its keys
+func (d *Database) replaceWithRestored(restored *Database, tmpPath string) error {
+	if d.inMemory() {
+		db := newMemoryBackend()
+		err := copyBuckets(db, restored.db)
+		restored.db.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+		d.db.Close()
+		d.db = db
+	} else {
+		if err := restored.db.Close(); err != nil {
+			return fmt.Errorf("failed to close backup: %w", err)
+		}
+		if err := d.db.Close(); err != nil {
+			return fmt.Errorf("failed to close database: %w", err)
+		}
+		if err := os.Rename(tmpPath, d.path); err != nil {
+			if reopenErr := d.reopen(); reopenErr != nil {
+				return fmt.Errorf("failed to replace database: %w (reopen failed: %v)", err, reopenErr)
+			}
+			return fmt.Errorf("failed to replace database: %w", err)
+		}
+		if err := d.reopen(); err != nil {
+			return fmt.Errorf("failed to open database for restore: %w", err)
+		}
+	}
+
+	d.wipeKeys()
+	d.enc, d.dek, d.nameKey = restored.enc, restored.dek, restored.nameKey
+	d.slotID = restored.slotID
+	d.recordFormat = restored.recordFormat
+	d.cipher = restored.cipher
+	d.hiddenKeys = restored.hiddenKeys
 	return nil
 }
 
-// Stats returns database statistics
-func (d *Database) Stats() bbolt.Stats {
-	return d.db.Stats()
+// Convert moves the database to another backend. The records are copied as
+// they are stored, so nothing is re-encrypted. The previous file is kept at
+// ConvertBackupPath.
+func (d *Database) Convert(kind string) error {
+	if !ValidBackend(kind) {
+		return fmt.Errorf("unknown storage backend %q", kind)
+	}
+	if d.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	if d.inMemory() {
+		return fmt.Errorf("an in-memory database cannot be converted")
+	}
+	from := d.db.Kind()
+	if kind == from {
+		return fmt.Errorf("database is already stored in %s", kind)
+	}
+
+	tmpPath := d.path + ".convert"
+	dst, err := d.createReplacement(tmpPath, kind)
+	if err != nil {
+		return err
+	}
+	if err := copyBuckets(dst, d.db); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to copy records: %w", err)
+	}
+	return d.replaceBackend(dst, tmpPath, ConvertBackupPath(d.path, from))
+}
+
+// ConvertBackupPath is where Convert keeps the database file it replaced,
+// written by the backend from
+func ConvertBackupPath(path, from string) string {
+	return fmt.Sprintf("%s.%s.bak", path, from)
 }
 
 // contains checks if a string contains a substring (case-insensitive)
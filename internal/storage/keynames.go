@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// hiddenKeysKey marks a database whose key names are stored as digests
+const hiddenKeysKey = "hidden_keys"
+
+// nameKeyInfo separates the key name MAC key from the data key it comes from
+const nameKeyInfo = "ark key names v1"
+
+// deriveNameKey derives the key that key names are MACed with from the data key
+func deriveNameKey(dek []byte) ([]byte, error) {
+	nameKey := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, dek, nil, []byte(nameKeyInfo)), nameKey); err != nil {
+		return nil, fmt.Errorf("failed to derive name key: %w", err)
+	}
+	return nameKey, nil
+}
+
+// nameDigest returns the stored form of a key name in hidden mode
+func nameDigest(nameKey []byte, bucket, key string) []byte {
+	mac := hmac.New(sha256.New, nameKey)
+	binary.Write(mac, binary.BigEndian, uint32(len(bucket)))
+	mac.Write([]byte(bucket))
+	mac.Write([]byte(key))
+	return mac.Sum(nil)
+}
+
+// encodeNamed prefixes a value with its key name for storage in hidden mode
+func encodeNamed(name string, data []byte) []byte {
+	out := make([]byte, 0, 4+len(name)+len(data))
+	out = binary.BigEndian.AppendUint32(out, uint32(len(name)))
+	out = append(out, name...)
+	return append(out, data...)
+}
+
+// decodeNamed splits a value written by encodeNamed
+func decodeNamed(plaintext []byte) (string, []byte, error) {
+	if len(plaintext) < 4 {
+		return "", nil, fmt.Errorf("named record too short")
+	}
+	n := binary.BigEndian.Uint32(plaintext)
+	if uint64(len(plaintext)-4) < uint64(n) {
+		return "", nil, fmt.Errorf("named record too short")
+	}
+	return string(plaintext[4 : 4+n]), plaintext[4+n:], nil
+}
+
+// storageKey returns the backend key a record name is stored under
+func (d *Database) storageKey(bucket, key string) []byte {
+	if d.hiddenKeys {
+		return nameDigest(d.nameKey.Bytes(), bucket, key)
+	}
+	return []byte(key)
+}
+
+// KeyNamesHidden reports whether key names are stored as digests
+func (d *Database) KeyNamesHidden() bool {
+	return d.hiddenKeys
+}
+
+// loadKeyNameMode reads whether key names are hidden
+func (d *Database) loadKeyNameMode() error {
+	return d.db.View(func(tx BackendTx) error {
+		d.hiddenKeys = false
+		if b := tx.Bucket([]byte(metaBucket)); b != nil {
+			d.hiddenKeys = len(b.Get([]byte(hiddenKeysKey))) > 0
+		}
+		return nil
+	})
+}
+
+// keyName returns the name of a record, decrypting it in hidden mode
+func (d *Database) keyName(bucket, storedKey, value []byte) (string, error) {
+	if !d.hiddenKeys {
+		return string(storedKey), nil
+	}
+	plaintext, err := d.openRecord(bucket, storedKey, value)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt record in %s: %w", bucket, err)
+	}
+	name, _, err := decodeNamed(plaintext)
+	return name, err
+}
+
+// HideKeyNames rewrites every record so it is stored under an HMAC digest of
+// its name, with the name itself moved inside the encrypted value. Afterwards
+// the database file no longer reveals which entries it holds.
+func (d *Database) HideKeyNames() error {
+	if d.hiddenKeys {
+		return nil
+	}
+
+	err := d.db.Update(func(tx BackendTx) error {
+		if err := tx.ForEach(func(name []byte, b BackendBucket) error {
+			if isInternalBucket(name) {
+				return nil
+			}
+
+			// Collect first: backends do not allow writes while iterating
+			type record struct{ oldKey, newKey, value []byte }
+			var records []record
+			if err := b.ForEach(func(key, value []byte) error {
+				if value == nil {
+					return fmt.Errorf("unexpected nested bucket %s in %s", key, name)
+				}
+				plaintext, err := d.openRecord(name, key, value)
+				if err != nil {
+					return fmt.Errorf("failed to decrypt %s/%s: %w", name, key, err)
+				}
+				newKey := nameDigest(d.nameKey.Bytes(), string(name), string(key))
+				sealed, err := sealRecord(d.enc, name, newKey, encodeNamed(string(key), plaintext))
+				if err != nil {
+					return fmt.Errorf("failed to encrypt %s/%s: %w", name, key, err)
+				}
+				records = append(records, record{append([]byte(nil), key...), newKey, sealed})
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			for _, r := range records {
+				if err := b.Delete(r.oldKey); err != nil {
+					return err
+				}
+				if err := b.Put(r.newKey, r.value); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		meta, err := tx.CreateBucketIfNotExists([]byte(metaBucket))
+		if err != nil {
+			return err
+		}
+		return meta.Put([]byte(hiddenKeysKey), []byte{1})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to hide key names: %w", err)
+	}
+
+	d.hiddenKeys = true
+	return nil
+}
@@ -0,0 +1,389 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+)
+
+// keySlotBucket holds the key slots. Its values are not encrypted with the
+// data key, since they are needed to recover it.
+const keySlotBucket = "keyslots"
+
+// Key slot types
+const (
+	SlotTypePassword = "password"
+	SlotTypeRecovery = "recovery"
+	SlotTypeKeyfile  = "keyfile"
+)
+
+// passwordSlotID is the ID of the slot unlocked by the master password
+const passwordSlotID = "password"
+
+// ErrInvalidKey is returned when a key does not unlock any key slot
+var ErrInvalidKey = errors.New("invalid master key")
+
+// KeySlot holds the data key wrapped by one key-encryption key. Any slot
+// unlocks the database, so unlock methods can be added and revoked without
+// re-encrypting the records.
+type KeySlot struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// Salt is used to derive the key-encryption key for slots that do not use
+	// the salt stored in the configuration
+	Salt      []byte    `json:"salt,omitempty"`
+	Wrapped   []byte    `json:"wrapped"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// wrapKey encrypts dek under kek
+func wrapKey(kek, dek []byte) ([]byte, error) {
+	enc, err := crypto.NewEncryptor(kek)
+	if err != nil {
+		return nil, err
+	}
+	defer enc.Close()
+	return enc.Encrypt(dek)
+}
+
+// unwrapKey decrypts a data key wrapped by wrapKey
+func unwrapKey(kek, wrapped []byte) ([]byte, error) {
+	enc, err := crypto.NewEncryptor(kek)
+	if err != nil {
+		return nil, err
+	}
+	defer enc.Close()
+	dek, err := enc.Decrypt(wrapped)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	return dek, nil
+}
+
+// newSlotID returns a random slot ID
+func newSlotID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate slot id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// newDataKey returns a random data-encryption key
+func newDataKey() ([]byte, error) {
+	dek := make([]byte, crypto.KeySize)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	return dek, nil
+}
+
+// putKeySlot writes a slot inside tx
+func putKeySlot(tx BackendTx, slot *KeySlot) error {
+	data, err := json.Marshal(slot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal key slot: %w", err)
+	}
+	b, err := tx.CreateBucketIfNotExists([]byte(keySlotBucket))
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(slot.ID), data)
+}
+
+// readKeySlots reads all slots inside tx, sorted by creation time
+func readKeySlots(tx BackendTx) ([]KeySlot, error) {
+	var slots []KeySlot
+	b := tx.Bucket([]byte(keySlotBucket))
+	if b == nil {
+		return nil, nil
+	}
+	err := b.ForEach(func(_, value []byte) error {
+		var slot KeySlot
+		if err := json.Unmarshal(value, &slot); err != nil {
+			return fmt.Errorf("failed to unmarshal key slot: %w", err)
+		}
+		slots = append(slots, slot)
+		return nil
+	})
+	sort.Slice(slots, func(i, j int) bool { return slots[i].CreatedAt.Before(slots[j].CreatedAt) })
+	return slots, err
+}
+
+// ReadKeySlots lists the key slots of a database without unlocking it, for
+// unlock methods that need a slot's salt first
+func ReadKeySlots(path string) ([]KeySlot, error) {
+	db, err := openBackend(path, Options{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var slots []KeySlot
+	err = db.View(func(tx BackendTx) error {
+		slots, err = readKeySlots(tx)
+		return err
+	})
+	return slots, err
+}
+
+// unlock finds the slot kek opens and loads the data key from it. A database
+// without slots is set up for envelope encryption first.
+func (d *Database) unlock(kek []byte) error {
+	var slots []KeySlot
+	if err := d.db.View(func(tx BackendTx) error {
+		var err error
+		slots, err = readKeySlots(tx)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if len(slots) == 0 {
+		if d.opts.ReadOnly {
+			return errNeedsWrite
+		}
+		return d.initKeySlots(kek)
+	}
+
+	for _, slot := range slots {
+		dek, err := unwrapKey(kek, slot.Wrapped)
+		if err != nil {
+			continue
+		}
+		err = d.setDataKey(dek)
+		crypto.Wipe(dek)
+		if err != nil {
+			return err
+		}
+		d.slotID = slot.ID
+		return nil
+	}
+	return ErrInvalidKey
+}
+
+// unlockWithDataKey loads dek as the data key if it decrypts the stored
+// records and backup keys
+func (d *Database) unlockWithDataKey(dek []byte) error {
+	if err := d.setDataKey(dek); err != nil {
+		return err
+	}
+	if err := d.verifyDataKey(); err != nil {
+		return err
+	}
+	keys, err := d.loadBackupKeys()
+	if err != nil {
+		return ErrInvalidKey
+	}
+	if keys != nil {
+		keys.wipe()
+	}
+	return nil
+}
+
+// initKeySlots creates the password slot. A new database gets a random data
+// key; a database written before key slots existed has its records
+// re-encrypted under one.
+func (d *Database) initKeySlots(kek []byte) error {
+	legacy, err := d.hasRecords()
+	if err != nil {
+		return err
+	}
+
+	if legacy {
+		// Records were encrypted directly with kek - make sure it is the right key
+		if err := d.setDataKey(kek); err != nil {
+			return err
+		}
+		if err := d.verifyDataKey(); err != nil {
+			return err
+		}
+		if err := d.Rekey(kek, nil); err != nil {
+			return fmt.Errorf("failed to migrate to key slots: %w", err)
+		}
+		return RemoveRekeyBackup(d.path)
+	}
+
+	dek, err := newDataKey()
+	if err != nil {
+		return err
+	}
+	defer crypto.Wipe(dek)
+	wrapped, err := wrapKey(kek, dek)
+	if err != nil {
+		return fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	slot := &KeySlot{ID: passwordSlotID, Type: SlotTypePassword, Wrapped: wrapped, CreatedAt: time.Now()}
+	if err := d.db.Update(func(tx BackendTx) error {
+		return putKeySlot(tx, slot)
+	}); err != nil {
+		return fmt.Errorf("failed to write key slot: %w", err)
+	}
+
+	d.slotID = slot.ID
+	return d.setDataKey(dek)
+}
+
+// hasRecords reports whether any data bucket holds records
+func (d *Database) hasRecords() (bool, error) {
+	found := false
+	err := d.db.View(func(tx BackendTx) error {
+		return tx.ForEach(func(name []byte, b BackendBucket) error {
+			if !isInternalBucket(name) && b.KeyN() > 0 {
+				found = true
+			}
+			return nil
+		})
+	})
+	return found, err
+}
+
+// verifyDataKey checks that the current data key decrypts a stored record
+func (d *Database) verifyDataKey() error {
+	return d.db.View(func(tx BackendTx) error {
+		return tx.ForEach(func(name []byte, b BackendBucket) error {
+			if isInternalBucket(name) {
+				return nil
+			}
+			key, value := firstRecord(b)
+			if value == nil {
+				return nil
+			}
+			if _, err := d.openRecord(name, key, value); err != nil {
+				return ErrInvalidKey
+			}
+			return nil
+		})
+	})
+}
+
+// setDataKey switches record encryption to dek. The database keeps its own
+// locked copies of the key material, so the caller may wipe dek afterwards.
+func (d *Database) setDataKey(dek []byte) error {
+	enc, err := crypto.NewEncryptorWithCipher(dek, d.cipher)
+	if err != nil {
+		return fmt.Errorf("failed to create encryptor: %w", err)
+	}
+	nameKey, err := deriveNameKey(dek)
+	if err != nil {
+		enc.Close()
+		return err
+	}
+	defer crypto.Wipe(nameKey)
+
+	newDEK := crypto.NewSecret(dek)
+	d.wipeKeys()
+	d.enc = enc
+	d.dek = newDEK
+	d.nameKey = crypto.NewSecret(nameKey)
+	return nil
+}
+
+// wipeKeys releases the database's key material
+func (d *Database) wipeKeys() {
+	if d.enc != nil {
+		d.enc.Close()
+	}
+	d.dek.Close()
+	d.nameKey.Close()
+	d.enc, d.dek, d.nameKey = nil, nil, nil
+}
+
+// KeySlots lists the key slots
+func (d *Database) KeySlots() ([]KeySlot, error) {
+	var slots []KeySlot
+	err := d.db.View(func(tx BackendTx) error {
+		var err error
+		slots, err = readKeySlots(tx)
+		return err
+	})
+	return slots, err
+}
+
+// UnlockedSlot returns the ID of the slot the database was unlocked with
+func (d *Database) UnlockedSlot() string {
+	return d.slotID
+}
+
+// AddKeySlot wraps the data key under kek in a new slot. salt is stored with
+// the slot for deriving kek again later.
+func (d *Database) AddKeySlot(slotType string, salt, kek []byte) (*KeySlot, error) {
+	id, err := newSlotID()
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := wrapKey(kek, d.dek.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	slot := &KeySlot{ID: id, Type: slotType, Salt: salt, Wrapped: wrapped, CreatedAt: time.Now()}
+	if err := d.db.Update(func(tx BackendTx) error {
+		return putKeySlot(tx, slot)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to write key slot: %w", err)
+	}
+	return slot, nil
+}
+
+// RewrapKeySlot re-wraps the data key in an existing slot under a new kek.
+// This is all a password change has to do.
+func (d *Database) RewrapKeySlot(id string, kek []byte) error {
+	wrapped, err := wrapKey(kek, d.dek.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	return d.db.Update(func(tx BackendTx) error {
+		b := tx.Bucket([]byte(keySlotBucket))
+		if b == nil || b.Get([]byte(id)) == nil {
+			return fmt.Errorf("key slot %s not found", id)
+		}
+		var slot KeySlot
+		if err := json.Unmarshal(b.Get([]byte(id)), &slot); err != nil {
+			return fmt.Errorf("failed to unmarshal key slot: %w", err)
+		}
+		slot.Wrapped = wrapped
+		return putKeySlot(tx, &slot)
+	})
+}
+
+// SetPasswordSlot wraps the data key under kek in the password slot,
+// creating the slot if it was removed
+func (d *Database) SetPasswordSlot(kek []byte) error {
+	wrapped, err := wrapKey(kek, d.dek.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	slot := &KeySlot{ID: passwordSlotID, Type: SlotTypePassword, Wrapped: wrapped, CreatedAt: time.Now()}
+	return d.db.Update(func(tx BackendTx) error {
+		if existing := tx.Bucket([]byte(keySlotBucket)).Get([]byte(passwordSlotID)); existing != nil {
+			var old KeySlot
+			if err := json.Unmarshal(existing, &old); err == nil {
+				slot.CreatedAt = old.CreatedAt
+			}
+		}
+		return putKeySlot(tx, slot)
+	})
+}
+
+// RemoveKeySlot revokes a slot. The last slot cannot be removed.
+func (d *Database) RemoveKeySlot(id string) error {
+	return d.db.Update(func(tx BackendTx) error {
+		b := tx.Bucket([]byte(keySlotBucket))
+		if b == nil || b.Get([]byte(id)) == nil {
+			return fmt.Errorf("key slot %s not found", id)
+		}
+		if b.KeyN() <= 1 {
+			return fmt.Errorf("cannot remove the last key slot")
+		}
+		return b.Delete([]byte(id))
+	})
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultLockTimeout is how long opening a database waits for another
+// process to release it
+const DefaultLockTimeout = 10 * time.Second
+
+// Backoff between attempts to take the database file lock
+const (
+	lockRetryMin = 50 * time.Millisecond
+	lockRetryMax = time.Second
+)
+
+// ErrLocked is returned, wrapped in a LockedError, when another process
+// holds the database for longer than the lock timeout
+var ErrLocked = errors.New("database is locked")
+
+// ErrReadOnly is returned when writing to a database opened read-only
+var ErrReadOnly = errors.New("database was opened read-only")
+
+// LockOwner describes the process holding the database file. It is written
+// next to the database while it is open, so processes waiting for the lock
+// can say who they are waiting for.
+type LockOwner struct {
+	PID      int       `json:"pid"`
+	Command  string    `json:"command"`
+	ReadOnly bool      `json:"read_only"`
+	Since    time.Time `json:"since"`
+}
+
+// LockedError reports that the database is held by another process. Owner
+// is nil if the holder did not record itself.
+type LockedError struct {
+	Owner *LockOwner
+}
+
+func (e *LockedError) Error() string {
+	if e.Owner == nil {
+		return fmt.Sprintf("%v by another process", ErrLocked)
+	}
+	return fmt.Sprintf("%v by pid %d (%s)", ErrLocked, e.Owner.PID, e.Owner.Command)
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrLocked
+}
+
+// lockOwnerCommand is the command recorded in lock owner files
+var lockOwnerCommand string
+
+// SetLockOwner sets the command recorded as holding databases this process
+// opens, such as "ark backup create"
+func SetLockOwner(command string) {
+	lockOwnerCommand = command
+}
+
+// LockOwnerPath returns the path of the lock owner file of a database
+func LockOwnerPath(path string) string {
+	return path + ".owner"
+}
+
+// ReadLockOwner returns the recorded holder of the database at path, or nil
+// if none is recorded
+func ReadLockOwner(path string) *LockOwner {
+	data, err := os.ReadFile(LockOwnerPath(path))
+	if err != nil {
+		return nil
+	}
+	var owner LockOwner
+	if err := json.Unmarshal(data, &owner); err != nil || owner.PID == 0 {
+		return nil
+	}
+	return &owner
+}
+
+// writeLockOwner records this process as holding the database at path
+func writeLockOwner(path string, readOnly bool) {
+	command := lockOwnerCommand
+	if command == "" {
+		command = filepath.Base(os.Args[0])
+	}
+	data, err := json.Marshal(LockOwner{PID: os.Getpid(), Command: command, ReadOnly: readOnly, Since: time.Now()})
+	if err != nil {
+		return
+	}
+	// Best effort: the owner file only improves error messages
+	os.WriteFile(LockOwnerPath(path), data, 0600)
+}
+
+// removeLockOwner removes the lock owner file if this process wrote it
+func removeLockOwner(path string) {
+	if owner := ReadLockOwner(path); owner != nil && owner.PID == os.Getpid() {
+		os.Remove(LockOwnerPath(path))
+	}
+}
+
+// retryLocked calls open until it does not return errTimeout, backing off
+// between attempts, and gives up with a LockedError after timeout. waiting,
+// if not nil, is called once before the first retry.
+func retryLocked(path string, timeout time.Duration, waiting func(*LockOwner), errTimeout error, open func() error) error {
+	if timeout <= 0 {
+		timeout = DefaultLockTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	delay := lockRetryMin
+
+	for attempt := 0; ; attempt++ {
+		err := open()
+		if !errors.Is(err, errTimeout) {
+			return err
+		}
+
+		owner := ReadLockOwner(path)
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return &LockedError{Owner: owner}
+		}
+		if attempt == 0 && waiting != nil {
+			waiting(owner)
+		}
+		time.Sleep(min(delay, remaining))
+		delay = min(delay*2, lockRetryMax)
+	}
+}
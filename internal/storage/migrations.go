@@ -0,0 +1,14 @@
+package storage
+
+// Schema migrations, in version order. Add new ones at the end of this list,
+// and never change or remove one that has been released: databases out in
+// the world have already applied it.
+func init() {
+	// Version 1 is the schema all databases had before versions were
+	// recorded, so upgrading to it only records the version
+	RegisterMigration(Migration{
+		Version:     1,
+		Description: "Record the schema version",
+		Up:          func(tx *Tx) error { return nil },
+	})
+}
@@ -59,6 +59,7 @@ type EC2Instance struct {
 	InstanceID   string            `json:"instance_id"`
 	State        string            `json:"state"`
 	InstanceType string            `json:"instance_type"`
+	Profile      string            `json:"profile,omitempty"` // AWS profile the instance was registered with
 	PublicIP     string            `json:"public_ip,omitempty"`
 	PrivateIP    string            `json:"private_ip,omitempty"`
 	SSHKeyPath   string            `json:"ssh_key_path,omitempty"`
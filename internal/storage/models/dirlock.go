@@ -59,6 +59,20 @@ func (d *LockedDirectory) IsLocked() bool {
 	return d.Encrypted
 }
 
+// Lock states of a directory
+const (
+	LockStateLocked   = "locked"
+	LockStateUnlocked = "unlocked"
+)
+
+// State returns the lock state of the directory
+func (d *LockedDirectory) State() string {
+	if d.IsLocked() {
+		return LockStateLocked
+	}
+	return LockStateUnlocked
+}
+
 // GetPassword returns the password to use for this directory
 func (d *LockedDirectory) GetPassword(masterPassword string) string {
 	if d.UseMaster {
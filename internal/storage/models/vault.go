@@ -1,6 +1,8 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
 	"strings"
 	"time"
 )
@@ -114,3 +116,44 @@ func (e *VaultEntry) MatchesSearch(query string) bool {
 
 	return false
 }
+
+// Fields returns the top-level fields of a JSON entry as strings
+func (e *VaultEntry) Fields() (map[string]string, error) {
+	if e.Format != "json" {
+		return nil, fmt.Errorf("entry '%s' is not in json format", e.Key)
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(e.Value), &raw); err != nil {
+		return nil, fmt.Errorf("entry '%s' is not a json object: %w", e.Key, err)
+	}
+
+	fields := make(map[string]string, len(raw))
+	for name, value := range raw {
+		switch v := value.(type) {
+		case string:
+			fields[name] = v
+		case nil:
+			fields[name] = ""
+		default:
+			// Numbers, booleans and nested values keep their JSON encoding
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode field %s: %w", name, err)
+			}
+			fields[name] = string(encoded)
+		}
+	}
+
+	return fields, nil
+}
+
+// Field returns a single top-level field of a JSON entry
+func (e *VaultEntry) Field(name string) (string, bool) {
+	fields, err := e.Fields()
+	if err != nil {
+		return "", false
+	}
+	value, exists := fields[name]
+	return value, exists
+}
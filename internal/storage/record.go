@@ -0,0 +1,282 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+)
+
+// metaBucket holds plaintext bookkeeping about the database itself
+const metaBucket = "meta"
+
+// recordFormatKey records the envelope format of the stored records
+const recordFormatKey = "record_format"
+
+// cipherKey records the cipher suite new records are sealed with
+const cipherKey = "cipher"
+
+// Record envelope formats
+const (
+	// recordFormatLegacy records are a bare nonce and ciphertext, not bound
+	// to where they are stored
+	recordFormatLegacy = 0
+	// recordFormatV1 records start with an envelope version, and have the
+	// version, bucket and key authenticated as additional data
+	recordFormatV1 = 1
+)
+
+// Record envelope versions, the first byte of each record
+const (
+	// recordV1 is followed by an AES-256-GCM nonce and ciphertext
+	recordV1 = 1
+	// recordV2 is followed by a ciphertext tagged with its cipher suite
+	recordV2 = 2
+)
+
+// ErrRecordTampered is returned when a record fails authentication, for
+// example because it was copied to another key or bucket
+var ErrRecordTampered = errors.New("record failed authentication")
+
+// isInternalBucket reports whether a bucket holds database bookkeeping rather
+// than encrypted records
+func isInternalBucket(name []byte) bool {
+	return string(name) == keySlotBucket || string(name) == metaBucket
+}
+
+// recordAAD binds a record to its format version, bucket and key. The bucket
+// name is length-prefixed so bucket/key pairs cannot be confused.
+func recordAAD(version byte, bucket, key []byte) []byte {
+	aad := make([]byte, 0, 1+4+len(bucket)+len(key))
+	aad = append(aad, version)
+	aad = binary.BigEndian.AppendUint32(aad, uint32(len(bucket)))
+	aad = append(aad, bucket...)
+	return append(aad, key...)
+}
+
+// sealRecord encrypts a record for storage under bucket/key with the
+// encryptor's cipher suite
+func sealRecord(enc *crypto.Encryptor, bucket, key, plaintext []byte) ([]byte, error) {
+	ciphertext, err := enc.Seal(plaintext, recordAAD(recordV2, bucket, key))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{recordV2}, ciphertext...), nil
+}
+
+// openRecord decrypts a record stored under bucket/key in the database's
+// record format
+func (d *Database) openRecord(bucket, key, value []byte) ([]byte, error) {
+	if d.recordFormat == recordFormatLegacy {
+		return d.enc.Decrypt(value)
+	}
+
+	if len(value) == 0 {
+		return nil, fmt.Errorf("%w: empty record", ErrRecordTampered)
+	}
+	var plaintext []byte
+	var err error
+	switch value[0] {
+	case recordV1:
+		plaintext, err = d.enc.DecryptWithAAD(value[1:], recordAAD(recordV1, bucket, key))
+	case recordV2:
+		plaintext, err = d.enc.Open(value[1:], recordAAD(recordV2, bucket, key))
+	default:
+		return nil, fmt.Errorf("%w: unknown record version %d", ErrRecordTampered, value[0])
+	}
+	if err != nil {
+		return nil, ErrRecordTampered
+	}
+	return plaintext, nil
+}
+
+// Cipher returns the cipher suite new records are sealed with
+func (d *Database) Cipher() byte {
+	return d.cipher
+}
+
+// loadCipher reads the cipher suite new records are sealed with
+func (d *Database) loadCipher() error {
+	d.cipher = crypto.DefaultCipher
+	return d.db.View(func(tx BackendTx) error {
+		if b := tx.Bucket([]byte(metaBucket)); b != nil {
+			if stored := b.Get([]byte(cipherKey)); len(stored) == 1 {
+				if _, err := crypto.CipherByID(stored[0]); err != nil {
+					return err
+				}
+				d.cipher = stored[0]
+			}
+		}
+		return nil
+	})
+}
+
+// loadMeta reads the database bookkeeping that decides how records are
+// stored
+func (d *Database) loadMeta() error {
+	if err := d.loadRecordFormat(); err != nil {
+		return fmt.Errorf("failed to read record format: %w", err)
+	}
+	if err := d.loadKeyNameMode(); err != nil {
+		return fmt.Errorf("failed to read key name mode: %w", err)
+	}
+	if err := d.loadCipher(); err != nil {
+		return fmt.Errorf("failed to read cipher: %w", err)
+	}
+	return nil
+}
+
+// Reencrypt re-seals every record with the given cipher suite and makes it
+// the suite for new records. It runs in a single transaction, so a failure
+// leaves the database as it was.
+func (d *Database) Reencrypt(suiteID byte, progress RekeyProgress) error {
+	enc, err := crypto.NewEncryptorWithCipher(d.dek.Bytes(), suiteID)
+	if err != nil {
+		return err
+	}
+
+	err = d.db.Update(func(tx BackendTx) error {
+		if err := resealRecords(tx, d.openRecord, enc, progress); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(metaBucket)).Put([]byte(cipherKey), []byte{suiteID})
+	})
+	if err != nil {
+		enc.Close()
+		return fmt.Errorf("failed to re-encrypt records: %w", err)
+	}
+
+	d.enc.Close()
+	d.enc = enc
+	d.cipher = suiteID
+	return nil
+}
+
+// resealRecords re-encrypts every record in tx with enc, decrypting each one
+// with open
+func resealRecords(tx BackendTx, open func(bucket, key, value []byte) ([]byte, error), enc *crypto.Encryptor, progress RekeyProgress) error {
+	total := 0
+	if progress != nil {
+		tx.ForEach(func(name []byte, b BackendBucket) error {
+			if !isInternalBucket(name) {
+				total += b.KeyN()
+			}
+			return nil
+		})
+	}
+
+	done := 0
+	return tx.ForEach(func(name []byte, b BackendBucket) error {
+		if isInternalBucket(name) {
+			return nil
+		}
+
+		// Collect first: backends do not allow writes while iterating
+		type record struct{ key, value []byte }
+		var records []record
+		if err := b.ForEach(func(key, value []byte) error {
+			if value == nil {
+				return fmt.Errorf("unexpected nested bucket %s in %s", key, name)
+			}
+			plaintext, err := open(name, key, value)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt %s/%s: %w", name, key, err)
+			}
+			sealed, err := sealRecord(enc, name, key, plaintext)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt %s/%s: %w", name, key, err)
+			}
+			records = append(records, record{append([]byte(nil), key...), sealed})
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, r := range records {
+			if err := b.Put(r.key, r.value); err != nil {
+				return err
+			}
+			done++
+			if progress != nil {
+				progress(done, total)
+			}
+		}
+		return nil
+	})
+}
+
+// loadRecordFormat reads the record format. A database without one is new,
+// unless it already holds records written before the format was recorded.
+func (d *Database) loadRecordFormat() error {
+	var stored []byte
+	if err := d.db.View(func(tx BackendTx) error {
+		if b := tx.Bucket([]byte(metaBucket)); b != nil {
+			stored = b.Get([]byte(recordFormatKey))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if len(stored) == 1 {
+		d.recordFormat = stored[0]
+		if d.recordFormat > recordFormatV1 {
+			return fmt.Errorf("record format %d is newer than this version of ark supports", d.recordFormat)
+		}
+		return nil
+	}
+
+	legacy, err := d.hasRecords()
+	if err != nil {
+		return err
+	}
+	if legacy {
+		d.recordFormat = recordFormatLegacy
+		return nil
+	}
+	if d.opts.ReadOnly {
+		return errNeedsWrite
+	}
+	d.recordFormat = recordFormatV1
+	return d.db.Update(func(tx BackendTx) error {
+		return putRecordFormat(tx, recordFormatV1)
+	})
+}
+
+// putRecordFormat records the record format in tx
+func putRecordFormat(tx BackendTx, format byte) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(metaBucket))
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(recordFormatKey), []byte{format})
+}
+
+// migrateRecords re-seals legacy records in place so they are bound to their
+// bucket and key. It runs in a single transaction, so a failure leaves the
+// database as it was.
+func (d *Database) migrateRecords() error {
+	if d.recordFormat == recordFormatV1 {
+		return nil
+	}
+	if d.opts.ReadOnly {
+		return errNeedsWrite
+	}
+
+	legacyOpen := func(bucket, key, value []byte) ([]byte, error) {
+		return d.enc.Decrypt(value)
+	}
+	err := d.db.Update(func(tx BackendTx) error {
+		if err := resealRecords(tx, legacyOpen, d.enc, nil); err != nil {
+			return err
+		}
+		return putRecordFormat(tx, recordFormatV1)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to migrate records: %w", err)
+	}
+
+	d.recordFormat = recordFormatV1
+	return nil
+}
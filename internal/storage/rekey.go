@@ -0,0 +1,239 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mbeniwal-imwe/ark/internal/core/crypto"
+)
+
+// RekeyProgress is called as records are re-encrypted
+type RekeyProgress func(done, total int)
+
+// BackupPath returns where Rekey keeps the previous database file
+func BackupPath(path string) string {
+	return path + ".bak"
+}
+
+// Rekey rotates the data key: every record is re-encrypted under a fresh
+// data key, which is wrapped under kek in the password slot. Other key slots
+// wrap the old data key and are revoked.
+//
+// The records are copied into a new file in a single transaction, and that
+// file then atomically replaces the database. The previous file is kept at
+// BackupPath until RemoveRekeyBackup or RestoreRekeyBackup is called.
+//
+// Rekey fails without touching the database if any record cannot be
+// decrypted with the current data key.
+func (d *Database) Rekey(kek []byte, progress RekeyProgress) error {
+	if d.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	dek, err := newDataKey()
+	if err != nil {
+		return err
+	}
+	defer crypto.Wipe(dek)
+	newEnc, err := crypto.NewEncryptorWithCipher(dek, d.cipher)
+	if err != nil {
+		return fmt.Errorf("failed to create encryptor: %w", err)
+	}
+	defer newEnc.Close()
+	newNameKey, err := deriveNameKey(dek)
+	if err != nil {
+		return err
+	}
+	defer crypto.Wipe(newNameKey)
+	wrapped, err := wrapKey(kek, dek)
+	if err != nil {
+		return fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	slot := &KeySlot{ID: passwordSlotID, Type: SlotTypePassword, Wrapped: wrapped, CreatedAt: time.Now()}
+
+	tmpPath := d.path + ".rekey"
+	dst, err := d.createReplacement(tmpPath, d.db.Kind())
+	if err != nil {
+		return err
+	}
+	if err := d.copyReencrypted(dst, newEnc, newNameKey, slot, progress); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// Keep the old file until the caller has committed the new key
+	if err := d.replaceBackend(dst, tmpPath, BackupPath(d.path)); err != nil {
+		return err
+	}
+
+	if err := d.setDataKey(dek); err != nil {
+		return err
+	}
+	d.slotID = slot.ID
+	d.recordFormat = recordFormatV1
+	return nil
+}
+
+// createReplacement creates an empty backend of kind at tmpPath, to be
+// filled and then swapped in by replaceBackend
+func (d *Database) createReplacement(tmpPath, kind string) (Backend, error) {
+	if d.inMemory() {
+		return newMemoryBackend(), nil
+	}
+	os.Remove(tmpPath)
+	dst, err := openBackend(tmpPath, Options{Backend: kind})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database: %w", err)
+	}
+	return dst, nil
+}
+
+// replaceBackend swaps dst, created by createReplacement, in for the current
+// backend. The current file is kept at backupPath, unless it is empty.
+func (d *Database) replaceBackend(dst Backend, tmpPath, backupPath string) error {
+	if d.inMemory() {
+		d.db.Close()
+		d.db = dst
+		return nil
+	}
+
+	if err := dst.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close database: %w", err)
+	}
+	if backupPath != "" {
+		if err := writeSnapshot(d.db, backupPath); err != nil {
+			os.Remove(tmpPath)
+			return fmt.Errorf("failed to back up database: %w", err)
+		}
+	}
+	if err := d.db.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close database: %w", err)
+	}
+	if err := os.Rename(tmpPath, d.path); err != nil {
+		os.Remove(tmpPath)
+		if reopenErr := d.reopen(); reopenErr != nil {
+			return fmt.Errorf("failed to replace database: %w (reopen failed: %v)", err, reopenErr)
+		}
+		return fmt.Errorf("failed to replace database: %w", err)
+	}
+	return d.reopen()
+}
+
+// copyReencrypted writes every bucket into the empty backend dst, with slot
+// as its only key slot. Hidden key names are re-hashed under newNameKey.
+func (d *Database) copyReencrypted(dst Backend, newEnc *crypto.Encryptor, newNameKey []byte, slot *KeySlot, progress RekeyProgress) error {
+	return d.db.View(func(src BackendTx) error {
+		total := 0
+		if err := src.ForEach(func(name []byte, b BackendBucket) error {
+			if !isInternalBucket(name) {
+				total += b.KeyN()
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		done := 0
+		return dst.Update(func(tx BackendTx) error {
+			if err := putKeySlot(tx, slot); err != nil {
+				return fmt.Errorf("failed to write key slot: %w", err)
+			}
+			if err := putRecordFormat(tx, recordFormatV1); err != nil {
+				return fmt.Errorf("failed to write record format: %w", err)
+			}
+			if err := tx.Bucket([]byte(metaBucket)).Put([]byte(cipherKey), []byte{d.cipher}); err != nil {
+				return fmt.Errorf("failed to write cipher: %w", err)
+			}
+			if d.hiddenKeys {
+				if err := tx.Bucket([]byte(metaBucket)).Put([]byte(hiddenKeysKey), []byte{1}); err != nil {
+					return fmt.Errorf("failed to write key name mode: %w", err)
+				}
+			}
+			keys, err := readBackupKeys(src, d.enc)
+			if err != nil {
+				return err
+			}
+			if keys != nil {
+				defer keys.wipe()
+				if err := putBackupKeys(tx, newEnc, keys); err != nil {
+					return err
+				}
+			}
+
+			return src.ForEach(func(name []byte, b BackendBucket) error {
+				if isInternalBucket(name) {
+					return nil
+				}
+				out, err := tx.CreateBucketIfNotExists(name)
+				if err != nil {
+					return fmt.Errorf("failed to create bucket %s: %w", name, err)
+				}
+
+				return b.ForEach(func(key, value []byte) error {
+					if value == nil {
+						return fmt.Errorf("unexpected nested bucket %s in %s", key, name)
+					}
+
+					plaintext, err := d.openRecord(name, key, value)
+					if err != nil {
+						return fmt.Errorf("failed to decrypt %s/%s: %w", name, key, err)
+					}
+					newKey := key
+					if d.hiddenKeys {
+						keyName, _, err := decodeNamed(plaintext)
+						if err != nil {
+							return fmt.Errorf("failed to decode %s/%x: %w", name, key, err)
+						}
+						newKey = nameDigest(newNameKey, string(name), keyName)
+					}
+					ciphertext, err := sealRecord(newEnc, name, newKey, plaintext)
+					if err != nil {
+						return fmt.Errorf("failed to encrypt %s/%s: %w", name, key, err)
+					}
+					if err := out.Put(newKey, ciphertext); err != nil {
+						return err
+					}
+
+					done++
+					if progress != nil {
+						progress(done, total)
+					}
+					return nil
+				})
+			})
+		})
+	})
+}
+
+// reopen opens the database file again after it was replaced, with the
+// backend that wrote the new file
+func (d *Database) reopen() error {
+	opts := d.opts
+	opts.Backend = d.db.Kind()
+	db, err := openBackend(d.path, opts)
+	if err != nil {
+		return fmt.Errorf("failed to reopen database: %w", err)
+	}
+	d.db = db
+	return nil
+}
+
+// RestoreRekeyBackup puts the pre-Rekey database file back in place. The
+// Database must be closed first.
+func RestoreRekeyBackup(path string) error {
+	if err := os.Rename(BackupPath(path), path); err != nil {
+		return fmt.Errorf("failed to restore database backup: %w", err)
+	}
+	return nil
+}
+
+// RemoveRekeyBackup deletes the pre-Rekey database file
+func RemoveRekeyBackup(path string) error {
+	if err := os.Remove(BackupPath(path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	// configBucket holds application settings, including the schema version
+	configBucket = "config"
+	// schemaVersionKey records the last migration applied to the database.
+	// It is an encrypted record like any other, so it cannot be rolled back
+	// without the data key.
+	schemaVersionKey = "schema_version"
+)
+
+// ErrSchemaTooNew is returned when a database was migrated by a newer
+// version of ark than this one
+var ErrSchemaTooNew = errors.New("database schema is newer than this version of ark supports")
+
+// errDryRun rolls back the transaction of MigrateDryRun
+var errDryRun = errors.New("dry run")
+
+// Migration upgrades the database from Version-1 to Version. Up runs in a
+// single transaction together with the version bump, so a migration either
+// applies completely or not at all.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(tx *Tx) error
+}
+
+var (
+	migrations       []Migration
+	migrationsSorted bool
+)
+
+// RegisterMigration adds a migration to the registry. Versions must be unique
+// and, once released, never change meaning.
+func RegisterMigration(m Migration) {
+	if m.Version < 1 || m.Up == nil {
+		panic(fmt.Sprintf("storage: invalid migration %d", m.Version))
+	}
+	for _, existing := range migrations {
+		if existing.Version == m.Version {
+			panic(fmt.Sprintf("storage: migration %d registered twice", m.Version))
+		}
+	}
+	migrations = append(migrations, m)
+	migrationsSorted = false
+}
+
+// Migrations returns the registered migrations in version order
+func Migrations() []Migration {
+	if !migrationsSorted {
+		sort.Slice(migrations, func(a, b int) bool { return migrations[a].Version < migrations[b].Version })
+		migrationsSorted = true
+	}
+	return append([]Migration(nil), migrations...)
+}
+
+// LatestSchemaVersion is the version a fully migrated database has
+func LatestSchemaVersion() int {
+	all := Migrations()
+	if len(all) == 0 {
+		return 0
+	}
+	return all[len(all)-1].Version
+}
+
+// MigrationBackupPath is where the database is copied before migrating it
+// from version
+func MigrationBackupPath(path string, version int) string {
+	return fmt.Sprintf("%s.v%d.bak", path, version)
+}
+
+// SchemaVersion returns the schema version of the database. Databases from
+// before schema versions were recorded are version 0.
+func (d *Database) SchemaVersion() (int, error) {
+	var version int
+	err := d.view(func(tx *Tx) error {
+		var err error
+		version, err = tx.schemaVersion()
+		return err
+	})
+	return version, err
+}
+
+func (t *Tx) schemaVersion() (int, error) {
+	ok, err := t.Exists(configBucket, schemaVersionKey)
+	if err != nil || !ok {
+		return 0, err
+	}
+	var version int
+	if err := t.Get(configBucket, schemaVersionKey, &version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// PendingMigrations lists the migrations the database has not had yet
+func (d *Database) PendingMigrations() ([]Migration, error) {
+	version, err := d.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	return pendingFrom(version), nil
+}
+
+func pendingFrom(version int) []Migration {
+	var pending []Migration
+	for _, m := range Migrations() {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+// Migrate applies the pending migrations in order, each in its own
+// transaction, after copying the database to MigrationBackupPath. progress,
+// if not nil, is called before each migration. If a migration fails, the
+// ones before it stay applied and the error names the backup. In-memory
+// databases are not backed up.
+func (d *Database) Migrate(progress func(Migration)) ([]Migration, error) {
+	from, err := d.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	pending := pendingFrom(from)
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	var backup string
+	if !d.inMemory() {
+		backup = MigrationBackupPath(d.path, from)
+		if err := writeSnapshot(d.db, backup); err != nil {
+			return nil, fmt.Errorf("failed to back up database before migrating: %w", err)
+		}
+	}
+
+	var applied []Migration
+	for _, m := range pending {
+		if progress != nil {
+			progress(m)
+		}
+		if err := d.update(func(tx *Tx) error { return tx.applyMigration(m) }); err != nil {
+			err = fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Description, err)
+			if backup != "" {
+				err = fmt.Errorf("%w (the database before migrating is at %s)", err, backup)
+			}
+			return applied, err
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+// MigrateDryRun applies the pending migrations in a transaction that is
+// rolled back, reporting whether they would succeed without changing the
+// database
+func (d *Database) MigrateDryRun() ([]Migration, error) {
+	var pending []Migration
+	err := d.update(func(t *Tx) error {
+		from, err := t.schemaVersion()
+		if err != nil {
+			return err
+		}
+		pending = pendingFrom(from)
+		for _, m := range pending {
+			if err := t.applyMigration(m); err != nil {
+				return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Description, err)
+			}
+		}
+		return errDryRun
+	})
+	if err == errDryRun {
+		return pending, nil
+	}
+	return pending, err
+}
+
+func (t *Tx) applyMigration(m Migration) error {
+	if err := m.Up(t); err != nil {
+		return err
+	}
+	return t.Set(configBucket, schemaVersionKey, m.Version)
+}
+
+// checkSchema stamps new databases with the latest schema version, refuses
+// databases from newer versions of ark, and migrates older ones unless
+// opts.SkipMigrations is set
+func (d *Database) checkSchema(opts Options) error {
+	var version int
+	fresh := false
+	err := d.view(func(tx *Tx) error {
+		ok, err := tx.Exists(configBucket, schemaVersionKey)
+		if err != nil || ok {
+			version, err = tx.schemaVersion()
+			return err
+		}
+		fresh, err = tx.empty()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	latest := LatestSchemaVersion()
+	switch {
+	case (fresh || version < latest && !opts.SkipMigrations) && opts.ReadOnly:
+		return errNeedsWrite
+	case fresh:
+		// Nothing to migrate in a database that was just created
+		return d.update(func(tx *Tx) error {
+			return tx.Set(configBucket, schemaVersionKey, latest)
+		})
+	case version > latest:
+		return fmt.Errorf("%w (database is version %d, latest known is %d)", ErrSchemaTooNew, version, latest)
+	case version < latest && !opts.SkipMigrations:
+		if _, err := d.Migrate(nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// empty reports whether no data bucket holds any records
+func (t *Tx) empty() (bool, error) {
+	for _, name := range t.Buckets() {
+		if k, _ := firstRecord(t.tx.Bucket([]byte(name))); k != nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Tx reads and writes records within a single backend transaction. Records are
+// encrypted and decrypted exactly as by the Database methods of the same name.
+type Tx struct {
+	d        *Database
+	tx       BackendTx
+	writable bool
+}
+
+// Writable reports whether the transaction can write records
+func (t *Tx) Writable() bool {
+	return t.writable
+}
+
+// bucket returns the named data bucket
+func (t *Tx) bucket(name string) (BackendBucket, error) {
+	b := t.tx.Bucket([]byte(name))
+	if b == nil || isInternalBucket([]byte(name)) {
+		return nil, fmt.Errorf("bucket %s not found", name)
+	}
+	return b, nil
+}
+
+// Set stores an encrypted value in the specified bucket
+func (t *Tx) Set(bucket, key string, value interface{}) error {
+	b, err := t.bucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	// Serialize value to JSON
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal value: %w", err)
+	}
+
+	// Hidden key names travel inside the encrypted value
+	storedKey := t.d.storageKey(bucket, key)
+	if t.d.hiddenKeys {
+		data = encodeNamed(key, data)
+	}
+
+	// Encrypt data, bound to where it is stored
+	encryptedData, err := sealRecord(t.d.enc, []byte(bucket), storedKey, data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt data: %w", err)
+	}
+	return b.Put(storedKey, encryptedData)
+}
+
+// Get retrieves and decrypts a value from the specified bucket. It returns
+// ErrRecordTampered if the record was not written under this bucket and key.
+func (t *Tx) Get(bucket, key string, dest interface{}) error {
+	b, err := t.bucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	storedKey := t.d.storageKey(bucket, key)
+	encryptedData := b.Get(storedKey)
+	if encryptedData == nil {
+		return fmt.Errorf("key %s not found in bucket %s", key, bucket)
+	}
+
+	name, decryptedData, err := t.open(bucket, storedKey, encryptedData)
+	if err != nil {
+		return err
+	}
+	if name != key {
+		return ErrRecordTampered
+	}
+
+	// Unmarshal to destination
+	if err := json.Unmarshal(decryptedData, dest); err != nil {
+		return fmt.Errorf("failed to unmarshal data: %w", err)
+	}
+	return nil
+}
+
+// open decrypts a stored record and returns its name and JSON value
+func (t *Tx) open(bucket string, storedKey, value []byte) (string, []byte, error) {
+	data, err := t.d.openRecord([]byte(bucket), storedKey, value)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decrypt data: %w", err)
+	}
+	if !t.d.hiddenKeys {
+		return string(storedKey), data, nil
+	}
+
+	name, data, err := decodeNamed(data)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode data: %w", err)
+	}
+	if !bytes.Equal(nameDigest(t.d.nameKey.Bytes(), bucket, name), storedKey) {
+		return "", nil, ErrRecordTampered
+	}
+	return name, data, nil
+}
+
+// ForEach calls fn for every record in bucket, in stored key order. decode
+// unmarshals the decrypted record into dest. A record that cannot be
+// decrypted fails decode rather than ForEach, so fn can skip it; its key is
+// then the stored digest in hex if key names are hidden. fn may write to the
+// bucket.
+func (t *Tx) ForEach(bucket string, fn func(key string, decode func(dest interface{}) error) error) error {
+	b, err := t.bucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	// Collect first: backends do not allow writes while iterating
+	type record struct{ key, value []byte }
+	var records []record
+	if err := b.ForEach(func(key, value []byte) error {
+		records = append(records, record{append([]byte(nil), key...), append([]byte(nil), value...)})
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		name, data, openErr := t.open(bucket, r.key, r.value)
+		if openErr != nil {
+			name = string(r.key)
+			if t.d.hiddenKeys {
+				name = hex.EncodeToString(r.key)
+			}
+		}
+		decode := func(dest interface{}) error {
+			if openErr != nil {
+				return openErr
+			}
+			if err := json.Unmarshal(data, dest); err != nil {
+				return fmt.Errorf("failed to unmarshal data: %w", err)
+			}
+			return nil
+		}
+		if err := fn(name, decode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Exists checks if a key exists in the specified bucket
+func (t *Tx) Exists(bucket, key string) (bool, error) {
+	b, err := t.bucket(bucket)
+	if err != nil {
+		return false, err
+	}
+	return b.Get(t.d.storageKey(bucket, key)) != nil, nil
+}
+
+// Delete removes a key from the specified bucket
+func (t *Tx) Delete(bucket, key string) error {
+	b, err := t.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	t.d.deleted.Store(true)
+	return b.Delete(t.d.storageKey(bucket, key))
+}
+
+// List returns all keys in the specified bucket. With hidden key names, a
+// record that cannot be decrypted has no readable name and is left out.
+func (t *Tx) List(bucket string) ([]string, error) {
+	b, err := t.bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	err = b.ForEach(func(key, value []byte) error {
+		name, err := t.d.keyName([]byte(bucket), key, value)
+		if err != nil {
+			return nil
+		}
+		keys = append(keys, name)
+		return nil
+	})
+	return keys, err
+}
+
+// clear removes every record in the specified bucket, including those that
+// cannot be decrypted
+func (t *Tx) clear(bucket string) error {
+	b, err := t.bucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	var keys [][]byte
+	if err := b.ForEach(func(key, _ []byte) error {
+		keys = append(keys, append([]byte(nil), key...))
+		return nil
+	}); err != nil {
+		return err
+	}
+	t.d.deleted.Store(true)
+	for _, key := range keys {
+		if err := b.Delete(key); err != nil {
+			return fmt.Errorf("failed to delete key %x: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// CreateBucket creates a data bucket if it does not exist yet
+func (t *Tx) CreateBucket(name string) error {
+	if isInternalBucket([]byte(name)) {
+		return fmt.Errorf("bucket %s is reserved", name)
+	}
+	if _, err := t.tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+		return fmt.Errorf("failed to create bucket %s: %w", name, err)
+	}
+	return nil
+}
+
+// DeleteBucket removes a data bucket and everything in it
+func (t *Tx) DeleteBucket(name string) error {
+	if isInternalBucket([]byte(name)) {
+		return fmt.Errorf("bucket %s is reserved", name)
+	}
+	t.d.deleted.Store(true)
+	if err := t.tx.DeleteBucket([]byte(name)); err != nil && err != ErrBucketNotFound {
+		return fmt.Errorf("failed to delete bucket %s: %w", name, err)
+	}
+	return nil
+}
+
+// Buckets lists the data buckets
+func (t *Tx) Buckets() []string {
+	var names []string
+	t.tx.ForEach(func(name []byte, _ BackendBucket) error {
+		if !isInternalBucket(name) {
+			names = append(names, string(name))
+		}
+		return nil
+	})
+	return names
+}
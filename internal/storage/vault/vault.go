@@ -11,12 +11,19 @@ import (
 
 // VaultManager manages vault operations
 type VaultManager struct {
-	db *storage.Database
+	db      storage.Store
+	entries *storage.Collection[models.VaultEntry]
 }
 
 // NewVaultManager creates a new vault manager
-func NewVaultManager(db *storage.Database) *VaultManager {
-	return &VaultManager{db: db}
+func NewVaultManager(db storage.Store) *VaultManager {
+	return &VaultManager{
+		db: db,
+		entries: storage.NewCollection(db, "vault", storage.Index[models.VaultEntry]{
+			Name:   "tag",
+			Values: func(e *models.VaultEntry) []string { return e.Tags },
+		}),
+	}
 }
 
 // Set stores a value in the vault
@@ -36,41 +43,114 @@ func (vm *VaultManager) Set(key, value, format, description string, tags []strin
 	}
 
 	// Store in database
-	return vm.db.Set("vault", key, entry)
+	return vm.entries.Put(key, entry)
 }
 
 // Get retrieves a value from the vault
 func (vm *VaultManager) Get(key string) (*models.VaultEntry, error) {
-	var entry models.VaultEntry
-	err := vm.db.Get("vault", key, &entry)
+	var entry *models.VaultEntry
+	err := vm.read(func(tx *storage.Tx) error {
+		var err error
+		entry, err = getEntry(vm.entries.In(tx), key)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get vault entry: %w", err)
 	}
+	return entry, nil
+}
 
-	// Update last accessed time
-	entry.UpdatedAt = time.Now()
-	vm.db.Set("vault", key, entry)
-
-	return &entry, nil
+// read runs fn in a transaction that can record accesses, or in a read-only
+// one if the database was opened read-only
+func (vm *VaultManager) read(fn func(tx *storage.Tx) error) error {
+	if vm.db.ReadOnly() {
+		return vm.db.View(fn)
+	}
+	return vm.db.Update(fn)
 }
 
-// List returns all vault entries
-func (vm *VaultManager) List() ([]*models.VaultEntry, error) {
-	keys, err := vm.db.List("vault")
+// getEntry reads an entry inside tx and records the access
+func getEntry(entries *storage.CollectionTx[models.VaultEntry], key string) (*models.VaultEntry, error) {
+	entry, err := entries.Get(key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list vault keys: %w", err)
+		return nil, err
 	}
+	return entry, touchEntry(entries, key, entry)
+}
+
+// touchEntry updates an entry's last accessed time inside tx, unless tx is
+// read-only
+func touchEntry(entries *storage.CollectionTx[models.VaultEntry], key string, entry *models.VaultEntry) error {
+	if !entries.Writable() {
+		return nil
+	}
+	entry.UpdatedAt = time.Now()
+	return entries.Put(key, entry)
+}
 
+// getEntries reads the entries for keys in one transaction, skipping those
+// that cannot be read
+func (vm *VaultManager) getEntries(keys []string) ([]*models.VaultEntry, error) {
 	var entries []*models.VaultEntry
-	for _, key := range keys {
-		entry, err := vm.Get(key)
+	err := vm.read(func(tx *storage.Tx) error {
+		entries = nil
+		in := vm.entries.In(tx)
+		for _, key := range keys {
+			entry, err := getEntry(in, key)
+			if err != nil {
+				continue // Skip invalid entries
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// modifyEntry applies change to an existing entry in one transaction
+func (vm *VaultManager) modifyEntry(key string, change func(entry *models.VaultEntry)) error {
+	return vm.db.Update(func(tx *storage.Tx) error {
+		entries := vm.entries.In(tx)
+		entry, err := entries.Get(key)
 		if err != nil {
-			continue // Skip invalid entries
+			return fmt.Errorf("failed to get vault entry: %w", err)
 		}
-		entries = append(entries, entry)
+		change(entry)
+		return entries.Put(key, entry)
+	})
+}
+
+// List returns all readable vault entries
+func (vm *VaultManager) List() ([]*models.VaultEntry, error) {
+	entries, _, err := vm.ListWithSkipped()
+	return entries, err
+}
+
+// ListWithSkipped returns all readable vault entries, along with the keys of
+// entries that could not be read, so callers can point at 'ark db check'
+func (vm *VaultManager) ListWithSkipped() ([]*models.VaultEntry, []string, error) {
+	var entries []*models.VaultEntry
+	var skipped []string
+	err := vm.read(func(tx *storage.Tx) error {
+		entries, skipped = nil, nil
+		in := vm.entries.In(tx)
+		return in.ForEach(func(key string, entry *models.VaultEntry, err error) error {
+			if err != nil {
+				skipped = append(skipped, key)
+				return nil
+			}
+			if err := touchEntry(in, key, entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list vault entries: %w", err)
 	}
 
-	return entries, nil
+	return entries, skipped, nil
 }
 
 // Search searches for vault entries matching the query
@@ -79,15 +159,14 @@ func (vm *VaultManager) Search(query string) ([]*models.VaultEntry, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to search vault: %w", err)
 	}
+	found, err := vm.getEntries(keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search vault: %w", err)
+	}
 
+	// Additional client-side filtering
 	var entries []*models.VaultEntry
-	for _, key := range keys {
-		entry, err := vm.Get(key)
-		if err != nil {
-			continue // Skip invalid entries
-		}
-
-		// Additional client-side filtering
+	for _, entry := range found {
 		if entry.MatchesSearch(query) {
 			entries = append(entries, entry)
 		}
@@ -98,73 +177,118 @@ func (vm *VaultManager) Search(query string) ([]*models.VaultEntry, error) {
 
 // Delete removes a vault entry
 func (vm *VaultManager) Delete(key string) error {
-	// Check if entry exists
-	exists, err := vm.db.Exists("vault", key)
-	if err != nil {
-		return fmt.Errorf("failed to check if entry exists: %w", err)
-	}
+	return vm.db.Update(func(tx *storage.Tx) error {
+		entries := vm.entries.In(tx)
 
-	if !exists {
-		return fmt.Errorf("vault entry '%s' not found", key)
-	}
+		// Check if entry exists
+		exists, err := entries.Exists(key)
+		if err != nil {
+			return fmt.Errorf("failed to check if entry exists: %w", err)
+		}
+
+		if !exists {
+			return fmt.Errorf("vault entry '%s' not found", key)
+		}
 
-	return vm.db.Delete("vault", key)
+		return entries.Delete(key)
+	})
 }
 
 // Update updates an existing vault entry
 func (vm *VaultManager) Update(key, value, format, description string, tags []string) error {
-	// Check if entry exists
-	exists, err := vm.db.Exists("vault", key)
-	if err != nil {
-		return fmt.Errorf("failed to check if entry exists: %w", err)
-	}
+	return vm.db.Update(func(tx *storage.Tx) error {
+		entries := vm.entries.In(tx)
 
-	if !exists {
-		return fmt.Errorf("vault entry '%s' not found", key)
-	}
+		// Check if entry exists
+		exists, err := entries.Exists(key)
+		if err != nil {
+			return fmt.Errorf("failed to check if entry exists: %w", err)
+		}
+
+		if !exists {
+			return fmt.Errorf("vault entry '%s' not found", key)
+		}
+
+		// Get existing entry
+		entry, err := entries.Get(key)
+		if err != nil {
+			return fmt.Errorf("failed to get existing entry: %w", err)
+		}
+
+		// Update fields
+		entry.Value = value
+		entry.Format = format
+		entry.SetDescription(description)
+		entry.UpdatedAt = time.Now()
+
+		// Update tags
+		entry.Tags = []string{}
+		for _, tag := range tags {
+			entry.AddTag(tag)
+		}
+
+		// Store updated entry
+		return entries.Put(key, entry)
+	})
+}
 
-	// Get existing entry
+// Exists checks if a vault entry exists
+func (vm *VaultManager) Exists(key string) (bool, error) {
+	return vm.db.Exists("vault", key)
+}
+
+// GetField retrieves a single field from a JSON vault entry
+func (vm *VaultManager) GetField(key, field string) (string, error) {
 	entry, err := vm.Get(key)
 	if err != nil {
-		return fmt.Errorf("failed to get existing entry: %w", err)
+		return "", err
 	}
 
-	// Update fields
-	entry.Value = value
-	entry.Format = format
-	entry.SetDescription(description)
-	entry.UpdatedAt = time.Now()
+	fields, err := entry.Fields()
+	if err != nil {
+		return "", err
+	}
 
-	// Update tags
-	entry.Tags = []string{}
-	for _, tag := range tags {
-		entry.AddTag(tag)
+	value, exists := fields[field]
+	if !exists {
+		return "", fmt.Errorf("field '%s' not found in vault entry '%s'", field, key)
 	}
 
-	// Store updated entry
-	return vm.db.Set("vault", key, entry)
+	return value, nil
 }
 
-// Exists checks if a vault entry exists
-func (vm *VaultManager) Exists(key string) (bool, error) {
-	return vm.db.Exists("vault", key)
+// ListByPrefix returns all vault entries whose key starts with prefix
+func (vm *VaultManager) ListByPrefix(prefix string) ([]*models.VaultEntry, error) {
+	return vm.scan(storage.Query{Prefix: prefix})
 }
 
 // GetByTag returns all vault entries with a specific tag
 func (vm *VaultManager) GetByTag(tag string) ([]*models.VaultEntry, error) {
-	entries, err := vm.List()
-	if err != nil {
-		return nil, err
-	}
+	return vm.scan(storage.Query{Index: "tag", Value: tag})
+}
 
-	var filtered []*models.VaultEntry
-	for _, entry := range entries {
-		if entry.HasTag(tag) {
-			filtered = append(filtered, entry)
+// scan returns the entries q selects, recording the access
+func (vm *VaultManager) scan(q storage.Query) ([]*models.VaultEntry, error) {
+	var entries []*models.VaultEntry
+	err := vm.read(func(tx *storage.Tx) error {
+		in := vm.entries.In(tx)
+		page, err := in.Scan(q)
+		if err != nil {
+			return err
 		}
+		entries = nil
+		for _, item := range page.Items {
+			if err := touchEntry(in, item.Key, item.Value); err != nil {
+				return err
+			}
+			entries = append(entries, item.Value)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list vault entries: %w", err)
 	}
-
-	return filtered, nil
+	return entries, nil
 }
 
 // GetByFormat returns all vault entries with a specific format
@@ -186,35 +310,23 @@ func (vm *VaultManager) GetByFormat(format string) ([]*models.VaultEntry, error)
 
 // AddTag adds a tag to an existing vault entry
 func (vm *VaultManager) AddTag(key, tag string) error {
-	entry, err := vm.Get(key)
-	if err != nil {
-		return fmt.Errorf("failed to get vault entry: %w", err)
-	}
-
-	entry.AddTag(tag)
-	return vm.db.Set("vault", key, entry)
+	return vm.modifyEntry(key, func(entry *models.VaultEntry) {
+		entry.AddTag(tag)
+	})
 }
 
 // RemoveTag removes a tag from an existing vault entry
 func (vm *VaultManager) RemoveTag(key, tag string) error {
-	entry, err := vm.Get(key)
-	if err != nil {
-		return fmt.Errorf("failed to get vault entry: %w", err)
-	}
-
-	entry.RemoveTag(tag)
-	return vm.db.Set("vault", key, entry)
+	return vm.modifyEntry(key, func(entry *models.VaultEntry) {
+		entry.RemoveTag(tag)
+	})
 }
 
 // SetMetadata sets metadata for a vault entry
 func (vm *VaultManager) SetMetadata(key, metaKey string, value interface{}) error {
-	entry, err := vm.Get(key)
-	if err != nil {
-		return fmt.Errorf("failed to get vault entry: %w", err)
-	}
-
-	entry.SetMetadata(metaKey, value)
-	return vm.db.Set("vault", key, entry)
+	return vm.modifyEntry(key, func(entry *models.VaultEntry) {
+		entry.SetMetadata(metaKey, value)
+	})
 }
 
 // GetMetadata retrieves metadata from a vault entry
@@ -228,20 +340,11 @@ func (vm *VaultManager) GetMetadata(key, metaKey string) (interface{}, bool, err
 	return value, exists, nil
 }
 
-// Clear removes all vault entries
+// Clear removes all vault entries, or none if any cannot be removed
 func (vm *VaultManager) Clear() error {
-	keys, err := vm.db.List("vault")
-	if err != nil {
-		return fmt.Errorf("failed to list vault keys: %w", err)
-	}
-
-	for _, key := range keys {
-		if err := vm.db.Delete("vault", key); err != nil {
-			return fmt.Errorf("failed to delete key %s: %w", key, err)
-		}
-	}
-
-	return nil
+	return vm.db.Update(func(tx *storage.Tx) error {
+		return vm.entries.In(tx).Clear()
+	})
 }
 
 // isValidFormat checks if the format is valid
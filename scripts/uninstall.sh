@@ -16,6 +16,7 @@ NC='\033[0m' # No Color
 BINARY_NAME="ark"
 INSTALL_DIR="$HOME/.local/bin"
 CONFIG_DIR="$HOME/.ark"
+HELPER_LINKS="git-credential-ark docker-credential-ark"
 
 # Function to print colored output
 print_status() {
@@ -90,6 +91,13 @@ remove_binary() {
     else
         print_warning "Binary not found at $binary_path"
     fi
+
+    # Remove credential helper links pointing at the binary
+    for link in $HELPER_LINKS; do
+        if [ -L "$INSTALL_DIR/$link" ]; then
+            rm -f "$INSTALL_DIR/$link"
+        fi
+    done
 }
 
 # Function to stop running Ark processes